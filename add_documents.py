@@ -1,70 +1,282 @@
 import chromadb
 from chromadb.utils import embedding_functions
 from dotenv import load_dotenv
+import json
 import os
 import sys
 
+# Model used when --embedding-model is not given, and the one the local
+# embedder always uses
+DEFAULT_OPENAI_MODEL = "text-embedding-3-small"
+LOCAL_MODEL = "all-MiniLM-L6-v2"
+
+# Collection metadata keys recording the model a collection was built with
+# and, when it was shortened with --dimensions, the embedding size
+EMBEDDING_MODEL_KEY = "pvdb:embedding_model"
+EMBEDDING_DIMENSIONS_KEY = "pvdb:embedding_dimensions"
+
 def load_openai_key():
     # Load variables from .env file into environment
     load_dotenv()
-    openai_key = os.environ.get('OPENAI_KEY')
+    openai_key = os.environ.get('OPENAI_API_KEY') or os.environ.get('OPENAI_KEY')
     if not openai_key:
-        raise ValueError("OPENAI_KEY is not set in the .env file.")
+        raise ValueError("OPENAI_API_KEY is not set in the environment or the .env file.")
     return openai_key
 
-def create_openai_ef(api_key):
-    # Using OpenAI Embeddings. This assumes you have the openai package installed
+def create_openai_ef(api_key, model_name=DEFAULT_OPENAI_MODEL, dimensions=None, api_base=None):
+    # Using OpenAI Embeddings. This assumes you have the openai package installed.
+    # The launcher's -openai-config may route requests through a proxy or
+    # Azure endpoint with OPENAI_BASE_URL and set OPENAI_ORG_ID; api_base, from
+    # -embedding-endpoint, takes precedence
+    kwargs = {}
+    if dimensions:
+        # Newer models can return shortened vectors
+        kwargs["dimensions"] = dimensions
+    if api_base:
+        kwargs["api_base"] = api_base
+    elif os.environ.get("OPENAI_BASE_URL"):
+        kwargs["api_base"] = os.environ["OPENAI_BASE_URL"]
+    if os.environ.get("OPENAI_ORG_ID"):
+        kwargs["organization_id"] = os.environ["OPENAI_ORG_ID"]
     openai_ef = embedding_functions.OpenAIEmbeddingFunction(
         api_key=api_key,
-        model_name="text-embedding-ada-002"
+        model_name=model_name,
+        **kwargs
     )
     return openai_ef
 
-def create_or_get_collection(client):
+def create_local_ef():
+    # Embed on this machine with SentenceTransformers, no API key needed
+    return embedding_functions.SentenceTransformerEmbeddingFunction(
+        model_name=LOCAL_MODEL
+    )
+
+def create_embedding_function(options):
+    # The launcher passes --embedder=openai or --embedder=local
+    embedder = options.get("embedder", "openai")
+    if embedder == "local":
+        return create_local_ef()
+    if embedder == "openai":
+        endpoint = options.get("embedding-endpoint")
+        if endpoint:
+            # A self-hosted OpenAI-compatible service may need no key, but
+            # the client insists on one
+            api_key = os.environ.get("PVDB_EMBEDDING_API_KEY") or "unused"
+            return create_openai_ef(api_key=api_key, model_name=embedding_model(options), dimensions=embedding_dimensions(options), api_base=endpoint)
+        return create_openai_ef(api_key=load_openai_key(), model_name=embedding_model(options), dimensions=embedding_dimensions(options))
+    raise ValueError(f"unknown embedder {embedder!r}, want openai or local")
+
+def embedding_model(options):
+    # The launcher passes --embedding-model for the openai embedder
+    if options.get("embedder", "openai") == "local":
+        return LOCAL_MODEL
+    return options.get("embedding-model") or DEFAULT_OPENAI_MODEL
+
+def embedding_dimensions(options):
+    # The launcher passes --dimensions only when -dimensions is given
+    if "dimensions" in options:
+        return int(options["dimensions"])
+    return None
+
+def embedding_model_mismatch(collection, options):
+    # Describe a difference between the model or dimensions the collection
+    # was built with and the ones this run embeds with, or return None
+    metadata = collection.metadata or {}
+    recorded = metadata.get(EMBEDDING_MODEL_KEY)
+    model = embedding_model(options)
+    if recorded and recorded != model:
+        return f"collection '{collection.name}' was built with embedding model {recorded} but this run uses {model}"
+    recorded_dimensions = metadata.get(EMBEDDING_DIMENSIONS_KEY)
+    dimensions = embedding_dimensions(options)
+    if recorded and recorded_dimensions != dimensions:
+        def describe(d):
+            return f"{d}-dimensional embeddings" if d else "the model's full-size embeddings"
+        return f"collection '{collection.name}' was built with {describe(recorded_dimensions)} but this run uses {describe(dimensions)}"
+    return None
+
+def split_named_args(argv):
+    # Separate "--name=value" and bare "--flag" options from the positional
+    # arguments; a bare flag is recorded as "true"
+    positional = []
+    named = {}
+    for arg in argv:
+        if arg.startswith("--") and len(arg) > 2:
+            name, _, value = arg[2:].partition("=")
+            named[name] = value if "=" in arg else "true"
+        else:
+            positional.append(arg)
+    return positional, named
+
+def payload_arrays(args, options, script):
+    # The launcher passes the documents, metadatas and ids JSON arrays as
+    # three positional arguments or, with -named-args, as --documents=,
+    # --metadatas= and --ids=
+    names = ("documents", "metadatas", "ids")
+    if not args and all(name in options for name in names):
+        values = [options[name] for name in names]
+    elif len(args) == 3:
+        values = args
+    else:
+        raise ValueError(payload_usage(script))
+    return [json.loads(value) for value in values]
+
+def payload_usage(script):
+    # The launcher reads the argument form from this usage, see pvdb contract
+    return (f"Usage: python {script} <documents> <metadatas> <ids> [--collection=NAME]\n"
+            f"       python {script} --documents=JSON --metadatas=JSON --ids=JSON [--collection=NAME]")
+
+def exit_on_help(options, script):
+    # --help prints the usage on stdout and succeeds, as argparse does
+    if "help" in options:
+        print(payload_usage(script))
+        sys.exit(0)
+
+def precomputed_embeddings(options, count):
+    # The launcher passes vectors computed elsewhere as --embeddings=, one
+    # per document with null for those Chroma should embed
+    if "embeddings" not in options:
+        return [None] * count
+    embeddings = json.loads(options["embeddings"])
+    if len(embeddings) != count:
+        raise ValueError(f"got {count} documents but {len(embeddings)} embeddings")
+    return embeddings
+
+def persist_directory(options):
+    # The launcher passes --persist-dir and exports CHROMA_PERSIST_DIR
+    return options.get("persist-dir") or os.environ.get("CHROMA_PERSIST_DIR", "db")
+
+def server_settings():
+    # The launcher's -chroma-url arrives as CHROMA_SERVER_*; CHROMA_HOST and
+    # CHROMA_PORT can also be set by hand. Returns None for the on-disk store.
+    host = os.environ.get("CHROMA_SERVER_HOST")
+    if host:
+        port = int(os.environ.get("CHROMA_SERVER_HTTP_PORT", "8000"))
+        return host, port, os.environ.get("CHROMA_SERVER_SSL") == "true"
+    host = os.environ.get("CHROMA_HOST")
+    if host:
+        return host, int(os.environ.get("CHROMA_PORT", "8000")), False
+    return None
+
+def ephemeral():
+    # The launcher's -no-persist exports EPHEMERAL=1
+    return os.environ.get("EPHEMERAL") == "1"
+
+def open_client(options):
+    # Talk to a Chroma server when one is configured, otherwise open the
+    # embedded store on disk, or in memory under EPHEMERAL=1
+    if ephemeral():
+        return chromadb.EphemeralClient()
+    server = server_settings()
+    if server:
+        host, port, ssl = server
+        return chromadb.HttpClient(host=host, port=port, ssl=ssl)
+    return chromadb.PersistentClient(path=persist_directory(options))
+
+def collection_metadata(options):
+    # The launcher forwards -collection-metadata, e.g. {"hnsw:space": "cosine"}
+    if "collection-metadata" in options:
+        return json.loads(options["collection-metadata"])
+    return None
+
+def collection_names(client):
+    # Older chromadb releases return Collection objects, newer ones names
+    return [c if isinstance(c, str) else c.name for c in client.list_collections()]
+
+def new_collection_metadata(client, collection_name, options):
+    # Record the embedding model on collections this run creates; an
+    # existing collection keeps the model it was built with
+    metadata = collection_metadata(options) or {}
+    if collection_name not in collection_names(client):
+        metadata[EMBEDDING_MODEL_KEY] = embedding_model(options)
+        if embedding_dimensions(options):
+            metadata[EMBEDDING_DIMENSIONS_KEY] = embedding_dimensions(options)
+    return metadata
+
+def create_or_get_collection(client, collection_name="documents", embedding_function=None, metadata=None):
     # Create a new chroma collection
-    collection_name = "lake"
-    return client.get_or_create_collection(name=collection_name)
+    kwargs = {}
+    if embedding_function is not None:
+        kwargs["embedding_function"] = embedding_function
+    if metadata:
+        kwargs["metadata"] = metadata
+    return client.get_or_create_collection(name=collection_name, **kwargs)
+
+def get_existing_collection(client, collection_name="documents", embedding_function=None):
+    # Scripts that only read run under a shared lock on the persist dir, so
+    # they must not create the collection; a missing one is an error
+    kwargs = {}
+    if embedding_function is not None:
+        kwargs["embedding_function"] = embedding_function
+    return client.get_collection(name=collection_name, **kwargs)
 
-def add_to_openai_collection(collection, documents, metadatas, ids):
+def add_to_openai_collection(collection, documents, metadatas, ids, embeddings=None):
+    # Chroma ignores ids it already holds, so they are counted as skipped
+    # rather than added
+    existing = set(collection.get(ids=list(ids), include=[])["ids"]) if ids else set()
+    result = {"added": 0, "skipped": len(existing), "errors": 0}
     try:
-        collection.add(
-            documents=documents,
-            metadatas=metadatas,
-            ids=ids
-        )
-        print("Documents added to the collection successfully.")
+        # Documents with a precomputed embedding are stored as they are so
+        # only the rest go through the embedding function
+        embeddings = embeddings or [None] * len(documents)
+        new = [i for i in range(len(documents)) if ids[i] not in existing]
+        given = [i for i in new if embeddings[i] is not None]
+        missing = [i for i in new if embeddings[i] is None]
+        for indexes, with_embeddings in ((given, True), (missing, False)):
+            if not indexes:
+                continue
+            kwargs = {}
+            if with_embeddings:
+                kwargs["embeddings"] = [embeddings[i] for i in indexes]
+            try:
+                collection.add(
+                    documents=[documents[i] for i in indexes],
+                    metadatas=[metadatas[i] for i in indexes],
+                    ids=[ids[i] for i in indexes],
+                    **kwargs
+                )
+            except Exception:
+                result["errors"] = len(new) - result["added"]
+                raise
+            result["added"] += len(indexes)
+        # The launcher parses the summary from the last line of stdout
+        print(json.dumps(result))
     except Exception as e:
-        print(f"Error occurred while adding documents: {e}")
+        print(json.dumps(result))
+        print(f"Error occurred while adding documents: {e}", file=sys.stderr)
+        sys.exit(1)
 
 if __name__ == "__main__":
     try:
-        # Check if three command-line arguments are provided
-        if len(sys.argv) != 4:
-            raise ValueError("Usage: python script.py <documents> <metadatas> <ids>")
+        args, options = split_named_args(sys.argv[1:])
+        exit_on_help(options, "add_documents.py")
 
-        # Extract the command-line arguments as strings
-        documents = sys.argv[1]
-        metadatas = sys.argv[2]
-        ids = sys.argv[3]
+        # Decode the three JSON arrays, positional or named
+        documents, metadatas, ids = payload_arrays(args, options, "add_documents.py")
+        embeddings = precomputed_embeddings(options, len(documents))
 
         # Create a new Chroma client with persistence enabled.
-        persist_directory = "db" # this path for the db could be an arg 
-        client = chromadb.PersistentClient(path=persist_directory)
+        client = open_client(options)
 
-        # Load the OpenAI key
-        openai_key = load_openai_key()
-
-        # Create/Open OpenAI Embedding Function
-        openai_ef = create_openai_ef(api_key=openai_key)
+        # Create the embedding function chosen with --embedder
+        ef = create_embedding_function(options)
 
         # Create or get the Chroma collection
-        openai_collection = create_or_get_collection(client)
+        name = options.get("collection", "documents")
+        collection = create_or_get_collection(client, name, ef, new_collection_metadata(client, name, options))
+
+        # Adding with a different model mixes incomparable vectors
+        mismatch = embedding_model_mismatch(collection, options)
+        if mismatch:
+            print(f"warning: {mismatch}", file=sys.stderr)
 
         # Call the function with the provided arguments
-        add_to_openai_collection(openai_collection, documents, metadatas, ids)
+        add_to_openai_collection(collection, documents, metadatas, ids, embeddings)
     except ValueError as ve:
-        print(ve)
+        print(ve, file=sys.stderr)
+        sys.exit(1)
     except chromadb.ChromaDBError as cde:
-        print(f"ChromaDBError: {cde}")
+        print(f"ChromaDBError: {cde}", file=sys.stderr)
+        sys.exit(1)
     except Exception as e:
-        print(f"An unexpected error occurred: {e}")
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -1,5 +1,8 @@
+import json
 import os
+import subprocess
 import sys
+import tempfile
 import chromadb
 from chromadb.utils import embedding_functions
 from dotenv import load_dotenv
@@ -68,3 +71,59 @@ def step_impl_verify_success(context):
     assert len(context.openai_collection) == len(context.documents.split(",")), "Number of documents added is incorrect."
 
     # Additional assertions if required
+
+@given("the pvdb launcher is built")
+def step_impl_find_launcher(context):
+    # Build it with `go build -o pvdb .` or point PVDB_BIN at a binary
+    context.pvdb = os.path.abspath(os.environ.get("PVDB_BIN", "pvdb"))
+    if not os.path.isfile(context.pvdb):
+        raise ValueError(f"{context.pvdb} does not exist; run go build -o pvdb . first")
+
+@given("the locale is plain ASCII")
+def step_impl_ascii_locale(context):
+    # The C locale is where Python would otherwise write ASCII to pipes
+    context.env = dict(os.environ, LC_ALL="C", LANG="C")
+    context.env.pop("PYTHONIOENCODING", None)
+
+@when("documents with emoji and CJK characters are added with the local embedder")
+def step_impl_add_non_ascii(context):
+    context.documents = ["héllo wörld 👋", "日本語のテキストです", "中文文档 🚀 测试"]
+    context.persist_directory = tempfile.mkdtemp()
+    context.store_args = ["-persist-dir", context.persist_directory, "-collection", "encoding-test", "-embedder", "local", "-script-dir", os.getcwd()]
+    subprocess.run(
+        [context.pvdb, "add",
+         "-documents", json.dumps(context.documents, ensure_ascii=False),
+         "-metadatas", json.dumps([{} for _ in context.documents]),
+         "-ids", json.dumps([f"doc{i}" for i in range(len(context.documents))])] + context.store_args,
+        env=context.env, check=True)
+
+@then("querying for each document returns its text unchanged")
+def step_impl_query_non_ascii(context):
+    for document in context.documents:
+        output = subprocess.run(
+            [context.pvdb, "query", document, "-n", "1", "-json"] + context.store_args,
+            env=context.env, check=True, capture_output=True).stdout
+        results = json.loads(output.decode("utf-8"))["results"]
+        assert results[0]["document"] == document, f"{document!r} came back as {results[0]['document']!r}"
+
+@when("identical documents are added under shuffled ids with the local embedder")
+def step_impl_add_identical(context):
+    # The same text embeds to the same vector, so every hit ties on distance
+    context.ids = ["doc-c", "doc-a", "doc-d", "doc-b"]
+    context.persist_directory = tempfile.mkdtemp()
+    context.store_args = ["-persist-dir", context.persist_directory, "-collection", "tie-test", "-embedder", "local", "-script-dir", os.getcwd()]
+    subprocess.run(
+        [context.pvdb, "add",
+         "-documents", json.dumps(["jollof rice" for _ in context.ids]),
+         "-metadatas", json.dumps([{} for _ in context.ids]),
+         "-ids", json.dumps(context.ids)] + context.store_args,
+        check=True)
+
+@then("querying for their text returns them in id order on every run")
+def step_impl_query_ties(context):
+    for _ in range(3):
+        output = subprocess.run(
+            [context.pvdb, "query", "jollof rice", "-n", str(len(context.ids)), "-json"] + context.store_args,
+            check=True, capture_output=True).stdout
+        ids = [hit["id"] for hit in json.loads(output)["results"]]
+        assert ids == sorted(context.ids), f"equal-distance hits came back as {ids}"
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// Argument contracts of the ingestion scripts: how they take the documents,
+// metadatas and ids.
+const (
+	contractPositional = "positional"
+	contractNamed      = "named"
+)
+
+// payloadScripts are the scripts that take an ingestion payload.
+var payloadScripts = []string{"add_documents.py", "update_documents.py"}
+
+// contractDetection is how the contract of one script was settled.
+type contractDetection struct {
+	Script   string `json:"script"`
+	Contract string `json:"contract"`
+	// Source is "cache", "detected" or, when detection failed, "fallback".
+	Source string `json:"source"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// detectedContracts caches the contracts detected in this run by the
+// script's SHA-256; contractCacheFile keeps them across runs, so a script is
+// only probed again once its contents change.
+var detectedContracts = struct {
+	sync.Mutex
+	bySum map[string]string
+}{bySum: map[string]string{}}
+
+// contractCacheFile is where detected contracts are kept across runs.
+func contractCacheFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pvdb", "args-contracts.json"), nil
+}
+
+// payloadNamedArgs reports whether the ingestion payload goes to script as
+// named arguments: as -named-args says when it was given, otherwise as
+// detected from the script.
+func (c *commonFlags) payloadNamedArgs(ctx context.Context, python, script string) bool {
+	if c.namedArgs || c.isSet("named-args") {
+		return c.namedArgs
+	}
+	d := c.detectContract(ctx, python, script, false)
+	if d.Source == "fallback" {
+		slog.Debug("cannot tell the argument contract of the script; passing the payload as positional arguments", "script", script, "reason", d.Reason)
+	}
+	return d.Contract == contractNamed
+}
+
+// detectContract settles the contract of the script at path from the cache
+// or, when it isn't cached or refresh is set, by launching the script with
+// --help and reading the usage it prints on stdout. Anything short of a
+// usage naming the payload arguments falls back to positional arguments,
+// which every script accepted before named ones were introduced; fallbacks
+// aren't cached so the next run tries again. Dry runs launch nothing.
+func (c *commonFlags) detectContract(ctx context.Context, python, path string, refresh bool) contractDetection {
+	d := contractDetection{Script: filepath.Base(path), Contract: contractPositional, Source: "fallback"}
+	sum, err := hashFile(path)
+	if err != nil {
+		d.Reason = err.Error()
+		return d
+	}
+	detectedContracts.Lock()
+	defer detectedContracts.Unlock()
+	if !refresh {
+		contract, ok := detectedContracts.bySum[sum]
+		if !ok {
+			contract, ok = loadContractCache()[sum]
+		}
+		if ok {
+			detectedContracts.bySum[sum] = contract
+			d.Contract, d.Source = contract, "cache"
+			return d
+		}
+	}
+	if c.dryRun {
+		d.Reason = "not detected under -dry-run"
+		return d
+	}
+
+	defer trace.child("argument contract detection").end()
+	result, err := c.probeScript(ctx, python, path, []string{"--help"})
+	// The usage is read from stdout only, where argparse and the scripts
+	// print it for --help, so a warning on stderr can't be mistaken for it
+	named, ok := pvdb.ParseContract(result.Stdout)
+	if !ok {
+		d.Reason = "no usage naming the documents argument in the output of --help"
+		if err != nil {
+			d.Reason = fmt.Sprintf("%v: %s", err, lastLine(result.Stderr))
+		}
+		return d
+	}
+	if named {
+		d.Contract = contractNamed
+	}
+	detectedContracts.bySum[sum] = d.Contract
+	saveContractCache(sum, d.Contract)
+	d.Source = "detected"
+	return d
+}
+
+// loadContractCache reads the contracts cached across runs, by script
+// SHA-256. The cache is only an optimisation, so a missing or unreadable
+// one is empty.
+func loadContractCache() map[string]string {
+	path, err := contractCacheFile()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cached map[string]string
+	if err := json.Unmarshal(data, &cached); err != nil {
+		slog.Debug("ignoring unreadable argument contract cache", "path", path, "err", err)
+		return nil
+	}
+	return cached
+}
+
+// saveContractCache adds the contract of the script with SHA-256 sum to the
+// cache kept across runs. Failing to write it only means probing again.
+func saveContractCache(sum, contract string) {
+	path, err := contractCacheFile()
+	if err != nil {
+		return
+	}
+	cached := loadContractCache()
+	if cached == nil {
+		cached = map[string]string{}
+	}
+	cached[sum] = contract
+	data, err := json.MarshalIndent(cached, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		slog.Debug("cannot cache argument contracts", "err", err)
+		return
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		slog.Debug("cannot cache argument contracts", "err", err)
+	}
+}
+
+// runContract handles `pvdb contract`, which reports whether each
+// ingestion script takes its payload as positional or named arguments and
+// how that was settled, for checking scripts while they move to named
+// arguments. -refresh probes the scripts again instead of trusting the
+// cache.
+func runContract(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("contract")
+	refresh := fs.Bool("refresh", false, "launch each script with --help again instead of using the cached contract")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if fs.NArg() > 0 {
+		return nil, invalidArgsf("unexpected arguments %q", fs.Args())
+	}
+	if err := common.resolve(); err != nil {
+		return nil, err
+	}
+
+	detections := make([]contractDetection, 0, len(payloadScripts))
+	for _, name := range payloadScripts {
+		path, err := common.scriptPath(name)
+		if err != nil {
+			return nil, err
+		}
+		detections = append(detections, common.detectContract(ctx, python, path, *refresh))
+	}
+	if jsonOutput {
+		return summary{"scripts": detections}, nil
+	}
+	tw := tabwriter.NewWriter(humanOut(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCRIPT\tCONTRACT\tSOURCE")
+	for _, d := range detections {
+		source := d.Source
+		if d.Reason != "" {
+			source += ": " + d.Reason
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Script, d.Contract, source)
+	}
+	tw.Flush()
+	return nil, nil
+}
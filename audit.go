@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+)
+
+// auditLog is the -audit-log file, empty to keep no audit trail.
+var auditLog string
+
+// auditFlag defines -audit-log on fs.
+func auditFlag(fs *flag.FlagSet) {
+	fs.StringVar(&auditLog, "audit-log", "", "file to append a JSON line describing this invocation to")
+}
+
+// auditEntry is one line of the -audit-log file. The subcommands fill in
+// what they know as they run; main completes and writes it on exit.
+type auditEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Subcommand string    `json:"subcommand"`
+	Collection string    `json:"collection,omitempty"`
+	Documents  int       `json:"documents"`
+	Duration   float64   `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+}
+
+// audit is the entry for the current invocation.
+var audit auditEntry
+
+// appendAudit appends e to path as a single JSON line. The file is opened
+// with O_APPEND and the line goes out in one write, so concurrent
+// invocations sharing the file never interleave their lines.
+func appendAudit(path string, e auditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
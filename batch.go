@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// Default retry policy for a failed batch.
+const (
+	defaultRetries       = 3
+	defaultRetryBackoff  = time.Second
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// retryPolicy configures how often a failed batch is re-run.
+type retryPolicy struct {
+	maxRetries int
+	base       time.Duration
+	// maxDelay caps the backoff ceiling, zero for no cap.
+	maxDelay time.Duration
+	// budget, when set, bounds the retries of all batches together.
+	budget *retryBudget
+}
+
+// retryBudget is a number of retries shared by every batch of a run, so a
+// bad day can't multiply per-batch retries into thousands.
+type retryBudget struct {
+	limit     int64
+	used      atomic.Int64
+	exhausted atomic.Bool
+}
+
+// report prints how much of the budget the run used and records it in sum
+// for -json. A nil budget reports nothing.
+func (b *retryBudget) report(sum summary) {
+	if b == nil || sum == nil {
+		return
+	}
+	used := b.used.Load()
+	fmt.Fprintf(statusOut(), "used %d of %d total retries\n", used, b.limit)
+	sum["retries_used"] = used
+	sum["max_total_retries"] = b.limit
+}
+
+// take claims one retry, reporting false once the budget is spent. A nil
+// budget never runs out.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	if b.used.Add(1) > b.limit {
+		b.used.Add(-1)
+		if !b.exhausted.Swap(true) {
+			slog.Warn("retry budget exhausted; failing batches are no longer retried", "max_total_retries", b.limit)
+		}
+		return false
+	}
+	return true
+}
+
+// delay returns how long to wait before retry number attempt, counting from
+// zero. It uses full jitter: a random duration between zero and
+// base*2^attempt, capped at maxDelay, so workers whose batches failed
+// together don't retry in lockstep.
+func (r retryPolicy) delay(attempt int) time.Duration {
+	ceiling := r.base
+	for i := 0; i < attempt && (r.maxDelay == 0 || ceiling < r.maxDelay); i++ {
+		ceiling *= 2
+	}
+	if r.maxDelay > 0 {
+		ceiling = min(ceiling, r.maxDelay)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// defaultConcurrency is how many batches run at once against a client/server
+// Chroma.
+const defaultConcurrency = 4
+
+// defaultBatchSize keeps each add_documents.py call well inside memory and
+// OpenAI rate limits.
+const defaultBatchSize = 256
+
+// batchError reports a failed batch together with the ids it contained so the
+// caller can retry just that slice.
+type batchError struct {
+	index int
+	ids   []string
+	err   error
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("batch %d failed (ids %s): %v", e.index, strings.Join(e.ids, ", "), e.err)
+}
+
+func (e *batchError) Unwrap() error {
+	return e.err
+}
+
+// ingestBatches runs the named script once per batch on up to concurrency
+// workers. With failFast, once a batch still fails after its retries no
+// further batches are started; the ones in flight finish. Otherwise every
+// batch is attempted. Each failure, with its batch index and ids, is reported
+// in the combined error, as is the first batch not started once ctx or the
+// run's timeout ends. Launches across all workers are spaced out by limit,
+// which may be nil for no limit. Each batch, retries included, gets its own
+// timeout: -per-batch-timeout, with -timeout then bounding the whole run, or
+// else -timeout. Each success is reported to prog. When added is not nil the
+// script prints an add_documents.py summary, which is merged into added
+// instead of being echoed. It returns how many documents were ingested.
+func ingestBatches(ctx context.Context, python, name string, batches []ingestPayload, common *commonFlags, retry retryPolicy, concurrency int, failFast bool, limit *rateLimiter, prog *progress, added *pvdb.AddResult) (int, error) {
+	script, err := common.scriptPath(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := common.ensureReady(ctx, python); err != nil {
+		return 0, err
+	}
+
+	batchTimeout := common.timeout
+	if common.perBatchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, common.timeout)
+		defer cancel()
+		batchTimeout = common.perBatchTimeout
+	}
+
+	namedArgs := common.payloadNamedArgs(ctx, python, script)
+	batchArgs := make([][]string, len(batches))
+	for i, batch := range batches {
+		if batchArgs[i], err = batch.ScriptArgs(namedArgs); err != nil {
+			return 0, err
+		}
+		batchArgs[i] = append(batchArgs[i], common.batchOptions...)
+	}
+	if common.dryRun {
+		for _, scriptArgs := range batchArgs {
+			printDryRun(common.command(ctx, python, script, scriptArgs))
+		}
+		return 0, nil
+	}
+
+	var (
+		mu                   sync.Mutex
+		next                 int
+		succeeded, documents int
+		failures             []error
+		wg                   sync.WaitGroup
+	)
+	runBatch := func(i int) error {
+		// The slot is kept across retries, which re-run the same batch
+		if err := pvdb.AcquireProcess(ctx); err != nil {
+			return &batchError{index: i, ids: batches[i].IDs, err: err}
+		}
+		defer pvdb.ReleaseProcess()
+		batchCtx, cancel := context.WithTimeout(ctx, batchTimeout)
+		defer cancel()
+		newCmd := func() *exec.Cmd {
+			return common.command(batchCtx, python, script, batchArgs[i])
+		}
+		result, err := retryLauncher(batchCtx, newCmd, common.maxOutputBytes, retry)
+		// The run's deadline takes precedence over the batch's own.
+		if ctx.Err() == nil {
+			err = launchError(batchCtx, batchTimeout, err)
+		} else {
+			err = launchError(ctx, common.timeout, err)
+		}
+		if added == nil {
+			printResult(result)
+		} else {
+			mu.Lock()
+			mergeAddResult(added, result.Stdout, len(batches[i].IDs), err)
+			mu.Unlock()
+		}
+		if err != nil {
+			return &batchError{index: i, ids: batches[i].IDs, err: err}
+		}
+		return nil
+	}
+
+	start := time.Now()
+	for w := 0; w < min(concurrency, len(batches)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := func() bool {
+				return next == len(batches) || ctx.Err() != nil || (failFast && len(failures) > 0)
+			}
+			throttled := func() {
+				mu.Lock()
+				prog.throttled()
+				mu.Unlock()
+			}
+			for {
+				mu.Lock()
+				idle := done()
+				mu.Unlock()
+				if idle {
+					return
+				}
+				// Once ctx ends the throttled batch is reported as not started
+				if limit.wait(ctx, throttled) != nil {
+					return
+				}
+				mu.Lock()
+				if done() {
+					mu.Unlock()
+					return
+				}
+				i := next
+				next++
+				mu.Unlock()
+
+				batchStart := time.Now()
+				err := runBatch(i)
+
+				mu.Lock()
+				if err != nil {
+					failures = append(failures, err)
+				} else {
+					succeeded++
+					documents += len(batches[i].Documents)
+					prog.batchDone(i, len(batches[i].Documents), time.Since(batchStart))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Fprintf(statusOut(), "ingested %d documents in %s (%.1f docs/sec): %d batches succeeded, %d failed, %d not attempted\n",
+		documents, elapsed.Round(time.Millisecond), float64(documents)/elapsed.Seconds(),
+		succeeded, len(failures), len(batches)-succeeded-len(failures))
+	if next < len(batches) && ctx.Err() != nil {
+		failures = append(failures, fmt.Errorf("batch %d not started: %w", next, launchError(ctx, common.timeout, ctx.Err())))
+	}
+	return documents, errors.Join(failures...)
+}
+
+// mergeAddResult merges the summary add_documents.py printed for a batch of
+// n documents into added. A successful batch without a readable summary is
+// logged and leaves the counts unknown; a failed one counts its documents as
+// errors unless its summary says otherwise.
+func mergeAddResult(added *pvdb.AddResult, stdout string, n int, batchErr error) {
+	r, err := pvdb.ParseAddResult(stdout)
+	switch {
+	case err == nil:
+	case batchErr != nil:
+		r = pvdb.AddResult{Errors: n}
+	default:
+		slog.Warn("add_documents.py succeeded but its counts are unknown", "err", err)
+		r = pvdb.AddResult{Unknown: true}
+	}
+	added.Merge(r)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// testCommonFlags parses args, after a temporary -script-dir holding an
+// empty add_documents.py and -env-file and a -persist-dir inside it, into
+// the common flags of an ingesting subcommand, as the subcommands themselves
+// do.
+func testCommonFlags(t *testing.T, args ...string) *commonFlags {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"add_documents.py", ".env"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	common := registerCommonFlags(fs)
+	common.namedArgsFlag(fs)
+	args = append([]string{"-script-dir", dir, "-persist-dir", filepath.Join(dir, "db"), "-env-file", filepath.Join(dir, ".env")}, args...)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	return common
+}
+
+// addScript answers a faked add_documents.py run by storing every document
+// of the batch, and the chromadb version check with a supported version.
+func addScript(script string, args []string) fakeScript {
+	if script == "-c" {
+		return fakeScript{Stdout: "1.0.0\n"}
+	}
+	var docs []string
+	if err := json.Unmarshal([]byte(args[0]), &docs); err != nil {
+		return fakeScript{Stderr: err.Error(), ExitCode: 1}
+	}
+	summary, _ := json.Marshal(pvdb.AddResult{Added: len(docs)})
+	return fakeScript{Stdout: string(summary) + "\n"}
+}
+
+// testPayload is n documents with ids id0, id1 and so on.
+func testPayload(n int) ingestPayload {
+	var p ingestPayload
+	for i := 0; i < n; i++ {
+		p.Documents = append(p.Documents, "document")
+		p.Metadatas = append(p.Metadatas, map[string]any{"i": i})
+		p.IDs = append(p.IDs, "id"+strconv.Itoa(i))
+	}
+	return p
+}
+
+func TestIngestBatchesMergesAddResults(t *testing.T) {
+	calls := fakeLauncher(t, addScript)
+	common := testCommonFlags(t, "-named-args=false")
+	batches := pvdb.SplitBatches(testPayload(5), 2)
+
+	var added pvdb.AddResult
+	n, err := ingestBatches(context.Background(), "python3", "add_documents.py", batches, common, retryPolicy{}, 1, true, nil, newProgress(io.Discard, len(batches), 5), &added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || added != (pvdb.AddResult{Added: 5}) {
+		t.Errorf("ingested %d documents with result %+v, want 5 added", n, added)
+	}
+
+	var adds []fakeCall
+	for _, call := range calls.all() {
+		if call.Script == "add_documents.py" {
+			adds = append(adds, call)
+		}
+	}
+	if len(adds) != 3 {
+		t.Fatalf("add_documents.py ran %d times, want once per batch of 2: %v", len(adds), adds)
+	}
+	if got, want := adds[2].Args[2], `["id4"]`; got != want {
+		t.Errorf("last batch got ids %s, want %s", got, want)
+	}
+}
+
+func TestIngestBatchesRetriesFailedBatch(t *testing.T) {
+	var attempts atomic.Int32
+	fakeLauncher(t, func(script string, args []string) fakeScript {
+		if script == "add_documents.py" && attempts.Add(1) == 1 {
+			return fakeScript{Stderr: "chromadb is busy\n", ExitCode: 1}
+		}
+		return addScript(script, args)
+	})
+	common := testCommonFlags(t, "-named-args=false")
+	batches := pvdb.SplitBatches(testPayload(2), 2)
+
+	var added pvdb.AddResult
+	retry := retryPolicy{maxRetries: 1, base: time.Millisecond}
+	n, err := ingestBatches(context.Background(), "python3", "add_documents.py", batches, common, retry, 1, true, nil, newProgress(io.Discard, len(batches), 2), &added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || attempts.Load() != 2 {
+		t.Errorf("ingested %d documents in %d attempts, want 2 documents in 2", n, attempts.Load())
+	}
+}
+
+// callOnWrite calls fn once a line containing match is written to it.
+type callOnWrite struct {
+	match string
+	fn    func()
+}
+
+func (w callOnWrite) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), w.match) {
+		w.fn()
+	}
+	return len(p), nil
+}
+
+// expiringContext is a context whose deadline passes when expire is called,
+// so a test can end a run at an exact point rather than after a wait.
+type expiringContext struct {
+	context.Context
+	done chan struct{}
+	once sync.Once
+}
+
+func newExpiringContext() *expiringContext {
+	return &expiringContext{Context: context.Background(), done: make(chan struct{})}
+}
+
+func (c *expiringContext) expire() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *expiringContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *expiringContext) Err() error {
+	select {
+	case <-c.done:
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+func TestIngestBatchesFailsWhenTimeoutEndsBetweenBatches(t *testing.T) {
+	fakeLauncher(t, addScript)
+	common := testCommonFlags(t, "-named-args=false")
+	batches := pvdb.SplitBatches(testPayload(4), 1)
+
+	// The deadline passes as the first batch is reported, with no batch in
+	// flight
+	ctx := newExpiringContext()
+	prog := newProgress(callOnWrite{match: "[batch 1/4]", fn: ctx.expire}, len(batches), 4)
+	var added pvdb.AddResult
+	n, err := ingestBatches(ctx, "python3", "add_documents.py", batches, common, retryPolicy{}, 1, true, nil, prog, &added)
+	if err == nil {
+		t.Fatalf("ingested %d of 4 documents and reported success", n)
+	}
+	if code := exitCode(err); code != exitTimeout {
+		t.Errorf("error %v exits with %d, want %d", err, code, exitTimeout)
+	}
+	if n != 1 {
+		t.Errorf("ingested %d documents, want the 1 of the batch before the deadline", n)
+	}
+}
+
+func TestIngestBatchesFailsWhenCancelledWhileThrottled(t *testing.T) {
+	fakeLauncher(t, addScript)
+	common := testCommonFlags(t, "-named-args=false")
+	batches := pvdb.SplitBatches(testPayload(3), 1)
+	// The first launch is immediate, the next one a minute later
+	limit := newRateLimiter(1)
+	defer limit.stop()
+
+	// Cancel as soon as the progress reports the wait on the limiter
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	prog := newProgress(callOnWrite{match: "waiting on the rate limiter", fn: cancel}, len(batches), 3)
+	var added pvdb.AddResult
+	n, err := ingestBatches(ctx, "python3", "add_documents.py", batches, common, retryPolicy{}, 1, true, limit, prog, &added)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ingested %d of 3 documents with error %v, want context.Canceled", n, err)
+	}
+	if code := exitCode(err); code == exitOK {
+		t.Errorf("error %v exits with %d", err, code)
+	}
+	if n != 1 {
+		t.Errorf("ingested %d documents, want the 1 of the batch before the cancellation", n)
+	}
+}
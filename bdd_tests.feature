@@ -6,3 +6,14 @@ Feature: Adding documents to the OpenAI collection
     And a Chroma client with persistence enabled is available
     When documents, metadatas, and ids are provided
     Then the documents should be added to the collection successfully
+
+  Scenario: Non-ASCII documents round-trip through the launcher
+    Given the pvdb launcher is built
+    And the locale is plain ASCII
+    When documents with emoji and CJK characters are added with the local embedder
+    Then querying for each document returns its text unchanged
+
+  Scenario: Query results at equal distances come back in id order
+    Given the pvdb launcher is built
+    When identical documents are added under shuffled ids with the local embedder
+    Then querying for their text returns them in id order on every run
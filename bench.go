@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// benchCollection keeps synthetic benchmark documents out of real
+// collections unless -collection says otherwise.
+const benchCollection = "pvdb-bench"
+
+// benchWords is the vocabulary synthetic documents are drawn from.
+var benchWords = strings.Fields(`jolof rice stew plantain pepper onion tomato
+	thyme curry ginger garlic beans yam cassava egusi okra palm oil chicken goat
+	fish smoke simmer fry boil roast season serve market kitchen recipe family`)
+
+// runBench handles `pvdb bench -n 1000 -batch-size 128`, ingesting n
+// synthetic documents through the normal batching path and reporting
+// throughput and per-batch latency. The same -seed always produces the same
+// documents, so runs are comparable.
+func runBench(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("bench")
+	n := fs.Int("n", 1000, "number of synthetic documents to ingest")
+	batchSize := fs.Int("batch-size", 128, "maximum documents per add_documents.py invocation")
+	seed := fs.Int64("seed", 1, "seed for generating the synthetic documents")
+	common := registerCommonFlags(fs)
+	common.embedderFlag(fs)
+	common.collectionMetadataFlag(fs)
+	collection := fs.Lookup("collection")
+	collection.DefValue = benchCollection
+	collection.Value.Set(benchCollection)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *n <= 0 {
+		return nil, invalidArgsf("-n must be positive, got %d", *n)
+	}
+	if *batchSize <= 0 {
+		return nil, invalidArgsf("-batch-size must be positive, got %d", *batchSize)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+	if err := common.requireOpenAIKey(); err != nil {
+		return nil, err
+	}
+
+	batches := pvdb.SplitBatches(benchPayload(*n, *seed), *batchSize)
+	progressOut := cli.stderr
+	if quietOutput() {
+		progressOut = io.Discard
+	}
+	prog := newProgress(progressOut, len(batches), *n)
+	retry := retryPolicy{maxRetries: defaultRetries, base: defaultRetryBackoff, maxDelay: defaultRetryMaxDelay}
+	start := time.Now()
+	ingested, err := ingestBatches(ctx, python, addCommand.script, batches, common, retry, 1, true, nil, prog, &pvdb.AddResult{})
+	elapsed := time.Since(start)
+	audit.Documents = ingested
+	if err != nil || common.dryRun {
+		return dryRunSummary(!common.dryRun), err
+	}
+
+	p50, p95 := percentile(prog.latencies, 50), percentile(prog.latencies, 95)
+	docsPerSec := float64(ingested) / elapsed.Seconds()
+	fmt.Fprintf(humanOut(), "bench: %d documents in %d batches of up to %d into '%s'\n", ingested, len(batches), *batchSize, common.collection)
+	fmt.Fprintf(humanOut(), "total %s, %.1f docs/sec, batch latency p50 %s, p95 %s\n",
+		elapsed.Round(time.Millisecond), docsPerSec, p50.Round(time.Millisecond), p95.Round(time.Millisecond))
+	return summary{
+		"collection":     common.collection,
+		"documents":      ingested,
+		"batches":        len(batches),
+		"batch_size":     *batchSize,
+		"seed":           *seed,
+		"total_seconds":  elapsed.Seconds(),
+		"docs_per_sec":   docsPerSec,
+		"batch_p50_secs": p50.Seconds(),
+		"batch_p95_secs": p95.Seconds(),
+	}, nil
+}
+
+// benchPayload generates n synthetic documents determined entirely by seed.
+func benchPayload(n int, seed int64) ingestPayload {
+	rng := rand.New(rand.NewSource(seed))
+	var p ingestPayload
+	for i := 0; i < n; i++ {
+		words := make([]string, 20+rng.Intn(21))
+		for j := range words {
+			words[j] = benchWords[rng.Intn(len(benchWords))]
+		}
+		p.Documents = append(p.Documents, strings.Join(words, " "))
+		p.Metadatas = append(p.Metadatas, map[string]any{"bench_seed": float64(seed), "index": float64(i)})
+		p.IDs = append(p.IDs, fmt.Sprintf("bench-%d-%d", seed, i))
+	}
+	return p
+}
+
+// percentile returns the nearest-rank pth percentile of durations, or zero
+// when there are none.
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// storedTexts asks get_documents.py for the text stored under each of ids,
+// in chunks of existsChunk. Ids not in the collection are absent from the
+// result. Under -dry-run the commands are only printed and nothing is
+// reported as stored.
+func (c *commonFlags) storedTexts(ctx context.Context, python string, ids []string) (map[string]string, error) {
+	stored := make(map[string]string)
+	for start := 0; start < len(ids); start += existsChunk {
+		encoded, err := json.Marshal(ids[start:min(start+existsChunk, len(ids))])
+		if err != nil {
+			return nil, err
+		}
+		result, ran, err := c.runScript(ctx, python, "get_documents.py", []string{string(encoded)})
+		if err != nil || !ran {
+			return stored, err
+		}
+		var found map[string]string
+		if err := json.Unmarshal([]byte(result.Stdout), &found); err != nil {
+			return nil, fmt.Errorf("get_documents.py returned invalid JSON: %w", err)
+		}
+		for id, text := range found {
+			stored[id] = text
+		}
+	}
+	return stored, nil
+}
+
+// changedDocuments returns the documents of p whose text differs from the
+// one stored under their id, or that aren't stored at all. Metadata is not
+// compared.
+func changedDocuments(p ingestPayload, stored map[string]string) ingestPayload {
+	var kept ingestPayload
+	for i, id := range p.IDs {
+		if text, ok := stored[id]; ok && text == p.Documents[i] {
+			continue
+		}
+		kept.AppendFrom(p, i)
+	}
+	return kept
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// chromadbImport is the program `pvdb check` runs to prove chromadb can be
+// imported, printing its version.
+const chromadbImport = "import chromadb; print(getattr(chromadb, '__version__', 'unknown'))"
+
+// runCheck handles `pvdb check`, an onboarding diagnostic that verifies the
+// toolchain in order: the interpreter resolves, chromadb imports, the OpenAI
+// key is set and the persist dir is writable. It prints a line per check and
+// fails when any check does. It runs before the interpreter is looked up so
+// a missing one is reported like any other failure.
+func runCheck(args []string) (summary, error) {
+	fs := newFlagSet("check")
+	common := registerCommonFlags(fs)
+	common.embedderFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if err := common.resolve(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), common.timeout)
+	defer cancel()
+
+	var results []doctorCheck
+	failed := 0
+	record := func(name string, ok bool, detail string) {
+		status := "ok  "
+		if !ok {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(humanOut(), "%s %s: %s\n", status, name, detail)
+		results = append(results, doctorCheck{Name: name, OK: ok, Detail: detail})
+	}
+
+	python, source, err := resolvePython()
+	ok, detail := checkInterpreter(python, source, err)
+	record("interpreter resolves", ok, detail)
+	if ok {
+		ok, detail = checkChromadb(ctx, python, common)
+	} else {
+		detail = "skipped: no interpreter"
+	}
+	record("chromadb imports", ok, detail)
+	ok, detail = checkOpenAIKey(common)
+	record("OpenAI key present", ok, detail)
+	ok, detail = checkPersistDirWritable(common)
+	record("persist dir writable", ok, detail)
+
+	sum := summary{"checks": results}
+	if failed > 0 {
+		return sum, fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return sum, nil
+}
+
+// checkInterpreter reports the outcome of resolvePython, which picks the
+// interpreter as every other command would.
+func checkInterpreter(python, source string, err error) (bool, string) {
+	if err != nil {
+		return false, err.Error()
+	}
+	return true, fmt.Sprintf("%s (%s)", pythonCandidate{bin: python, args: pythonArgs}, source)
+}
+
+// checkChromadb imports chromadb in the environment the scripts get and
+// checks its version is in the supported range.
+func checkChromadb(ctx context.Context, python string, c *commonFlags) (bool, string) {
+	version, err := c.chromaVersion(ctx, python)
+	if err != nil {
+		return false, err.Error()
+	}
+	if err := supportedChromaVersion(version); err != nil {
+		return false, err.Error()
+	}
+	return true, "version " + version
+}
+
+// checkOpenAIKey looks for OPENAI_API_KEY where the scripts would find it. The
+// local embedder doesn't need one.
+func checkOpenAIKey(c *commonFlags) (bool, string) {
+	if c.embedder == embedderLocal {
+		return true, "not needed by the local embedder"
+	}
+	if c.embeddingEndpoint != "" {
+		return true, "not needed by -embedding-endpoint " + c.embeddingEndpoint
+	}
+	if c.getenv("OPENAI_API_KEY") == "" {
+		return false, "OPENAI_API_KEY is not set; export it, add it to the -env-file or pass -openai-config"
+	}
+	return true, "OPENAI_API_KEY is set"
+}
+
+// checkPersistDirWritable creates the persist dir if needed and writes a
+// probe file to it.
+func checkPersistDirWritable(c *commonFlags) (bool, string) {
+	if c.remoteChroma() || c.noPersist {
+		return true, "not used: the store is not on disk"
+	}
+	if err := preparePersistDir(c.persistDir, c.noRoot); err != nil {
+		return false, err.Error()
+	}
+	if err := checkWritable(c.persistDir); err != nil {
+		return false, err.Error()
+	}
+	return true, c.persistDir
+}
+
+// lastLine is the last non-empty line of s, where a Python traceback puts
+// the exception.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
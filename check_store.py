@@ -0,0 +1,30 @@
+import chromadb
+import json
+import os
+import sys
+
+from add_documents import collection_names, ephemeral, split_named_args, open_client, persist_directory, server_settings
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python check_store.py [--persist-dir=DIR]")
+
+        path = persist_directory(options)
+        if server_settings() is None and not ephemeral() and not os.path.isdir(path):
+            raise ValueError(f"persist dir {path} does not exist")
+
+        client = open_client(options)
+
+        collections = []
+        for name in collection_names(client):
+            collections.append({"name": name, "count": client.get_collection(name).count()})
+
+        print(json.dumps({"persist_dir": path, "collections": collections}))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// checkpointState is the -checkpoint file: the input it was written for and
+// how far its ingestion got. The hashes bind it to one input file and one
+// split into batches, so a changed file or different batching flags start
+// the ingestion over instead of skipping the wrong batches.
+type checkpointState struct {
+	File       string `json:"file"`
+	FileSHA256 string `json:"file_sha256"`
+	// IDsSHA256 hashes the ids of every batch in order.
+	IDsSHA256 string `json:"ids_sha256"`
+	BatchSize int    `json:"batch_size"`
+	Batches   int    `json:"batches"`
+	// LastBatch is the index of the last batch that, like every batch
+	// before it, was ingested, -1 when none was.
+	LastBatch int `json:"last_batch"`
+}
+
+// checkpoint tracks an ingestion against its -checkpoint file. The batches
+// it sees are the ones left after skip were dropped, so it shifts their
+// indices back.
+type checkpoint struct {
+	path  string
+	state checkpointState
+	skip  int
+	// done holds the batches completed after others still in flight.
+	done map[int]bool
+}
+
+// loadCheckpoint reads the checkpoint at path for the ingestion of file in
+// batches of batchSize. A missing checkpoint, or one written for another
+// file or another split into batches, means starting from the first batch.
+func loadCheckpoint(path, file string, batches []ingestPayload, batchSize int) (*checkpoint, error) {
+	fileSum, err := hashFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot hash -file for -checkpoint: %w", err)
+	}
+	ids := sha256.New()
+	for _, b := range batches {
+		for _, id := range b.IDs {
+			fmt.Fprintf(ids, "%q\n", id)
+		}
+		ids.Write([]byte("\n"))
+	}
+	c := &checkpoint{path: path, done: map[int]bool{}, state: checkpointState{
+		File:       file,
+		FileSHA256: fileSum,
+		IDsSHA256:  hex.EncodeToString(ids.Sum(nil)),
+		BatchSize:  batchSize,
+		Batches:    len(batches),
+		LastBatch:  -1,
+	}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -checkpoint: %w", err)
+	}
+	var saved checkpointState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("-checkpoint %s is not a pvdb checkpoint: %w", path, err)
+	}
+	switch {
+	case saved.FileSHA256 != c.state.FileSHA256:
+		slog.Warn("ignoring -checkpoint: the input file changed since it was written; starting from the first batch", "checkpoint", path, "file", file)
+	case saved.IDsSHA256 != c.state.IDsSHA256 || saved.BatchSize != batchSize || saved.Batches != len(batches):
+		slog.Warn("ignoring -checkpoint: the documents are split into different batches than when it was written; starting from the first batch", "checkpoint", path)
+	case saved.LastBatch < -1 || saved.LastBatch >= len(batches):
+		return nil, fmt.Errorf("-checkpoint %s records batch %d of %d", path, saved.LastBatch, len(batches))
+	default:
+		c.state.LastBatch = saved.LastBatch
+		c.skip = saved.LastBatch + 1
+	}
+	return c, nil
+}
+
+// batchDone records that batch i of the remaining batches was ingested,
+// saving the checkpoint when that extends the run of ingested batches. Calls
+// must be serialised.
+func (c *checkpoint) batchDone(i int) error {
+	c.done[c.skip+i] = true
+	last := c.state.LastBatch
+	for c.done[last+1] {
+		delete(c.done, last+1)
+		last++
+	}
+	if last == c.state.LastBatch {
+		return nil
+	}
+	c.state.LastBatch = last
+	return c.save()
+}
+
+// save writes the checkpoint to its path with writeFileAtomic, so a run
+// killed while saving leaves the previous checkpoint.
+func (c *checkpoint) save() error {
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("cannot write -checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumError reports a script whose contents don't match -script-sha256.
+type checksumError struct {
+	path      string
+	want, got string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("refusing to launch %s: SHA-256 is %s, want %s", e.path, e.got, e.want)
+}
+
+// scriptSums holds the -script-sha256 pins: by script name, or under "" for
+// every script.
+type scriptSums map[string]string
+
+// scriptSHA256Flag defines -script-sha256 on fs. Each use pins either every
+// launched script, for commands that run a single one, or with name=HEX one
+// named script.
+func (c *commonFlags) scriptSHA256Flag(fs *flag.FlagSet) {
+	fs.Func("script-sha256", "refuse to launch a script unless its SHA-256 is HEX; give name=HEX to pin one script of a command that runs several (repeatable)", func(value string) error {
+		name, sum, named := strings.Cut(value, "=")
+		if !named {
+			name, sum = "", value
+		}
+		sum = strings.ToLower(sum)
+		if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("%q is not a hex SHA-256", sum)
+		}
+		if c.scriptSums == nil {
+			c.scriptSums = scriptSums{}
+		}
+		c.scriptSums[name] = sum
+		return nil
+	})
+}
+
+// verify fails with a checksumError when the script at path is pinned and
+// its contents don't match. Unpinned scripts pass.
+func (s scriptSums) verify(path string) error {
+	want, ok := s[filepath.Base(path)]
+	if !ok {
+		if want, ok = s[""]; !ok {
+			return nil
+		}
+	}
+	got, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &checksumError{path: path, want: want, got: got}
+	}
+	return nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The chromadb releases the scripts are known to work with: from
+// minChromaVersion up to, but not including, maxChromaVersion.
+const (
+	minChromaVersion = "0.4.0"
+	maxChromaVersion = "2.0.0"
+)
+
+// strictVersion is set by -strict-version: an unsupported or undetectable
+// chromadb then stops the run instead of only being warned about.
+var strictVersion bool
+
+// strictVersionFlag defines -strict-version on fs.
+func strictVersionFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&strictVersion, "strict-version", false, "refuse to run scripts when the installed chromadb is outside the supported range "+minChromaVersion+" to "+maxChromaVersion+" or cannot be detected, instead of warning")
+}
+
+// detectedChroma caches the chromadb version for the life of the process, so
+// it is looked up once however many scripts run.
+var detectedChroma chromaDetection
+
+// chromaDetection is the outcome of the chromadb version lookup.
+type chromaDetection struct {
+	once    sync.Once
+	version string
+	err     error
+}
+
+// chromaVersion imports chromadb with python in the environment the scripts
+// get and returns the version it reports. Only the first call runs Python.
+func (c *commonFlags) chromaVersion(ctx context.Context, python string) (string, error) {
+	detectedChroma.once.Do(func() {
+		defer trace.child("chromadb version check").end()
+		result, err := c.probeScript(ctx, python, "-c", []string{chromadbImport})
+		if err != nil {
+			detectedChroma.err = fmt.Errorf("%v: %s", err, lastLine(result.Stderr))
+			return
+		}
+		detectedChroma.version = strings.TrimSpace(result.Stdout)
+	})
+	return detectedChroma.version, detectedChroma.err
+}
+
+// checkChromaVersion warns when the installed chromadb is outside the
+// supported range or its version cannot be told, and under -strict-version
+// fails instead. Dry runs launch nothing and skip the check.
+func (c *commonFlags) checkChromaVersion(ctx context.Context, python string) error {
+	if c.dryRun {
+		return nil
+	}
+	version, err := c.chromaVersion(ctx, python)
+	if err == nil {
+		err = supportedChromaVersion(version)
+	}
+	if err == nil {
+		return nil
+	}
+	if strictVersion {
+		return fmt.Errorf("%w; drop -strict-version to run anyway", err)
+	}
+	slog.Warn("chromadb may not work with these scripts", "err", err)
+	return nil
+}
+
+// supportedChromaVersion fails unless version is within the supported range.
+func supportedChromaVersion(version string) error {
+	v, ok := parseVersion(version)
+	if !ok {
+		return fmt.Errorf("cannot tell the chromadb version from %q", version)
+	}
+	lo, _ := parseVersion(minChromaVersion)
+	hi, _ := parseVersion(maxChromaVersion)
+	if compareVersions(v, lo) < 0 || compareVersions(v, hi) >= 0 {
+		return fmt.Errorf("chromadb %s is not supported; want %s or later, before %s", version, minChromaVersion, maxChromaVersion)
+	}
+	return nil
+}
+
+// parseVersion reads the major, minor and patch numbers at the start of a
+// version like 0.4.24 or 0.5.0rc1; missing parts are zero.
+func parseVersion(version string) ([3]int, bool) {
+	var v [3]int
+	parts := strings.SplitN(version, ".", 3)
+	for i, part := range parts {
+		if end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+			part = part[:end]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// compareVersions orders a and b like strings.Compare.
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
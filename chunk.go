@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+)
+
+// chunkIndexKey is the metadata key recording a chunk's position in its
+// parent document.
+const chunkIndexKey = "chunk_index"
+
+// chunkPayload splits every document of p into chunks of at most size
+// characters, consecutive chunks sharing overlap characters. Chunk i of the
+// document id gets the id "id#i" and a copy of the parent's metadata plus
+// chunk_index. Chunks are cut between runes, never inside a multi-byte
+// character.
+func chunkPayload(p ingestPayload, size, overlap int) ingestPayload {
+	var chunked ingestPayload
+	for i, doc := range p.Documents {
+		for j, chunk := range chunkText(doc, size, overlap) {
+			meta := maps.Clone(p.Metadatas[i])
+			if meta == nil {
+				meta = make(map[string]any, 1)
+			}
+			meta[chunkIndexKey] = j
+			chunked.Documents = append(chunked.Documents, chunk)
+			chunked.Metadatas = append(chunked.Metadatas, meta)
+			chunked.IDs = append(chunked.IDs, fmt.Sprintf("%s#%d", p.IDs[i], j))
+		}
+	}
+	return chunked
+}
+
+// chunkText cuts text into windows of size runes that advance by
+// size-overlap. An empty text is a single empty chunk.
+func chunkText(text string, size, overlap int) []string {
+	runes := []rune(text)
+	if len(runes) <= size {
+		return []string{text}
+	}
+	var chunks []string
+	for start := 0; ; start += size - overlap {
+		end := min(start+size, len(runes))
+		chunks = append(chunks, string(runes[start:end]))
+		if end == len(runes) {
+			return chunks
+		}
+	}
+}
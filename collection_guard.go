@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Collection guards an ingestion can run before writing.
+const (
+	collectionGetOrCreate = ""
+	collectionRequire     = "require"
+	collectionCreate      = "create"
+)
+
+// collectionState is what ensure_collection.py reports.
+type collectionState struct {
+	Exists  bool `json:"exists"`
+	Created bool `json:"created"`
+}
+
+// guardCollection runs ensure_collection.py in mode before an ingestion:
+// require fails unless the collection already exists, guarding against a
+// typo creating a stray one, and create makes it up front, failing if it
+// already exists. Under -dry-run the command is only printed.
+func (c *commonFlags) guardCollection(ctx context.Context, python, mode string) (collectionState, error) {
+	var state collectionState
+	result, ran, err := c.runScript(ctx, python, "ensure_collection.py", []string{"--mode=" + mode})
+	if err != nil || !ran {
+		return state, err
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &state); err != nil {
+		return state, fmt.Errorf("ensure_collection.py returned invalid JSON: %w", err)
+	}
+	switch {
+	case mode == collectionRequire && !state.Exists:
+		return state, fmt.Errorf("collection '%s' does not exist; create it first or drop -require-existing-collection", c.collection)
+	case mode == collectionCreate && state.Exists:
+		return state, fmt.Errorf("collection '%s' already exists; drop -create-collection to add to it", c.collection)
+	}
+	if state.Created {
+		c.recordEmbeddingConfig()
+		fmt.Fprintf(statusOut(), "created collection '%s'\n", c.collection)
+	}
+	return state, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// collectionMetadataFlag defines -collection-metadata on fs for the
+// subcommands whose scripts may create the collection. The value must be a
+// JSON object; keys outside Chroma's hnsw: namespace are let through with a
+// warning, since a typo there silently does nothing.
+func (c *commonFlags) collectionMetadataFlag(fs *flag.FlagSet) {
+	fs.Func("collection-metadata", `JSON object of metadata for a newly created collection, e.g. {"hnsw:space":"cosine"}`, func(value string) error {
+		var meta map[string]any
+		if err := json.Unmarshal([]byte(value), &meta); err != nil || meta == nil {
+			return fmt.Errorf("must be a JSON object like {\"hnsw:space\":\"cosine\"}")
+		}
+		keys := make([]string, 0, len(meta))
+		for key := range meta {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if !strings.HasPrefix(key, "hnsw:") {
+				slog.Warn("collection metadata key is not an hnsw: setting", "key", key)
+			}
+		}
+		c.collectionMetadata = value
+		return nil
+	})
+}
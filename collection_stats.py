@@ -0,0 +1,62 @@
+import chromadb
+import json
+import sys
+
+from add_documents import split_named_args, open_client
+
+# Documents are read in pages of this size so large collections aren't
+# loaded all at once
+PAGE_SIZE = 1000
+
+def collection_stats(collection):
+    count = collection.count()
+    stats = {
+        "name": collection.name,
+        "count": count,
+        "dimensions": 0,
+        # The space the distances are measured in, l2 unless the collection
+        # was created with another
+        "distance_metric": (collection.metadata or {}).get("hnsw:space", "l2"),
+        "average_document_length": 0,
+        "metadata_keys": {},
+    }
+    if count == 0:
+        return stats
+
+    first = collection.get(limit=1, include=["embeddings"])
+    if first["embeddings"] is not None and len(first["embeddings"]) > 0:
+        stats["dimensions"] = len(first["embeddings"][0])
+
+    total_length = 0
+    keys = {}
+    for offset in range(0, count, PAGE_SIZE):
+        page = collection.get(limit=PAGE_SIZE, offset=offset, include=["documents", "metadatas"])
+        for document in page["documents"]:
+            total_length += len(document or "")
+        for metadata in page["metadatas"]:
+            for key in metadata or {}:
+                keys[key] = keys.get(key, 0) + 1
+    stats["average_document_length"] = total_length / count
+    stats["metadata_keys"] = keys
+    return stats
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python collection_stats.py [--collection=NAME]")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Stats are only read, so a missing collection is an error rather
+        # than created
+        collection = client.get_collection(options.get("collection", "documents"))
+
+        print(json.dumps(collection_stats(collection)))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
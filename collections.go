@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// collectionInfo is a collection and its document count as the scripts
+// report them.
+type collectionInfo struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// runCollections handles `pvdb collections`, listing every collection in the
+// store with its document count, sorted by name.
+func runCollections(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("collections")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	collections, ran, err := common.listCollections(ctx, python)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+	slices.SortFunc(collections, func(a, b collectionInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	if jsonOutput {
+		return summary{"collections": collections}, nil
+	}
+	if len(collections) == 0 {
+		fmt.Fprintln(humanOut(), "no collections found")
+		return nil, nil
+	}
+	tw := tabwriter.NewWriter(humanOut(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDOCUMENTS")
+	for _, c := range collections {
+		fmt.Fprintf(tw, "%s\t%d\n", c.Name, c.Count)
+	}
+	tw.Flush()
+	return nil, nil
+}
+
+// listCollections runs list_collections.py, returning every collection in
+// the store with its document count.
+func (c *commonFlags) listCollections(ctx context.Context, python string) ([]collectionInfo, bool, error) {
+	result, ran, err := c.runScript(ctx, python, "list_collections.py", nil)
+	if err != nil || !ran {
+		return nil, ran, err
+	}
+	var collections []collectionInfo
+	if err := json.Unmarshal([]byte(result.Stdout), &collections); err != nil {
+		return nil, true, fmt.Errorf("list_collections.py returned invalid JSON: %w", err)
+	}
+	return collections, true, nil
+}
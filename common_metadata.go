@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"time"
+)
+
+// ingestedAtKey is the metadata key -timestamp fills in.
+const ingestedAtKey = "ingested_at"
+
+// commonMetadata is metadata shared by every document of an ingestion run,
+// from -common-metadata and -timestamp.
+type commonMetadata struct {
+	values    map[string]any
+	timestamp bool
+}
+
+// register defines -common-metadata and -timestamp on fs.
+func (m *commonMetadata) register(fs *flag.FlagSet) {
+	fs.Func("common-metadata", `JSON object merged into every document's metadata, e.g. {"source":"wiki"}; per-document keys win`, func(value string) error {
+		var values map[string]any
+		if err := json.Unmarshal([]byte(value), &values); err != nil || values == nil {
+			return fmt.Errorf("must be a JSON object like {\"source\":\"wiki\"}")
+		}
+		m.values = values
+		return nil
+	})
+	fs.BoolVar(&m.timestamp, "timestamp", false, "add an "+ingestedAtKey+" RFC3339 timestamp to every document's metadata")
+}
+
+// apply merges the common metadata into each document's metadata in p,
+// keeping the document's own value when a key is set in both. The
+// -timestamp value, taken from now, replaces an ingested_at given in
+// -common-metadata.
+func (m *commonMetadata) apply(p *ingestPayload, now time.Time) {
+	common := maps.Clone(m.values)
+	if m.timestamp {
+		if common == nil {
+			common = make(map[string]any, 1)
+		}
+		common[ingestedAtKey] = now.UTC().Format(time.RFC3339)
+	}
+	if len(common) == 0 {
+		return
+	}
+	for i, meta := range p.Metadatas {
+		merged := maps.Clone(common)
+		maps.Copy(merged, meta)
+		p.Metadatas[i] = merged
+	}
+}
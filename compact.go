@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// runCompact handles `pvdb compact`, which has compact_store.py VACUUM the
+// store's SQLite database and reports the persist dir's size before and
+// after. With -expect-shrink it fails unless the size went down.
+func runCompact(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("compact")
+	expectShrink := fs.Bool("expect-shrink", false, "exit non-zero unless compaction made the persist dir smaller")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	// Like the doctor, compaction must not create the store it works on
+	if err := common.resolve(); err != nil {
+		return nil, err
+	}
+	if common.remoteChroma() || common.noPersist {
+		return nil, invalidArgs(errors.New("compact works on the on-disk store; it cannot be used with -chroma-url, CHROMA_HOST or -no-persist"))
+	}
+	dir := common.persistDir
+	if err := checkDir(dir); err != nil {
+		return nil, invalidArgsf("cannot compact persist dir: %w", err)
+	}
+	if !common.dryRun {
+		if err := lockPersistDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	before, err := dirSize(dir)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(cli.stderr, "WARNING: don't write to the store while it is being compacted")
+	_, ran, err := common.runScript(ctx, python, "compact_store.py", nil)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+	after, err := dirSize(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(humanOut(), "compacted %s: %d bytes before, %d after (%d freed)\n", dir, before, after, before-after)
+	sum := summary{"persist_dir": dir, "bytes_before": before, "bytes_after": after}
+	if *expectShrink && after >= before {
+		return sum, fmt.Errorf("-expect-shrink: persist dir did not shrink (%d bytes before, %d after)", before, after)
+	}
+	return sum, nil
+}
+
+// dirSize is the total size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("measuring persist dir: %w", err)
+	}
+	return total, nil
+}
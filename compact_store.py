@@ -0,0 +1,36 @@
+import json
+import os
+import sqlite3
+import sys
+
+from add_documents import split_named_args, persist_directory
+
+# The SQLite file an embedded Chroma store keeps its collections in
+DATABASE = "chroma.sqlite3"
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python compact_store.py [--persist-dir=DIR]")
+
+        path = os.path.join(persist_directory(options), DATABASE)
+        if not os.path.isfile(path):
+            raise ValueError(f"{path} does not exist; nothing to compact")
+
+        # VACUUM rewrites the database without the pages freed by deletes
+        # and updates. It needs the database to itself, so it fails rather
+        # than waits if a writer holds it
+        connection = sqlite3.connect(path, timeout=0)
+        try:
+            connection.execute("VACUUM")
+        finally:
+            connection.close()
+
+        print(json.dumps({"database": path}))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
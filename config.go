@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultConfigFile is read from the working directory when present;
+// -config names a file that must exist.
+const defaultConfigFile = "pvdb.json"
+
+// Config holds defaults for the common flags. Values come from the built-in
+// defaults, overlaid by the config file; flags given on the command line
+// override both because they are registered with these values as defaults.
+type Config struct {
+	PersistDir string   `json:"persist_dir"`
+	Collection string   `json:"collection"`
+	PythonBin  string   `json:"python_bin"`
+	Embedder   string   `json:"embedder"`
+	Timeout    duration `json:"timeout"`
+}
+
+// duration is a time.Duration written as a string such as "90s" in JSON.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("timeout must be a duration string such as \"90s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// defaults is the configuration the flags are registered with. main replaces
+// it with the loaded config file before dispatching.
+var defaults = builtinConfig()
+
+// builtinConfig returns the defaults used when no config file sets a value.
+func builtinConfig() Config {
+	return Config{
+		PersistDir: defaultPersistDir,
+		Collection: defaultCollection,
+		PythonBin:  "python3",
+		Embedder:   embedderOpenAI,
+		Timeout:    duration(defaultTimeout),
+	}
+}
+
+// loadConfig overlays the JSON config file at path on the built-in defaults.
+// A missing default file is ignored; an explicitly named one must exist.
+func loadConfig(path string) (Config, error) {
+	cfg := builtinConfig()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && path == defaultConfigFile {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, invalidArgsf("loading -config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, invalidArgsf("loading -config %s: %w", path, err)
+	}
+	if !slices.Contains(embedders, cfg.Embedder) {
+		return cfg, invalidArgsf("loading -config %s: unknown embedder %q, want %s", path, cfg.Embedder, strings.Join(embedders, " or "))
+	}
+	if cfg.Timeout <= 0 {
+		return cfg, invalidArgsf("loading -config %s: timeout must be positive", path)
+	}
+	return cfg, nil
+}
+
+// configFlag defines -config on fs. The file is loaded by main before the
+// subcommand's flags are defined, so the flag only documents the option and
+// keeps it from being rejected.
+func configFlag(fs *flag.FlagSet) {
+	fs.String("config", defaultConfigFile, "JSON file with defaults for -persist-dir, -collection, -embedder, -timeout and the Python interpreter")
+}
+
+// configArg returns the -config value in args, for loading the config before
+// a subcommand has parsed its flags.
+func configArg(args []string) string {
+	if value, ok := flagArg(args, "config"); ok {
+		return value
+	}
+	return defaultConfigFile
+}
+
+// flagArg returns the value args, up to a --, give the string flag name, and
+// whether they give it at all.
+func flagArg(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || flagName != name {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
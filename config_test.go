@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withConfig loads the JSON config text, or the built-in defaults when it is
+// empty, as main does before dispatching, and restores the defaults when the
+// test ends.
+func withConfig(t *testing.T, text string) {
+	t.Helper()
+	saved := defaults
+	t.Cleanup(func() { defaults = saved })
+	if text == "" {
+		defaults = builtinConfig()
+		return
+	}
+	path := filepath.Join(t.TempDir(), "pvdb.json")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults = cfg
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	const file = `{"persist_dir": "file-db", "collection": "file-docs", "embedder": "local", "timeout": "90s"}`
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+
+		persistDir, collection, embedder string
+		timeout                          time.Duration
+	}{
+		{
+			name:       "built-in defaults",
+			persistDir: defaultPersistDir, collection: defaultCollection, embedder: embedderOpenAI, timeout: defaultTimeout,
+		},
+		{
+			name:       "config file over built-in defaults",
+			config:     file,
+			persistDir: "file-db", collection: "file-docs", embedder: embedderLocal, timeout: 90 * time.Second,
+		},
+		{
+			name:       "config file sets some fields",
+			config:     `{"collection": "file-docs"}`,
+			persistDir: defaultPersistDir, collection: "file-docs", embedder: embedderOpenAI, timeout: defaultTimeout,
+		},
+		{
+			name:       "flags over config file",
+			config:     file,
+			args:       []string{"-persist-dir", "flag-db", "-collection", "flag-docs", "-embedder", "openai", "-timeout", "5s"},
+			persistDir: "flag-db", collection: "flag-docs", embedder: embedderOpenAI, timeout: 5 * time.Second,
+		},
+		{
+			name:       "flags over built-in defaults",
+			args:       []string{"-collection", "flag-docs", "-timeout", "5s"},
+			persistDir: defaultPersistDir, collection: "flag-docs", embedder: embedderOpenAI, timeout: 5 * time.Second,
+		},
+		{
+			name:       "one flag over the config file",
+			config:     file,
+			args:       []string{"-collection", "flag-docs"},
+			persistDir: "file-db", collection: "flag-docs", embedder: embedderLocal, timeout: 90 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, tt.config)
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			common := registerCommonFlags(fs)
+			common.embedderFlag(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if common.persistDir != tt.persistDir || common.collection != tt.collection || common.embedder != tt.embedder || common.timeout != tt.timeout {
+				t.Errorf("got persist dir %q, collection %q, embedder %q, timeout %s; want %q, %q, %q, %s",
+					common.persistDir, common.collection, common.embedder, common.timeout,
+					tt.persistDir, tt.collection, tt.embedder, tt.timeout)
+			}
+		})
+	}
+}
+
+func TestConfigPythonBinPrecedence(t *testing.T) {
+	tests := []struct {
+		name, config, env string
+		python, source    string
+	}{
+		{name: "config file", config: `{"python_bin": "sh"}`, python: "sh", source: "config python_bin"},
+		{name: "PYTHON_BIN over config file", config: `{"python_bin": "sh"}`, env: "true", python: "true", source: "PYTHON_BIN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, tt.config)
+			t.Setenv("PYTHON_BIN", tt.env)
+			python, source, err := resolvePython()
+			if err != nil {
+				t.Skip(err)
+			}
+			if python != tt.python || source != tt.source {
+				t.Errorf("resolvePython() = %q from %s, want %q from %s", python, source, tt.python, tt.source)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name, text string
+		wantErr    bool
+	}{
+		{name: "valid", text: `{"collection": "recipes", "timeout": "2m"}`},
+		{name: "unknown field", text: `{"colection": "recipes"}`, wantErr: true},
+		{name: "unknown embedder", text: `{"embedder": "word2vec"}`, wantErr: true},
+		{name: "numeric timeout", text: `{"timeout": 90}`, wantErr: true},
+		{name: "non-positive timeout", text: `{"timeout": "0s"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pvdb.json")
+			if err := os.WriteFile(path, []byte(tt.text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig: %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && exitCode(err) != exitInvalidArgs {
+				t.Errorf("loadConfig error %v exits with %d, want %d", err, exitCode(err), exitInvalidArgs)
+			}
+		})
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("loading a missing -config: %v, want it to fail as not existing", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policies for documents containing control characters.
+const (
+	controlCharStrip  = "strip"
+	controlCharReject = "reject"
+)
+
+var controlCharPolicies = []string{controlCharStrip, controlCharReject}
+
+// isUnwantedControl reports whether r is a control character other than the
+// tab and newline that ordinary text contains.
+func isUnwantedControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\t' && r != '\n'
+}
+
+// rejectControlChars fails on the first document in p holding a control
+// character other than tab or newline, such as a null byte.
+func rejectControlChars(p ingestPayload) error {
+	for i, doc := range p.Documents {
+		if at := strings.IndexFunc(doc, isUnwantedControl); at >= 0 {
+			r, _ := utf8.DecodeRuneInString(doc[at:])
+			return fmt.Errorf("document %q contains control character %U at byte %d; pass -on-control-char strip to remove such characters", p.IDs[i], r, at)
+		}
+	}
+	return nil
+}
+
+// stripControlChars removes control characters other than tab and newline
+// from the documents of p, logging how many went from each id. It returns
+// the total removed.
+func stripControlChars(p *ingestPayload) int {
+	total := 0
+	for i, doc := range p.Documents {
+		removed := 0
+		cleaned := strings.Map(func(r rune) rune {
+			if isUnwantedControl(r) {
+				removed++
+				return -1
+			}
+			return r
+		}, doc)
+		if removed > 0 {
+			slog.Info("stripped control characters from document", "id", p.IDs[i], "removed", removed)
+			p.Documents[i] = cleaned
+			total += removed
+		}
+	}
+	return total
+}
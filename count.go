@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// runCount handles `pvdb count -collection documents`.
+func runCount(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("count")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	result, ran, err := common.runScript(ctx, python, "count_documents.py", nil)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+
+	n, err := parseCount("count_documents.py", result.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(humanOut(), "collection '%s' contains %d documents\n", common.collection, n)
+	return summary{"collection": common.collection, "count": n}, nil
+}
+
+// parseCount reads the single integer a script printed on stdout, ignoring
+// surrounding whitespace.
+func parseCount(script, stdout string) (int, error) {
+	defer trace.child("parse " + script + " output").end()
+	n, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		return 0, fmt.Errorf("%s printed %q, not a document count", script, stdout)
+	}
+	return n, nil
+}
@@ -0,0 +1,26 @@
+import chromadb
+import sys
+
+from add_documents import get_existing_collection, split_named_args, open_client
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python count_documents.py [--collection=NAME]")
+
+        collection_name = options.get("collection", "documents")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Get the Chroma collection, which a read never creates
+        collection = get_existing_collection(client, collection_name)
+
+        print(collection.count())
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
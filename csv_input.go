@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats -file may be read as.
+const (
+	inputJSONL = "jsonl"
+	inputCSV   = "csv"
+)
+
+var inputFormats = []string{inputJSONL, inputCSV}
+
+// csvInput says how the columns of a CSV ingestion file map to documents.
+type csvInput struct {
+	format         string
+	documentColumn string
+	idColumn       string
+	delimiter      rune
+}
+
+// register adds -input-format, -document-column, -id-column and -delimiter
+// to fs.
+func (c *csvInput) register(fs *flag.FlagSet) {
+	c.format, c.delimiter = inputJSONL, ','
+	fs.Func("input-format", "format of -file: jsonl or csv (default jsonl)", func(value string) error {
+		if !slices.Contains(inputFormats, value) {
+			return fmt.Errorf("unknown format %q, want %s", value, strings.Join(inputFormats, ", "))
+		}
+		c.format = value
+		return nil
+	})
+	fs.StringVar(&c.documentColumn, "document-column", "document", "with -input-format csv, the header of the column holding the document text; the other columns become metadata")
+	fs.StringVar(&c.idColumn, "id-column", "", "with -input-format csv, the header of the column holding the ids (default: the row index)")
+	fs.Func("delimiter", `with -input-format csv, the character separating fields, or \t for tab (default ",")`, func(value string) error {
+		if value == `\t` {
+			value = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(value)
+		if size == 0 || size != len(value) || r == utf8.RuneError {
+			return fmt.Errorf("want a single character, got %q", value)
+		}
+		c.delimiter = r
+		return nil
+	})
+}
+
+// load reads the CSV file at path, whose first row names the columns, into
+// the parallel arrays add_documents.py expects. Every column but the document
+// and id ones becomes a string metadata field. Rows without an id column are
+// given their 0-based row index as id.
+func (c *csvInput) load(path string) (ingestPayload, error) {
+	var p ingestPayload
+	f, err := openInput(path)
+	if err != nil {
+		return p, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = c.delimiter
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return p, fmt.Errorf("%s is empty; expected a header row", path)
+	}
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+	docCol, idCol := -1, -1
+	for i, name := range header {
+		if slices.Index(header, name) != i {
+			return p, fmt.Errorf("%s: column %q appears more than once in the header", path, name)
+		}
+		switch {
+		case name == c.documentColumn:
+			docCol = i
+		case c.idColumn != "" && name == c.idColumn:
+			idCol = i
+		}
+	}
+	if docCol < 0 {
+		return p, fmt.Errorf("%s has no document column %q (columns: %s); set -document-column", path, c.documentColumn, strings.Join(header, ", "))
+	}
+	if c.idColumn != "" && idCol < 0 {
+		return p, fmt.Errorf("%s has no id column %q (columns: %s)", path, c.idColumn, strings.Join(header, ", "))
+	}
+
+	for row := 0; ; row++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", path, err)
+		}
+		meta := make(map[string]any, len(record))
+		id := strconv.Itoa(row)
+		for i, value := range record {
+			switch i {
+			case docCol:
+				p.Documents = append(p.Documents, value)
+			case idCol:
+				id = value
+			default:
+				meta[header[i]] = value
+			}
+		}
+		if len(meta) == 0 {
+			meta = nil
+		}
+		p.Metadatas = append(p.Metadatas, meta)
+		p.IDs = append(p.IDs, id)
+	}
+	return p, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// runDelete handles `pvdb delete -ids '["id1","id2"]'`. Ids that are not in
+// the collection are reported by delete_documents.py as warnings on stderr.
+func runDelete(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("delete")
+	ids := fs.String("ids", "", "JSON array of document ids to delete")
+	idPrefix := idPrefixFlag(fs, "string prepended to every id, as the add or update -id-prefix that stored them")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *ids == "" {
+		return nil, invalidArgs(errors.New("missing required flag -ids"))
+	}
+	idList, err := decodeIDs("ids", *ids)
+	if err != nil {
+		return nil, err
+	}
+	prefixIDs(idList, *idPrefix)
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(idList)
+	if err != nil {
+		return nil, err
+	}
+	result, ran, err := common.runScript(ctx, python, "delete_documents.py", []string{string(encoded)})
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+
+	n, err := parseCount("delete_documents.py", result.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	audit.Documents = n
+	fmt.Fprintf(humanOut(), "deleted %d of %d documents from collection '%s'\n", n, len(idList), common.collection)
+	return summary{"collection": common.collection, "deleted": n}, nil
+}
+
+// decodeIDs parses the value of the named flag as a non-empty JSON array of
+// unique ids.
+func decodeIDs(name, value string) ([]string, error) {
+	var ids []string
+	if err := json.Unmarshal([]byte(value), &ids); err != nil {
+		return nil, invalidArgsf("-%s must be a JSON array of strings: %w", name, err)
+	}
+	if len(ids) == 0 {
+		return nil, invalidArgsf("-%s must contain at least one id", name)
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return nil, invalidArgsf("duplicate id %q in -%s", id, name)
+		}
+		seen[id] = true
+	}
+	return ids, nil
+}
@@ -0,0 +1,39 @@
+import chromadb
+import json
+import sys
+
+from add_documents import create_or_get_collection, split_named_args, open_client
+
+def delete_from_collection(collection, ids):
+    # Only delete ids that exist, warning about the rest
+    existing = set(collection.get(ids=ids, include=[])["ids"])
+    for missing in ids:
+        if missing not in existing:
+            print(f"WARNING: document {missing} does not exist", file=sys.stderr)
+    if existing:
+        collection.delete(ids=list(existing))
+    return len(existing)
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+
+        # Check if the ids argument is provided
+        if len(args) != 1:
+            raise ValueError("Usage: python delete_documents.py <ids> [--collection=NAME]")
+
+        ids = json.loads(args[0])
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Create or get the Chroma collection
+        collection = create_or_get_collection(client, options.get("collection", "documents"))
+
+        print(delete_from_collection(collection, ids))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
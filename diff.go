@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// runDiff handles `pvdb diff -a coll1 -b coll2`, comparing the ids stored in
+// two collections. It fails when they differ, so it can gate a migration.
+func runDiff(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("diff")
+	a := fs.String("a", "", "first collection")
+	b := fs.String("b", "", "second collection")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *a == "" || *b == "" {
+		return nil, invalidArgs(errors.New("usage: pvdb diff -a COLLECTION -b COLLECTION"))
+	}
+	for _, name := range []string{*a, *b} {
+		if err := validateCollectionName(name); err != nil {
+			return nil, err
+		}
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	idsA, ran, err := common.collectionIDs(ctx, python, *a)
+	if err != nil {
+		return nil, err
+	}
+	idsB, _, err := common.collectionIDs(ctx, python, *b)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+
+	onlyA, onlyB := symmetricDifference(idsA, idsB)
+	w := humanOut()
+	for _, id := range onlyA {
+		fmt.Fprintf(w, "only in %s: %s\n", *a, id)
+	}
+	for _, id := range onlyB {
+		fmt.Fprintf(w, "only in %s: %s\n", *b, id)
+	}
+	fmt.Fprintf(w, "%s has %d ids, %s has %d; %d only in %s, %d only in %s\n",
+		*a, len(idsA), *b, len(idsB), len(onlyA), *a, len(onlyB), *b)
+
+	sum := summary{"a": *a, "b": *b, "only_in_a": onlyA, "only_in_b": onlyB}
+	if len(onlyA) > 0 || len(onlyB) > 0 {
+		return sum, fmt.Errorf("collections '%s' and '%s' differ", *a, *b)
+	}
+	return sum, nil
+}
+
+// collectionIDs lists every id in the named collection via ids_only.py.
+func (c *commonFlags) collectionIDs(ctx context.Context, python, name string) (ids []string, ran bool, err error) {
+	shard := *c
+	shard.collection = name
+	result, ran, err := shard.runScript(ctx, python, "ids_only.py", nil)
+	if err != nil || !ran {
+		return nil, ran, err
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &ids); err != nil {
+		return nil, true, fmt.Errorf("ids_only.py returned invalid JSON: %w", err)
+	}
+	return ids, true, nil
+}
+
+// symmetricDifference returns, sorted, the ids only in a and those only in b.
+func symmetricDifference(a, b []string) (onlyA, onlyB []string) {
+	onlyA, onlyB = []string{}, []string{}
+	inA := make(map[string]bool, len(a))
+	for _, id := range a {
+		inA[id] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, id := range b {
+		inB[id] = true
+		if !inA[id] {
+			onlyB = append(onlyB, id)
+		}
+	}
+	for _, id := range a {
+		if !inB[id] {
+			onlyA = append(onlyA, id)
+		}
+	}
+	slices.Sort(onlyA)
+	slices.Sort(onlyB)
+	return slices.Compact(onlyA), slices.Compact(onlyB)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// jsonlFiles lists the .jsonl and .jsonl.gz files directly inside dir,
+// sorted by name, failing when there are none.
+func jsonlFiles(dir string) ([]string, error) {
+	files, err := listJSONLFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s holds no .jsonl or .jsonl.gz files", dir)
+	}
+	return files, nil
+}
+
+// listJSONLFiles lists the .jsonl and .jsonl.gz files directly inside dir,
+// sorted by name. Anything else is skipped with a debug log line.
+func listJSONLFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -dir: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".jsonl.gz")) {
+			slog.Debug("skipping file that is not .jsonl or .jsonl.gz", "file", filepath.Join(dir, name))
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files, nil
+}
+
+// fileOutcome is how the ingestion of one -dir file went.
+type fileOutcome struct {
+	File      string `json:"file"`
+	Documents int    `json:"documents"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ingestFiles runs ingest on each of files, up to workers at once, after
+// checking the collection once with guard. With failFast no file is started
+// after one fails; otherwise every file is attempted. The documents each
+// file stored are read from its summary's countKey.
+func ingestFiles(ctx context.Context, python string, common *commonFlags, files []string, workers int, failFast bool, countKey, guard string, ingest func(path string) (summary, error)) (summary, error) {
+	sum := summary{}
+	if guard != collectionGetOrCreate {
+		state, err := common.guardCollection(ctx, python, guard)
+		if err != nil {
+			return nil, err
+		}
+		sum["collection_created"] = state.Created
+	}
+	// Wait for the server here so the files don't each race to check it
+	if err := common.ensureReady(ctx, python); err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]fileOutcome, len(files))
+	attempted := make([]bool, len(files))
+	var (
+		mu     sync.Mutex
+		failed bool
+		wg     sync.WaitGroup
+	)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range files {
+			mu.Lock()
+			stop := failFast && failed
+			mu.Unlock()
+			if stop || ctx.Err() != nil {
+				return
+			}
+			next <- i
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fileSum, err := ingest(files[i])
+				n, _ := fileSum[countKey].(int)
+				mu.Lock()
+				attempted[i] = true
+				outcomes[i] = fileOutcome{File: files[i], Documents: n}
+				if err != nil {
+					outcomes[i].Error = err.Error()
+					failed = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if common.dryRun {
+		return dryRunSummary(false), nil
+	}
+
+	total, failures := 0, 0
+	var reported []fileOutcome
+	for i, o := range outcomes {
+		if !attempted[i] {
+			continue
+		}
+		status := "ok  "
+		detail := fmt.Sprintf("%d documents", o.Documents)
+		if o.Error != "" {
+			status, detail = "FAIL", o.Error
+			failures++
+		}
+		fmt.Fprintf(statusOut(), "%s %s: %s\n", status, o.File, detail)
+		total += o.Documents
+		reported = append(reported, o)
+	}
+	skipped := len(files) - len(reported)
+	fmt.Fprintf(statusOut(), "ingested %d documents from %d files: %d failed, %d not attempted\n", total, len(files), failures, skipped)
+	audit.Documents = total
+	sum["files"] = reported
+	sum[countKey] = total
+	if failures > 0 {
+		return sum, fmt.Errorf("%d of %d files failed", failures, len(files))
+	}
+	return sum, ctx.Err()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// chromaDatabase is the SQLite file an embedded Chroma store keeps its
+// collections in.
+const chromaDatabase = "chroma.sqlite3"
+
+// sqliteHeader starts every valid SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// storeReport is what check_store.py prints about the store.
+type storeReport struct {
+	PersistDir  string           `json:"persist_dir"`
+	Collections []collectionInfo `json:"collections"`
+}
+
+// doctorCheck is the outcome of one doctor check.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// runDoctor handles `pvdb doctor`, which checks the persist dir from Go, asks
+// check_store.py what the store holds and cross-checks the two. It fails when
+// any check does, so it can gate CI.
+func runDoctor(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("doctor")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	// The doctor must not create the directory it is inspecting, so the
+	// store is only resolved, not prepared.
+	if err := common.resolve(); err != nil {
+		return nil, err
+	}
+
+	var checks []doctorCheck
+	check := func(name string, err error, detail string) bool {
+		c := doctorCheck{Name: name, OK: err == nil, Detail: detail}
+		if err != nil {
+			c.Detail = err.Error()
+		}
+		checks = append(checks, c)
+		return c.OK
+	}
+
+	embedded := !common.remoteChroma() && !common.noPersist
+	dbPresent := false
+	if embedded {
+		dir := common.persistDir
+		if check("persist dir exists", checkDir(dir), dir) &&
+			check("persist dir readable", checkReadable(dir), dir) {
+			db := filepath.Join(dir, chromaDatabase)
+			err := checkSQLite(db)
+			dbPresent = !errors.Is(err, os.ErrNotExist)
+			if dbPresent {
+				check("database is SQLite", err, db)
+			}
+		}
+	}
+
+	result, ran, err := common.runScript(ctx, python, "check_store.py", nil)
+	if !ran && err == nil {
+		return dryRunSummary(ran), nil
+	}
+	var report storeReport
+	if err == nil {
+		if err = json.Unmarshal([]byte(result.Stdout), &report); err != nil {
+			err = fmt.Errorf("check_store.py printed invalid JSON: %w", err)
+		}
+	}
+	documents := 0
+	for _, c := range report.Collections {
+		documents += c.Count
+	}
+	if check("store opens", err, fmt.Sprintf("%d collections, %d documents", len(report.Collections), documents)) && embedded {
+		check("reported dir matches", samePath(report.PersistDir, common.persistDir), report.PersistDir)
+		if len(report.Collections) > 0 {
+			var err error
+			if !dbPresent {
+				err = fmt.Errorf("script reports %d collections but %s is missing", len(report.Collections), chromaDatabase)
+			}
+			check("collections are on disk", err, chromaDatabase)
+		}
+	}
+
+	failed := 0
+	for _, c := range checks {
+		status := "ok  "
+		if !c.OK {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(humanOut(), "%s %s: %s\n", status, c.Name, c.Detail)
+	}
+	for _, c := range report.Collections {
+		fmt.Fprintf(humanOut(), "collection '%s' contains %d documents\n", c.Name, c.Count)
+	}
+
+	sum := summary{"checks": checks, "collections": report.Collections, "documents": documents}
+	if failed > 0 {
+		return sum, fmt.Errorf("%d of %d doctor checks failed", failed, len(checks))
+	}
+	return sum, nil
+}
+
+// checkDir fails unless path is an existing directory.
+func checkDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+// checkReadable fails unless the directory's entries can be listed.
+func checkReadable(dir string) error {
+	_, err := os.ReadDir(dir)
+	return err
+}
+
+// checkSQLite fails unless path starts with the SQLite file header; a
+// missing file is reported as os.ErrNotExist.
+func checkSQLite(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, sqliteHeader) {
+		return fmt.Errorf("%s is not a SQLite database", path)
+	}
+	return nil
+}
+
+// samePath fails unless a and b name the same directory.
+func samePath(a, b string) error {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return err
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(ai, bi) {
+		return fmt.Errorf("script inspected %s, expected %s", a, b)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Embedding backends the scripts know how to build.
+const (
+	embedderOpenAI = "openai"
+	embedderLocal  = "local"
+)
+
+var embedders = []string{embedderOpenAI, embedderLocal}
+
+// defaultEmbeddingModel is the OpenAI model used without -embedding-model;
+// localEmbeddingModel is the one the local embedder always uses.
+const (
+	defaultEmbeddingModel = "text-embedding-3-small"
+	localEmbeddingModel   = "all-MiniLM-L6-v2"
+)
+
+// embedderFlag defines -embedder, -embedding-model, -dimensions,
+// -embedding-endpoint and -embedding-api-key on fs for the subcommands whose
+// scripts embed text. Unknown embedders and empty model
+// names are rejected while parsing, before any script is launched.
+func (c *commonFlags) embedderFlag(fs *flag.FlagSet) {
+	c.embedder = defaults.Embedder
+	fs.Func("embedder", "embedding backend: "+strings.Join(embedders, " or ")+" (default "+defaults.Embedder+")", func(value string) error {
+		if !slices.Contains(embedders, value) {
+			return fmt.Errorf("unknown embedder %q, want %s", value, strings.Join(embedders, " or "))
+		}
+		c.embedder = value
+		return nil
+	})
+	c.embeddingModel = defaultEmbeddingModel
+	fs.Func("embedding-model", "OpenAI embedding model for the openai embedder (default "+defaultEmbeddingModel+")", func(value string) error {
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("must not be empty")
+		}
+		c.embeddingModel = value
+		return nil
+	})
+	fs.Func("dimensions", "with the openai embedder, shorten embeddings to this many dimensions (default: the model's full size)", func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("must be a positive integer")
+		}
+		c.dimensions = n
+		return nil
+	})
+	fs.Func("embedding-endpoint", "base URL of an OpenAI-compatible embedding service to use instead of OpenAI, e.g. http://embedder:8080/v1", func(value string) error {
+		endpoint, err := parseEmbeddingEndpoint(value)
+		c.embeddingEndpoint = endpoint
+		return err
+	})
+	fs.StringVar(&c.embeddingAPIKey, "embedding-api-key", "", "with -embedding-endpoint, the key the service expects; without one no key is sent and OPENAI_API_KEY is not required")
+	c.openAIConfigFlag(fs)
+}
+
+// embeddingAPIKeyEnv carries -embedding-api-key to the scripts, so the key
+// never appears in their command line.
+const embeddingAPIKeyEnv = "PVDB_EMBEDDING_API_KEY"
+
+// parseEmbeddingEndpoint checks that value is an absolute http or https URL
+// without query or fragment, and returns it without a trailing slash.
+func parseEmbeddingEndpoint(value string) (string, error) {
+	u, err := url.Parse(value)
+	switch {
+	case err != nil:
+		return "", err
+	case u.Scheme != "http" && u.Scheme != "https":
+		return "", fmt.Errorf("want an http or https URL, got %q", value)
+	case u.Host == "":
+		return "", fmt.Errorf("%q has no host", value)
+	case u.RawQuery != "" || u.Fragment != "":
+		return "", fmt.Errorf("%q must not have a query or fragment", value)
+	case u.User != nil:
+		return "", errors.New("the URL must not hold credentials; pass -embedding-api-key")
+	}
+	return strings.TrimSuffix(value, "/"), nil
+}
+
+// resolvedEmbeddingModel names the model the scripts will embed with.
+func (c *commonFlags) resolvedEmbeddingModel() string {
+	if c.embedder == embedderLocal {
+		return localEmbeddingModel
+	}
+	return c.embeddingModel
+}
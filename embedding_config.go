@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// embeddingConfig is the embedding setup a collection was created with,
+// kept in a sidecar file in the persist dir so later runs embed the same way
+// without repeating -embedder, -embedding-model and -dimensions.
+type embeddingConfig struct {
+	Embedder       string `json:"embedder"`
+	EmbeddingModel string `json:"embedding_model"`
+	// Dimensions is 0 for the model's full-size embeddings.
+	Dimensions int `json:"dimensions,omitempty"`
+}
+
+// embeddingConfigPath is where the embedding config of collection is kept in
+// persistDir. Collection names are plain file names, see
+// collectionNamePattern.
+func embeddingConfigPath(persistDir, collection string) string {
+	return filepath.Join(persistDir, "pvdb-embedding-"+collection+".json")
+}
+
+// readEmbeddingConfig reads the embedding config of collection, returning
+// nil when none was recorded.
+func readEmbeddingConfig(persistDir, collection string) (*embeddingConfig, error) {
+	path := embeddingConfigPath(persistDir, collection)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the embedding config of collection '%s': %w", collection, err)
+	}
+	var cfg embeddingConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s is not a pvdb embedding config: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// writeEmbeddingConfig records cfg as the embedding config of collection
+// with writeFileAtomic, so an interrupted run leaves the previous config
+// intact.
+func writeEmbeddingConfig(persistDir, collection string, cfg embeddingConfig) error {
+	path := embeddingConfigPath(persistDir, collection)
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("cannot write the embedding config of collection '%s': %w", collection, err)
+	}
+	return nil
+}
+
+// localEmbeddingConfig reports whether the embedding config of the
+// collection lives in the persist dir: only for subcommands that embed, and
+// not for a Chroma server or an in-memory store.
+func (c *commonFlags) localEmbeddingConfig() bool {
+	return c.embedder != "" && c.server == nil && !c.noPersist
+}
+
+// applyEmbeddingConfig takes -embedder, -embedding-model and -dimensions from
+// the collection's recorded embedding config unless they were given on the
+// command line, so the collection is always queried and extended with the
+// model it was built with. A value given on the command line that
+// contradicts the config wins, with a warning, since it leaves the stored
+// and the new embeddings incomparable.
+func (c *commonFlags) applyEmbeddingConfig() error {
+	if !c.localEmbeddingConfig() {
+		return nil
+	}
+	cfg, err := readEmbeddingConfig(c.persistDir, c.collection)
+	if err != nil || cfg == nil {
+		return err
+	}
+	contradicts := func(flagName string, given, recorded any) {
+		slog.Warn(fmt.Sprintf("-%s contradicts the embedding config of collection '%s'; its stored embeddings will not be comparable with this run's", flagName, c.collection), "given", given, "recorded", recorded, "config", embeddingConfigPath(c.persistDir, c.collection))
+	}
+	if !c.isSet("embedder") {
+		c.embedder = cfg.Embedder
+	} else if c.embedder != cfg.Embedder {
+		contradicts("embedder", c.embedder, cfg.Embedder)
+		return nil
+	}
+	if cfg.Embedder != embedderOpenAI {
+		return nil
+	}
+	if !c.isSet("embedding-model") {
+		c.embeddingModel = cfg.EmbeddingModel
+	} else if c.embeddingModel != cfg.EmbeddingModel {
+		contradicts("embedding-model", c.embeddingModel, cfg.EmbeddingModel)
+	}
+	if !c.isSet("dimensions") {
+		c.dimensions = cfg.Dimensions
+	} else if c.dimensions != cfg.Dimensions {
+		contradicts("dimensions", c.dimensions, cfg.Dimensions)
+	}
+	return nil
+}
+
+// recordEmbeddingConfig saves this run's embedding setup as the collection's
+// embedding config after the run created the collection or stored documents
+// in it, unless one is already recorded. Failing to save is only a warning,
+// as the documents are stored either way.
+func (c *commonFlags) recordEmbeddingConfig() {
+	if !c.localEmbeddingConfig() || c.dryRun {
+		return
+	}
+	if cfg, err := readEmbeddingConfig(c.persistDir, c.collection); cfg != nil || err != nil {
+		return
+	}
+	cfg := embeddingConfig{Embedder: c.embedder, EmbeddingModel: c.resolvedEmbeddingModel(), Dimensions: c.dimensions}
+	if err := writeEmbeddingConfig(c.persistDir, c.collection, cfg); err != nil {
+		slog.Warn("could not record the collection's embedding config", "collection", c.collection, "error", err)
+	}
+}
+
+// The subcommands that rename, delete or re-embed a collection keep its
+// embedding config in step through these; a failure is only a warning, as
+// the collection itself has changed either way.
+
+// moveEmbeddingConfig carries the embedding config of the collection over to
+// its new name to, dropping the config of any collection the rename
+// replaced.
+func (s *storeFlags) moveEmbeddingConfig(to string) {
+	if s.server != nil || s.noPersist {
+		return
+	}
+	err := os.Rename(embeddingConfigPath(s.persistDir, s.collection), embeddingConfigPath(s.persistDir, to))
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.Remove(embeddingConfigPath(s.persistDir, to))
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("could not move the collection's embedding config", "from", s.collection, "to", to, "error", err)
+	}
+}
+
+// removeEmbeddingConfig deletes the embedding config of the collection.
+func (s *storeFlags) removeEmbeddingConfig() {
+	if s.server != nil || s.noPersist {
+		return
+	}
+	if err := os.Remove(embeddingConfigPath(s.persistDir, s.collection)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("could not remove the collection's embedding config", "collection", s.collection, "error", err)
+	}
+}
+
+// replaceEmbeddingConfig records cfg as the embedding config of the
+// collection, whether or not one was recorded before.
+func (s *storeFlags) replaceEmbeddingConfig(cfg embeddingConfig) {
+	if s.server != nil || s.noPersist {
+		return
+	}
+	if err := writeEmbeddingConfig(s.persistDir, s.collection, cfg); err != nil {
+		slog.Warn("could not record the collection's embedding config", "collection", s.collection, "error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Policies for documents that are empty or only whitespace, which embed to
+// vectors that match nothing in particular but still turn up in searches.
+const (
+	emptyReject      = "reject"
+	emptySkip        = "skip"
+	emptyPlaceholder = "placeholder"
+)
+
+var emptyPolicies = []string{emptyReject, emptySkip, emptyPlaceholder}
+
+// isEmptyDocument reports whether doc holds nothing but whitespace.
+func isEmptyDocument(doc string) bool {
+	return strings.TrimSpace(doc) == ""
+}
+
+// rejectEmptyDocuments fails on the first empty or whitespace-only document
+// in p.
+func rejectEmptyDocuments(p ingestPayload) error {
+	for i, doc := range p.Documents {
+		if isEmptyDocument(doc) {
+			return fmt.Errorf("document %q is empty or only whitespace; pass -on-empty skip or -on-empty placeholder to ingest the rest", p.IDs[i])
+		}
+	}
+	return nil
+}
+
+// skipEmptyDocuments returns p minus its empty and whitespace-only documents,
+// dropping their metadatas, ids and embeddings with them, and how many went.
+func skipEmptyDocuments(p ingestPayload) (ingestPayload, int) {
+	var kept ingestPayload
+	skipped := 0
+	for i, doc := range p.Documents {
+		if isEmptyDocument(doc) {
+			slog.Warn("skipping empty document", "id", p.IDs[i])
+			skipped++
+			continue
+		}
+		kept.AppendFrom(p, i)
+	}
+	if skipped == 0 {
+		return p, 0
+	}
+	return kept, skipped
+}
+
+// replaceEmptyDocuments sets the empty and whitespace-only documents of p to
+// placeholder and returns how many it replaced.
+func replaceEmptyDocuments(p *ingestPayload, placeholder string) int {
+	replaced := 0
+	for i, doc := range p.Documents {
+		if isEmptyDocument(doc) {
+			p.Documents[i] = placeholder
+			replaced++
+		}
+	}
+	return replaced
+}
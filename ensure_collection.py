@@ -0,0 +1,33 @@
+import chromadb
+import json
+import sys
+
+from add_documents import collection_names, new_collection_metadata, split_named_args, open_client
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        mode = options.get("mode")
+        if args or mode not in ("require", "create"):
+            raise ValueError("Usage: python ensure_collection.py --mode=require|create [--collection=NAME]")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Report whether the collection exists and, with --mode=create,
+        # create it when it doesn't, recording the embedding model like add
+        name = options.get("collection", "documents")
+        exists = name in collection_names(client)
+        created = False
+        if mode == "create" and not exists:
+            metadata = new_collection_metadata(client, name, options)
+            client.create_collection(name=name, metadata=metadata or None)
+            created = True
+
+        print(json.dumps({"exists": exists, "created": created}))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// defaultEnvFile is read when present; -env-file names a file that must exist.
+const defaultEnvFile = ".env"
+
+// loadEnvFile parses simple KEY=VALUE lines from path. Blank lines and lines
+// starting with # are ignored, an optional "export " prefix is accepted and
+// values may be wrapped in matching single or double quotes.
+func loadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return env, nil
+}
+
+// loadEnv reads the -env-file value. The default file is optional; an
+// explicitly named one must exist.
+func (c *commonFlags) loadEnv() error {
+	if c.envFile == "" {
+		return nil
+	}
+	env, err := loadEnvFile(c.envFile)
+	if errors.Is(err, os.ErrNotExist) && c.envFile == defaultEnvFile {
+		return nil
+	}
+	if err != nil {
+		return invalidArgsf("loading -env-file: %w", err)
+	}
+	c.fileEnv = env
+	return nil
+}
+
+// cleanEnvKeys are the process environment variables -clean-env passes on
+// besides the OPENAI_* and CHROMA_* ones. Python on Windows needs SYSTEMROOT.
+var cleanEnvKeys = []string{"PATH", "HOME", "SYSTEMROOT"}
+
+// cleanEnvPrefixes start the names of the variables -clean-env passes on
+// for the scripts' OpenAI and Chroma settings.
+var cleanEnvPrefixes = []string{"OPENAI_", "CHROMA_"}
+
+// envFlags defines -clean-env and the repeatable -env on fs.
+func (c *commonFlags) envFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.cleanEnv, "clean-env", false, "start the scripts with only PATH, HOME and the OPENAI_* and CHROMA_* variables instead of the whole environment")
+	fs.Func("env", "KEY=VALUE variable to set in the scripts' environment, e.g. to pass one back under -clean-env (repeatable)", func(value string) error {
+		key, _, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return errors.New("want KEY=VALUE")
+		}
+		c.flagEnv = append(c.flagEnv, value)
+		return nil
+	})
+}
+
+// inherited looks key up in the part of the process environment the scripts
+// get: all of it, or under -clean-env only the variables it keeps.
+func (c *commonFlags) inherited(key string) (string, bool) {
+	if c.cleanEnv && !keptByCleanEnv(key) {
+		return "", false
+	}
+	return os.LookupEnv(key)
+}
+
+// keptByCleanEnv reports whether -clean-env passes the variable key on.
+func keptByCleanEnv(key string) bool {
+	for _, k := range cleanEnvKeys {
+		if strings.EqualFold(key, k) {
+			return true
+		}
+	}
+	for _, prefix := range cleanEnvPrefixes {
+		if strings.HasPrefix(strings.ToUpper(key), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptEnv is the environment scripts run with: the inherited process
+// environment, UTF-8 output, then the variables from the env file, the
+// store flags, -openai-config, -embedding-api-key and -env, each taking
+// precedence over the ones before.
+func (c *commonFlags) scriptEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if !c.cleanEnv || keptByCleanEnv(key) {
+			env = append(env, kv)
+		}
+	}
+	kept := len(env)
+	env = append(env, scriptEncoding)
+	env = append(env, c.environ()...)
+	env = append(env, c.storeFlags.environ()...)
+	for key, value := range c.openAIEnv {
+		env = append(env, key+"="+value)
+	}
+	if c.embeddingAPIKey != "" {
+		env = append(env, embeddingAPIKeyEnv+"="+c.embeddingAPIKey)
+	}
+	env = append(env, c.flagEnv...)
+	if verboseOutput() {
+		// Only the names: the values can be API keys
+		var keys []string
+		for _, kv := range env[kept:] {
+			key, _, _ := strings.Cut(kv, "=")
+			keys = append(keys, key)
+		}
+		slog.Debug("script environment", "inherited", kept, "set", strings.Join(keys, ","))
+	}
+	return env
+}
+
+// environ returns the environment variables from the env file that the
+// inherited environment does not already set, as KEY=VALUE pairs for
+// cmd.Env.
+func (c *commonFlags) environ() []string {
+	var env []string
+	for key, value := range c.fileEnv {
+		if _, set := c.inherited(key); !set {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// getenv looks key up in -env, -openai-config, the inherited environment,
+// then the env file.
+func (c *commonFlags) getenv(key string) string {
+	for i := len(c.flagEnv) - 1; i >= 0; i-- {
+		if k, value, _ := strings.Cut(c.flagEnv[i], "="); k == key {
+			return value
+		}
+	}
+	if value, ok := c.openAIEnv[key]; ok {
+		return value
+	}
+	if value, ok := c.inherited(key); ok {
+		return value
+	}
+	return c.fileEnv[key]
+}
+
+// requireOpenAIKey fails with exitInvalidArgs when no OpenAI key is available
+// to a script that embeds documents or queries with OpenAI.
+func (c *commonFlags) requireOpenAIKey() error {
+	// A custom -embedding-endpoint takes -embedding-api-key if it wants one
+	if c.dryRun || c.embedder == embedderLocal || c.embeddingEndpoint != "" || c.getenv("OPENAI_API_KEY") != "" {
+		return nil
+	}
+	return invalidArgs(errors.New("OPENAI_API_KEY is not set; export it, add it to the -env-file or pass -openai-config"))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// errorDump is the -error-dump file. It receives the records of every batch
+// that failed, as the JSONL pvdb import and pvdb retry read, and is only
+// created once a batch fails. It is safe for concurrent use by the files of a
+// -dir ingestion.
+type errorDump struct {
+	path    string
+	mu      sync.Mutex
+	f       *os.File
+	records int
+}
+
+// write appends the records of the batches that err reports as failed.
+func (d *errorDump) write(batches []ingestPayload, err error) error {
+	failed := failedBatches(err)
+	if len(failed) == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		f, err := os.Create(d.path)
+		if err != nil {
+			return fmt.Errorf("cannot write -error-dump: %w", err)
+		}
+		d.f = f
+	}
+	w := bufio.NewWriter(d.f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, i := range failed {
+		b := batches[i]
+		for j := range b.IDs {
+			rec := documentRecord{Document: b.Documents[j], Metadata: b.Metadatas[j], ID: b.IDs[j]}
+			if b.Embeddings != nil {
+				rec.Embedding = b.Embeddings[j]
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+			d.records++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("cannot write -error-dump: %w", err)
+	}
+	return nil
+}
+
+// close closes the file, if a failure created it, and tells the user how to
+// replay what it holds.
+func (d *errorDump) close() error {
+	if d.f == nil {
+		return nil
+	}
+	if err := d.f.Close(); err != nil {
+		return fmt.Errorf("cannot write -error-dump: %w", err)
+	}
+	fmt.Fprintf(statusOut(), "wrote %d records of failed batches to %s; re-ingest them with pvdb retry -from %s\n", d.records, d.path, d.path)
+	return nil
+}
+
+// failedBatches returns the indices of the batches whose batchErrors err,
+// as returned by ingestBatches, holds.
+func failedBatches(err error) []int {
+	switch e := err.(type) {
+	case *batchError:
+		return []int{e.index}
+	case interface{ Unwrap() []error }:
+		var failed []int
+		for _, inner := range e.Unwrap() {
+			failed = append(failed, failedBatches(inner)...)
+		}
+		return failed
+	}
+	return nil
+}
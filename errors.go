@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Exit codes returned by main, so callers can tell failure classes apart.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitNoPython    = 2
+	exitInvalidArgs = 3
+	exitScriptError = 4
+	exitNotReady    = 5
+	exitNotFound    = 6
+	exitChecksum    = 7
+	exitNoResults   = 8
+	exitLocked      = 9
+	exitTimeout     = 124
+)
+
+// argError marks an error caused by invalid command-line input.
+type argError struct {
+	err error
+}
+
+func (e *argError) Error() string {
+	return e.err.Error()
+}
+
+func (e *argError) Unwrap() error {
+	return e.err
+}
+
+// invalidArgs wraps err so main exits with exitInvalidArgs.
+func invalidArgs(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &argError{err: err}
+}
+
+// invalidArgsf is invalidArgs for a formatted message.
+func invalidArgsf(format string, a ...any) error {
+	return invalidArgs(fmt.Errorf(format, a...))
+}
+
+// scriptError is a script's non-zero exit together with the stderr it wrote,
+// so the tail of a Python traceback can be shown with the failure.
+type scriptError struct {
+	err    *exec.ExitError
+	stderr string
+}
+
+func (e *scriptError) Error() string {
+	return e.err.Error()
+}
+
+func (e *scriptError) Unwrap() error {
+	return e.err
+}
+
+// defaultErrorContext is how many trailing stderr lines accompany a script
+// failure.
+const defaultErrorContext = 10
+
+// errorContext is set by -error-context.
+var errorContext = defaultErrorContext
+
+// errorContextFlag defines -error-context on fs.
+func errorContextFlag(fs *flag.FlagSet) {
+	fs.IntVar(&errorContext, "error-context", defaultErrorContext, "lines of script stderr to show when a script fails (0 for none)")
+}
+
+// tailLines returns the last n lines of s, without a trailing newline.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if n <= 0 || s == "" {
+		return ""
+	}
+	return strings.Join(lines[max(len(lines)-n, 0):], "\n")
+}
+
+// exitCode maps an error returned by a subcommand to the process exit code.
+func exitCode(err error) int {
+	var (
+		timeoutErr *timeoutError
+		readyErr   *notReadyError
+		notFound   *notFoundError
+		checksum   *checksumError
+		noResults  *insufficientResultsError
+		locked     *persistLockedError
+		exitErr    *exec.ExitError
+		argErr     *argError
+	)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &timeoutErr):
+		return exitTimeout
+	case errors.As(err, &readyErr):
+		return exitNotReady
+	case errors.As(err, &notFound):
+		return exitNotFound
+	case errors.As(err, &checksum):
+		return exitChecksum
+	case errors.As(err, &noResults):
+		return exitNoResults
+	case errors.As(err, &locked):
+		return exitLocked
+	case errors.As(err, &argErr):
+		return exitInvalidArgs
+	case errors.Is(err, exec.ErrNotFound):
+		return exitNoPython
+	case errors.As(err, &exitErr):
+		return exitScriptError
+	default:
+		return exitFailure
+	}
+}
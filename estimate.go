@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// defaultPricePer1K is OpenAI's text-embedding-3-small price in dollars per
+// thousand tokens.
+const defaultPricePer1K = 0.00002
+
+// tokenizer counts the tokens an embedding model would see in text.
+type tokenizer func(text string) int
+
+// countTokens is the tokenizer estimate uses. It is a variable so a real
+// tokenizer can be wired in later.
+var countTokens tokenizer = heuristicTokens
+
+// heuristicTokens approximates a token count without a vocabulary: every run
+// of letters and digits is one token and every other non-space rune is one
+// more.
+func heuristicTokens(text string) int {
+	tokens := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				tokens++
+			}
+			inWord = true
+		case unicode.IsSpace(r):
+			inWord = false
+		default:
+			tokens++
+			inWord = false
+		}
+	}
+	return tokens
+}
+
+// estimateCost returns the tokens in docs and what embedding them costs at
+// price dollars per 1000 tokens.
+func estimateCost(docs []string, price float64) (tokens int, cost float64) {
+	for _, doc := range docs {
+		tokens += countTokens(doc)
+	}
+	return tokens, float64(tokens) / 1000 * price
+}
+
+// documentsToEmbed returns the documents of p that Python will embed, leaving
+// out those with a precomputed embedding.
+func documentsToEmbed(p ingestPayload) []string {
+	if p.Embeddings == nil {
+		return p.Documents
+	}
+	var docs []string
+	for i, doc := range p.Documents {
+		if p.Embeddings[i] == nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// runEstimate handles `pvdb estimate -file docs.jsonl`, which estimates the
+// tokens and embedding cost of ingesting the file without running Python.
+func runEstimate(args []string) (summary, error) {
+	fs := newFlagSet("estimate")
+	file := fs.String("file", "", "JSONL file of {document, metadata, id} records to estimate")
+	price := fs.Float64("price-per-1k", defaultPricePer1K, "embedding price in dollars per 1000 tokens")
+	jsonFlag(fs)
+	logFormatFlag(fs)
+	configFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *file == "" {
+		return nil, invalidArgs(errors.New("missing required flag -file"))
+	}
+	if *price < 0 {
+		return nil, invalidArgsf("-price-per-1k must not be negative, got %g", *price)
+	}
+	p, err := loadDocumentsFile(*file)
+	if err != nil {
+		return nil, invalidArgs(err)
+	}
+
+	tokens, cost := estimateCost(documentsToEmbed(p), *price)
+	fmt.Fprintf(humanOut(), "%d documents, about %d tokens: estimated cost $%.6f at $%s per 1K tokens\n", len(p.Documents), tokens, cost, strconv.FormatFloat(*price, 'f', -1, 64))
+	return summary{"documents": len(p.Documents), "tokens": tokens, "cost": cost, "price_per_1k": *price}, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runExport handles `pvdb export -collection foo -out dump.jsonl`, streaming
+// the JSONL written by export_collection.py to a file (gzip-compressed when
+// it ends in .gz) or, with -out -, to stdout. The number of lines written is
+// checked against the collection's count.
+func runExport(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("export")
+	out := fs.String("out", "-", "file to write the JSONL dump to, or - for stdout")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *out == "-" && jsonOutput {
+		return nil, invalidArgs(errors.New("-json needs stdout for the outcome; pass -out FILE"))
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	result, ran, err := common.runScript(ctx, python, "count_documents.py", nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ran {
+		_, _, err := common.streamScript(ctx, python, "export_collection.py", nil, io.Discard)
+		return dryRunSummary(false), err
+	}
+	want, err := parseCount("count_documents.py", result.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	dump, err := createDump(*out)
+	if err != nil {
+		return nil, err
+	}
+	lines := &lineCounter{w: dump}
+	_, _, err = common.streamScript(ctx, python, "export_collection.py", nil, lines)
+	if err != nil {
+		dump.abort()
+		return nil, err
+	}
+	if err := dump.Close(); err != nil {
+		return nil, err
+	}
+
+	if lines.n != want {
+		slog.Warn("exported documents differ from the collection count", "exported", lines.n, "count", want)
+	}
+	// With -out - stdout carries the dump itself.
+	msg := humanOut()
+	if *out == "-" {
+		msg = cli.stderr
+	}
+	fmt.Fprintf(msg, "exported %d documents from collection '%s' to %s\n", lines.n, common.collection, *out)
+	return summary{"collection": common.collection, "exported": lines.n, "count": want, "out": *out}, nil
+}
+
+// lineCounter passes writes through to w, counting the newlines.
+type lineCounter struct {
+	w io.Writer
+	n int
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += bytes.Count(p[:n], []byte("\n"))
+	return n, err
+}
+
+// dumpFile is the destination of an export. A file is written under a
+// temporary name and only renamed into place by a successful Close, so a
+// failed export never leaves a truncated backup behind.
+type dumpFile struct {
+	io.Writer
+	gz   *gzip.Writer
+	tmp  *os.File
+	path string
+}
+
+// createDump opens the export destination for path, - meaning stdout.
+func createDump(path string) (*dumpFile, error) {
+	if path == "-" {
+		return &dumpFile{Writer: cli.stdout}, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, invalidArgsf("cannot create -out file: %w", err)
+	}
+	d := &dumpFile{Writer: tmp, tmp: tmp, path: path}
+	if strings.HasSuffix(path, ".gz") {
+		d.gz = gzip.NewWriter(tmp)
+		d.Writer = d.gz
+	}
+	return d, nil
+}
+
+// Close flushes the dump and moves it to its final path.
+func (d *dumpFile) Close() error {
+	if d.tmp == nil {
+		return nil
+	}
+	if d.gz != nil {
+		if err := d.gz.Close(); err != nil {
+			d.abort()
+			return err
+		}
+	}
+	if err := d.tmp.Close(); err != nil {
+		os.Remove(d.tmp.Name())
+		return err
+	}
+	return os.Rename(d.tmp.Name(), d.path)
+}
+
+// abort discards a partially written dump.
+func (d *dumpFile) abort() {
+	if d.tmp == nil {
+		return
+	}
+	d.tmp.Close()
+	os.Remove(d.tmp.Name())
+}
@@ -0,0 +1,42 @@
+import chromadb
+import json
+import sys
+
+from add_documents import get_existing_collection, split_named_args, open_client
+
+# Documents fetched per round trip while exporting
+PAGE_SIZE = 1000
+
+def export_collection(collection, out):
+    # Write one {document, metadata, id} record per line, the format
+    # `pvdb add -file` reads back
+    offset = 0
+    while True:
+        page = collection.get(limit=PAGE_SIZE, offset=offset, include=["documents", "metadatas"])
+        if not page["ids"]:
+            break
+        for i, doc_id in enumerate(page["ids"]):
+            record = {"document": page["documents"][i], "metadata": page["metadatas"][i], "id": doc_id}
+            out.write(json.dumps(record) + "\n")
+        offset += len(page["ids"])
+    out.flush()
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python export_collection.py [--collection=NAME]")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Get the Chroma collection, which a read never creates
+        collection = get_existing_collection(client, options.get("collection", "documents"))
+
+        export_collection(collection, sys.stdout)
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
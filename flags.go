@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// newFlagSet returns the flag set of a subcommand. Its parse errors and -h
+// usage go to the invocation's stderr rather than the process's.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(cli.stderr)
+	return fs
+}
+
+// commonFlags are accepted by every subcommand that launches a script.
+type commonFlags struct {
+	storeFlags
+	scriptDir string
+	workDir   string
+	envFile   string
+	timeout   time.Duration
+	dryRun    bool
+	// interactive connects the script's stdin to ours.
+	interactive bool
+	// maxOutputBytes caps the captured size of each script output stream.
+	maxOutputBytes int64
+	// embedder is the -embedder backend, empty for scripts that don't embed.
+	embedder string
+	// embeddingModel is the -embedding-model for the openai embedder.
+	embeddingModel string
+	// dimensions is the -dimensions embeddings are shortened to, 0 for the
+	// model's full size.
+	dimensions int
+	// embeddingEndpoint is the -embedding-endpoint base URL of an
+	// OpenAI-compatible embedding service, empty to use OpenAI.
+	embeddingEndpoint string
+	// embeddingAPIKey is the -embedding-api-key sent to embeddingEndpoint.
+	embeddingAPIKey string
+	// collectionMetadata is the -collection-metadata JSON object, if any.
+	collectionMetadata string
+
+	// fileEnv holds the variables loaded from envFile.
+	fileEnv map[string]string
+	// openAIEnv holds the OPENAI_* variables from -openai-config, which
+	// take precedence over the environment.
+	openAIEnv map[string]string
+	// waitReadyTimeout bounds how long to wait for the -chroma-url server;
+	// readyChecked and readyErr remember the outcome.
+	waitReadyTimeout time.Duration
+	readyChecked     bool
+	readyErr         error
+	// perBatchTimeout bounds each ingestion batch when set, -timeout then
+	// bounding the whole run.
+	perBatchTimeout time.Duration
+	// namedArgs passes ingestion payloads as named arguments. Unless
+	// -named-args is given, ingestBatches detects it from the script.
+	namedArgs bool
+	// batchOptions are named arguments added to every ingestion batch.
+	batchOptions []string
+	// cleanEnv starts the scripts from a minimal environment.
+	cleanEnv bool
+	// flagEnv holds the -env KEY=VALUE variables in the order given.
+	flagEnv []string
+	// scriptSums are the -script-sha256 pins, nil when none were given.
+	scriptSums scriptSums
+	// fs is the flag set the flags were registered on.
+	fs *flag.FlagSet
+}
+
+// registerCommonFlags defines the shared flags on fs.
+func registerCommonFlags(fs *flag.FlagSet) *commonFlags {
+	c := &commonFlags{fs: fs}
+	c.storeFlags.register(fs)
+	fs.StringVar(&c.scriptDir, "script-dir", "", "directory containing the Python scripts (default: next to the executable, then the working directory)")
+	fs.StringVar(&c.workDir, "work-dir", "", "working directory of the scripts (default: the directory of the executable)")
+	fs.StringVar(&c.envFile, "env-file", defaultEnvFile, "KEY=VALUE file whose variables are passed to the scripts")
+	fs.DurationVar(&c.timeout, "timeout", time.Duration(defaults.Timeout), "maximum time the Python script may run")
+	fs.DurationVar(&c.waitReadyTimeout, "wait-ready", 0, "with -chroma-url, wait up to this long for the server's heartbeat before running scripts (0 to not wait)")
+	fs.Int64Var(&c.maxOutputBytes, "max-output-bytes", defaultMaxOutputBytes, "maximum bytes of script stdout and of stderr to keep; the rest is discarded")
+	fs.BoolVar(&c.interactive, "interactive", false, "connect the script's stdin to the launcher's, for scripts that prompt for input")
+	fs.BoolVar(&c.dryRun, "dry-run", false, "print the resolved command instead of running it")
+	logFormatFlag(fs)
+	jsonFlag(fs)
+	configFlag(fs)
+	errorContextFlag(fs)
+	traceFlag(fs)
+	auditFlag(fs)
+	verbosityFlags(fs)
+	mergeOutputFlag(fs)
+	logPrefixFlag(fs)
+	maxConcurrentProcessesFlag(fs)
+	processMetricsFlag(fs)
+	c.scriptSHA256Flag(fs)
+	c.envFlags(fs)
+	strictVersionFlag(fs)
+	return c
+}
+
+// resolve fills in the default work dir, checks -no-persist and -chroma-url
+// or anchors a relative persist dir to the work dir so Go and Python agree
+// on it, and loads the env file. It doesn't touch the store.
+func (c *commonFlags) resolve() error {
+	audit.Collection = c.collection
+	if c.workDir == "" {
+		c.workDir = launcherDir()
+	}
+	if c.noPersist {
+		if c.isSet("persist-dir") || c.chromaURL != "" {
+			return invalidArgsf("-no-persist cannot be combined with -persist-dir or -chroma-url")
+		}
+		slog.Warn("-no-persist: the store is kept in memory and its data will not survive the script process")
+	} else if c.chromaURL != "" {
+		if c.isSet("persist-dir") {
+			return invalidArgsf("-persist-dir and -chroma-url are mutually exclusive")
+		}
+		if err := c.parseChromaURL(); err != nil {
+			return err
+		}
+	} else if c.persistDir != "" && !filepath.IsAbs(c.persistDir) {
+		c.persistDir = filepath.Join(c.workDir, c.persistDir)
+	}
+	return c.loadEnv()
+}
+
+// validate resolves the flags, applies the collection's recorded embedding
+// config and rejects values that would only fail once Python is running. A
+// dry run leaves the filesystem untouched, so the persist dir is only
+// prepared for real runs.
+func (c *commonFlags) validate() error {
+	defer trace.child("argument validation").end()
+	if err := c.resolve(); err != nil {
+		return err
+	}
+	if err := c.applyEmbeddingConfig(); err != nil {
+		return err
+	}
+	if c.maxOutputBytes <= 0 {
+		return invalidArgsf("-max-output-bytes must be positive, got %d", c.maxOutputBytes)
+	}
+	if mergeOutput && jsonOutput {
+		return invalidArgsf("-merge-output cannot be combined with -json, whose outcome needs the script's stdout on its own")
+	}
+	if c.dimensions > 0 && c.embedder == embedderLocal {
+		return invalidArgsf("-dimensions needs -embedder openai; %s always embeds with its full size", localEmbeddingModel)
+	}
+	if c.embeddingEndpoint != "" && c.embedder == embedderLocal {
+		return invalidArgsf("-embedding-endpoint needs -embedder openai; %s embeds on this machine", localEmbeddingModel)
+	}
+	if c.embeddingAPIKey != "" && c.embeddingEndpoint == "" {
+		return invalidArgsf("-embedding-api-key needs -embedding-endpoint; give OpenAI's key as OPENAI_API_KEY")
+	}
+	if c.embedder != "" {
+		model := c.resolvedEmbeddingModel()
+		if c.dimensions > 0 {
+			model += fmt.Sprintf(" (%d dimensions)", c.dimensions)
+		}
+		if !quietOutput() {
+			fmt.Fprintf(cli.stderr, "embedding model: %s\n", model)
+		}
+	}
+	if c.dryRun {
+		return validateCollectionName(c.collection)
+	}
+	return c.storeFlags.validate()
+}
+
+// isSet reports whether the named flag was given on the command line.
+func (c *commonFlags) isSet(name string) bool {
+	set := false
+	c.fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// remoteChroma reports whether the scripts talk to a Chroma server rather
+// than an on-disk store.
+func (c *commonFlags) remoteChroma() bool {
+	return c.server != nil || c.getenv("CHROMA_HOST") != ""
+}
+
+// command builds the invocation of script in the work dir against the
+// selected store, with the env file's variables injected and, under
+// -interactive, our stdin attached.
+func (c *commonFlags) command(ctx context.Context, python, script string, scriptArgs []string) *exec.Cmd {
+	scriptArgs = c.storeFlags.scriptArgs(scriptArgs)
+	if c.embedder != "" {
+		scriptArgs = append(scriptArgs, "--embedder="+c.embedder, "--embedding-model="+c.embeddingModel)
+		if c.dimensions > 0 {
+			scriptArgs = append(scriptArgs, "--dimensions="+strconv.Itoa(c.dimensions))
+		}
+		if c.embeddingEndpoint != "" {
+			scriptArgs = append(scriptArgs, "--embedding-endpoint="+c.embeddingEndpoint)
+		}
+	}
+	if c.collectionMetadata != "" {
+		scriptArgs = append(scriptArgs, "--collection-metadata="+c.collectionMetadata)
+	}
+	scriptArgs = append(scriptArgs, cli.passthroughArgs...)
+	cmd := launcherCommand(ctx, python, script, c.workDir, scriptArgs)
+	cmd.Env = c.scriptEnv()
+	if c.interactive {
+		cmd.Stdin = os.Stdin
+	}
+	return cmd
+}
+
+// namedArgsFlag defines -named-args on fs for the subcommands that pass
+// ingestion payloads to a script.
+func (c *commonFlags) namedArgsFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&c.namedArgs, "named-args", false, "pass the payload to the script as --documents=, --metadatas= and --ids= instead of three positional arguments (default: as the script's --help usage shows, else positional)")
+}
+
+// scriptPath locates the named script in -script-dir, or in the default
+// locations when the flag is unset, and checks it against -script-sha256.
+func (c *commonFlags) scriptPath(name string) (string, error) {
+	path, err := resolveScriptPath(c.scriptDir, name)
+	if err != nil {
+		return "", err
+	}
+	return path, c.scriptSums.verify(path)
+}
+
+// runScript launches the named script once under the common timeout and
+// returns the captured result. Under -dry-run the command is only printed
+// and ran is false.
+func (c *commonFlags) runScript(ctx context.Context, python, name string, scriptArgs []string) (result LauncherResult, ran bool, err error) {
+	return c.launchScript(ctx, python, name, scriptArgs, nil)
+}
+
+// streamScript is runScript for scripts with large output, which is written
+// to stdout as it arrives instead of being captured.
+func (c *commonFlags) streamScript(ctx context.Context, python, name string, scriptArgs []string, stdout io.Writer) (result LauncherResult, ran bool, err error) {
+	return c.launchScript(ctx, python, name, scriptArgs, stdout)
+}
+
+// launchScript implements runScript and, with a non-nil stdout,
+// streamScript.
+func (c *commonFlags) launchScript(ctx context.Context, python, name string, scriptArgs []string, stdout io.Writer) (result LauncherResult, ran bool, err error) {
+	script, err := c.scriptPath(name)
+	if err != nil {
+		return LauncherResult{}, false, err
+	}
+	if err := c.ensureReady(ctx, python); err != nil {
+		return LauncherResult{}, false, err
+	}
+	if !c.dryRun {
+		if err := pvdb.AcquireProcess(ctx); err != nil {
+			return LauncherResult{}, false, err
+		}
+		defer pvdb.ReleaseProcess()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	cmd := c.command(ctx, python, script, scriptArgs)
+	if c.dryRun {
+		printDryRun(cmd)
+		return LauncherResult{}, false, nil
+	}
+
+	if stdout == nil {
+		result, err = runLauncher(cmd, c.maxOutputBytes)
+	} else {
+		result, err = streamLauncher(cmd, stdout, c.maxOutputBytes)
+	}
+	return result, true, launchError(ctx, c.timeout, err)
+}
+
+// probeScript runs script, or a -c snippet, with exactly args and none of
+// the store's or embedder's, for the checks made before the real scripts
+// run. It takes a process slot and the common timeout and goes through
+// launcherCommand like any script. The checks parse the result's Stdout;
+// stderr is only logged at debug level, since older scripts are expected to
+// fail some probes.
+func (c *commonFlags) probeScript(ctx context.Context, python, script string, args []string) (LauncherResult, error) {
+	if err := pvdb.AcquireProcess(ctx); err != nil {
+		return LauncherResult{}, err
+	}
+	defer pvdb.ReleaseProcess()
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	cmd := launcherCommand(ctx, python, script, c.workDir, args)
+	cmd.Env = c.scriptEnv()
+	result, err := execLauncher(cmd, nil, c.maxOutputBytes, func(script, line string) {
+		slog.Debug(line, "script", script)
+	})
+	return result, launchError(ctx, c.timeout, err)
+}
+
+// dryRunSummary is the -json outcome of a subcommand that stopped after
+// printing its commands; ran is false in that case.
+func dryRunSummary(ran bool) summary {
+	if ran {
+		return nil
+	}
+	return summary{"dry_run": true}
+}
+
+// parseInterspersed parses fs from args while allowing positional arguments
+// to appear before, between or after flags. The positional arguments are
+// returned in the order they were given.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// fetchedDocument is one document as get_document.py reports it.
+type fetchedDocument struct {
+	storedDocument
+	Dimensions int `json:"dimensions"`
+}
+
+// notFoundError reports ids that are not in the collection.
+type notFoundError struct {
+	ids []string
+}
+
+func (e *notFoundError) Error() string {
+	return "document not found: " + strings.Join(e.ids, ", ")
+}
+
+// runGet handles `pvdb get -id id1` and `pvdb get -ids '["id1","id2"]'`,
+// printing each document with its metadata and embedding size. Ids missing
+// from the collection fail with exitNotFound.
+func runGet(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("get")
+	id := fs.String("id", "", "id of the document to fetch")
+	ids := fs.String("ids", "", "JSON array of ids of the documents to fetch")
+	idPrefix := idPrefixFlag(fs, "string prepended to every id, as the add or update -id-prefix that stored them")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	var idList []string
+	switch {
+	case *id != "" && *ids != "":
+		return nil, invalidArgs(errors.New("give either -id or -ids, not both"))
+	case *id != "":
+		idList = []string{*id}
+	case *ids != "":
+		var err error
+		if idList, err = decodeIDs("ids", *ids); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, invalidArgs(errors.New("missing required flag -id or -ids"))
+	}
+	prefixIDs(idList, *idPrefix)
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(idList)
+	if err != nil {
+		return nil, err
+	}
+	result, ran, err := common.runScript(ctx, python, "get_document.py", []string{string(encoded)})
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+
+	var docs []fetchedDocument
+	if err := json.Unmarshal([]byte(result.Stdout), &docs); err != nil {
+		return nil, fmt.Errorf("get_document.py returned invalid JSON: %w", err)
+	}
+	found := make(map[string]bool, len(docs))
+	for _, d := range docs {
+		found[d.ID] = true
+	}
+	var missing []string
+	for _, id := range idList {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &notFoundError{ids: missing}
+	}
+
+	audit.Documents = len(docs)
+	if jsonOutput {
+		return summary{"collection": common.collection, "documents": docs}, nil
+	}
+	for i, d := range docs {
+		if i > 0 {
+			fmt.Fprintln(cli.stdout)
+		}
+		meta, _ := json.Marshal(d.Metadata)
+		fmt.Fprintf(cli.stdout, "id: %s\nmetadata: %s\nembedding: %d dimensions\n%s\n", d.ID, meta, d.Dimensions, d.Document)
+	}
+	return nil, nil
+}
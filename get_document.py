@@ -0,0 +1,44 @@
+import chromadb
+import json
+import sys
+
+from add_documents import get_existing_collection, split_named_args, open_client
+
+def get_documents(collection, ids):
+    # Return the stored documents among ids, in the order asked for; ids
+    # that don't exist are left out
+    results = collection.get(ids=ids, include=["documents", "metadatas", "embeddings"])
+    found = {}
+    for i, doc_id in enumerate(results["ids"]):
+        embeddings = results["embeddings"]
+        found[doc_id] = {
+            "id": doc_id,
+            "document": results["documents"][i],
+            "metadata": results["metadatas"][i],
+            "dimensions": len(embeddings[i]) if embeddings is not None else 0,
+        }
+    return [found[doc_id] for doc_id in ids if doc_id in found]
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+
+        # Check if the ids argument is provided
+        if len(args) != 1:
+            raise ValueError("Usage: python get_document.py <ids> [--collection=NAME]")
+
+        ids = json.loads(args[0])
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Get the Chroma collection, which a read never creates
+        collection = get_existing_collection(client, options.get("collection", "documents"))
+
+        print(json.dumps(get_documents(collection, ids)))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
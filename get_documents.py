@@ -0,0 +1,31 @@
+import chromadb
+import json
+import sys
+
+from add_documents import create_or_get_collection, split_named_args, open_client
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+
+        # Check if the ids argument is provided
+        if len(args) != 1:
+            raise ValueError("Usage: python get_documents.py <ids> [--collection=NAME]")
+
+        ids = json.loads(args[0])
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Create or get the Chroma collection
+        collection = create_or_get_collection(client, options.get("collection", "documents"))
+
+        # Fetch the stored text only; ids that don't exist are left out
+        results = collection.get(ids=ids, include=["documents"])
+        print(json.dumps(dict(zip(results["ids"], results["documents"]))))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
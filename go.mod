@@ -1,3 +1,3 @@
 module perrsistant-vector-db
 
-go 1.19
+go 1.21
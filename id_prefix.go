@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// idPrefixFlag defines -id-prefix on fs, the namespace prepended to every id
+// a command sends so several datasets can share a collection.
+func idPrefixFlag(fs *flag.FlagSet, usage string) *string {
+	prefix := new(string)
+	fs.Func("id-prefix", usage, func(value string) error {
+		if err := validateIDPrefix(value); err != nil {
+			return err
+		}
+		*prefix = value
+		return nil
+	})
+	return prefix
+}
+
+// validateIDPrefix rejects prefixes that would make ids Chroma or the
+// scripts' arguments mishandle: empty ones, invalid UTF-8, whitespace and
+// control characters.
+func validateIDPrefix(prefix string) error {
+	if prefix == "" {
+		return errors.New("must not be empty")
+	}
+	if !utf8.ValidString(prefix) {
+		return errors.New("must be valid UTF-8")
+	}
+	for _, r := range prefix {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("must not contain whitespace or control characters, got %q", prefix)
+		}
+	}
+	return nil
+}
+
+// prefixIDs prepends prefix to each of ids in place. Empty ids are left
+// empty, so validation still reports documents without an id.
+func prefixIDs(ids []string, prefix string) {
+	for i, id := range ids {
+		if id != "" {
+			ids[i] = prefix + id
+		}
+	}
+}
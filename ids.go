@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// generateIDs returns n random UUIDv4 strings for documents ingested without
+// an id.
+func generateIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(fmt.Sprintf("reading random bytes: %v", err))
+		}
+		b[6] = b[6]&0x0f | 0x40 // version 4
+		b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+		ids[i] = fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	}
+	return ids
+}
+
+// fillMissingIDs assigns a generated id to every document in p that has none
+// and returns the ids it generated, in document order.
+func fillMissingIDs(p *ingestPayload) []string {
+	if p.IDs == nil {
+		p.IDs = make([]string, len(p.Documents))
+	}
+	var missing []int
+	for i, id := range p.IDs {
+		if id == "" {
+			missing = append(missing, i)
+		}
+	}
+	generated := generateIDs(len(missing))
+	for j, i := range missing {
+		p.IDs[i] = generated[j]
+	}
+	return generated
+}
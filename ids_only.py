@@ -0,0 +1,36 @@
+import chromadb
+import json
+import sys
+
+from add_documents import get_existing_collection, split_named_args, open_client
+
+# Ids fetched per round trip
+PAGE_SIZE = 10000
+
+def collection_ids(collection):
+    ids = []
+    while True:
+        page = collection.get(limit=PAGE_SIZE, offset=len(ids), include=[])
+        if not page["ids"]:
+            return ids
+        ids.extend(page["ids"])
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python ids_only.py [--collection=NAME]")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Get the Chroma collection, which a read never creates
+        collection = get_existing_collection(client, options.get("collection", "documents"))
+
+        print(json.dumps(collection_ids(collection)))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,816 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// ingestPayload holds the parallel arrays add_documents.py expects.
+type ingestPayload = pvdb.Payload
+
+// runAdd handles `pvdb add -documents '[...]' -metadatas '[...]' -ids '[...]'`,
+// `pvdb add -file docs.jsonl` and `pvdb add -`, forwarding the three JSON
+// arrays to add_documents.py. Documents given without ids get generated ones.
+func runAdd(ctx context.Context, python string, args []string) (summary, error) {
+	return runIngest(ctx, python, addCommand, args)
+}
+
+// runUpdate handles `pvdb update`, which takes the same input as add but
+// overwrites the documents and metadata of existing ids through
+// update_documents.py.
+func runUpdate(ctx context.Context, python string, args []string) (summary, error) {
+	return runIngest(ctx, python, updateCommand, args)
+}
+
+// runImport handles `pvdb import -in dump.jsonl`, the inverse of export: it
+// adds the records of a JSONL dump in batches, skipping ids the collection
+// already holds so a backup can be re-imported safely.
+func runImport(ctx context.Context, python string, args []string) (summary, error) {
+	return runIngest(ctx, python, importCommand, args)
+}
+
+// runRetry handles `pvdb retry -from errors.jsonl`, re-ingesting the records
+// of the failed batches an earlier add or import wrote with -error-dump. Like
+// import it skips ids the collection already holds, such as those of a batch
+// that failed part way.
+func runRetry(ctx context.Context, python string, args []string) (summary, error) {
+	return runIngest(ctx, python, retryCommand, args)
+}
+
+// ingestCommand describes one of the subcommands that feed documents to a
+// script.
+type ingestCommand struct {
+	name   string
+	script string
+	// countKey names the -json outcome field holding the documents handled.
+	countKey string
+	// generateIDs assigns a UUID to documents that lack an id.
+	generateIDs bool
+	// skipExisting offers -skip-existing, which drops ids already stored.
+	skipExisting bool
+	// restore reads only a JSONL dump given with the dumpFlag flag, and
+	// skips existing ids unless -skip-existing=false.
+	restore  bool
+	dumpFlag string
+	// ifChanged offers -if-changed, which drops documents whose stored text
+	// is the same and inserts ids not stored yet.
+	ifChanged bool
+	// flagsOnly returns once the arguments have parsed, so pvdb watch can
+	// check the flags it passes on before any file arrives.
+	flagsOnly bool
+}
+
+var (
+	addCommand    = ingestCommand{name: "add", script: "add_documents.py", countKey: "documents_added", generateIDs: true, skipExisting: true}
+	updateCommand = ingestCommand{name: "update", script: "update_documents.py", countKey: "documents_updated", ifChanged: true}
+	importCommand = ingestCommand{name: "import", script: "add_documents.py", countKey: "imported", skipExisting: true, restore: true, dumpFlag: "in"}
+	retryCommand  = ingestCommand{name: "retry", script: "add_documents.py", countKey: "imported", skipExisting: true, restore: true, dumpFlag: "from"}
+)
+
+// runIngest parses and validates an ingestion payload for ic and feeds it to
+// its script in batches.
+func runIngest(ctx context.Context, python string, ic ingestCommand, args []string) (summary, error) {
+	fs := newFlagSet(ic.name)
+	documents, metadatas, ids, file, dir, stdin := new(string), new(string), new(string), new(string), new(string), new(bool)
+	stateFile, force, idPrefix := new(string), new(bool), new(string)
+	csvIn := csvInput{format: inputJSONL}
+	if ic.restore {
+		usage := "JSONL dump written by pvdb export; .gz files are decompressed"
+		if ic.name == retryCommand.name {
+			usage = "JSONL file of failed batches written by -error-dump"
+		}
+		fs.StringVar(file, ic.dumpFlag, "", usage)
+	} else {
+		fs.StringVar(documents, "documents", "", "JSON array of document texts")
+		fs.StringVar(metadatas, "metadatas", "", "JSON array of metadata objects, one per document")
+		fs.StringVar(ids, "ids", "", "JSON array of document ids")
+		fs.StringVar(file, "file", "", "JSONL file of {document, metadata, id} records to ingest, or a CSV file with -input-format csv")
+		fs.StringVar(dir, "dir", "", "directory whose .jsonl and .jsonl.gz files are each ingested as with -file")
+		fs.StringVar(stateFile, "state", "", "with -dir, JSON file recording each ingested file's modification time; files unchanged since the last run are skipped")
+		fs.BoolVar(force, "force", false, "with -state, ingest every file whatever the state file records")
+		csvIn.register(fs)
+		fs.BoolVar(stdin, "stdin", false, "read a {documents, metadatas, ids} JSON object from standard input (same as a trailing -)")
+		idPrefix = idPrefixFlag(fs, "string prepended to every provided or generated id, to namespace a dataset within the collection")
+	}
+	common := registerCommonFlags(fs)
+	common.embedderFlag(fs)
+	common.collectionMetadataFlag(fs)
+	common.namedArgsFlag(fs)
+	strictJSONFlag(fs)
+	var shared commonMetadata
+	shared.register(fs)
+	schema := metadataSchemaFlag(fs)
+	normalizeKeys := fs.Bool("normalize-metadata-keys", false, "lowercase and trim metadata keys, merging keys that then collide with the last in sorted order winning")
+	coerce := fs.Bool("coerce-metadata", false, "store string metadata values that read as integers, decimal numbers or true/false as that type")
+	maxLength := fs.Int("max-document-length", defaultMaxDocumentLength, "reject documents longer than this many characters")
+	chunkSize := fs.Int("chunk-size", 0, "split documents into chunks of at most this many characters, with ids like id#0 (0 to not split)")
+	chunkOverlap := fs.Int("chunk-overlap", 0, "characters consecutive chunks share")
+	truncate := fs.Bool("truncate", false, "trim documents longer than -max-document-length instead of rejecting them")
+	batchSize := fs.Int("batch-size", defaultBatchSize, "maximum documents per "+ic.script+" invocation")
+	retries := fs.Int("retries", defaultRetries, "times to re-run a batch whose script exits non-zero")
+	fs.DurationVar(&common.perBatchTimeout, "per-batch-timeout", 0, "maximum time each batch's script may run; -timeout then bounds the whole ingestion (0 to give each batch -timeout)")
+	retryBackoff := fs.Duration("retry-backoff", defaultRetryBackoff, "ceiling of the random delay before the first retry, doubled on each further attempt")
+	maxTotalRetries := fs.Int("max-total-retries", 0, "retries allowed across all batches together, after which failing batches fail at once (0 for no limit)")
+	retryMaxDelay := fs.Duration("retry-max-delay", defaultRetryMaxDelay, "cap on the retry delay ceiling (0 for no cap)")
+	failFast := fs.Bool("fail-fast", true, "stop starting batches after one fails; with -fail-fast=false every batch is attempted and the failures reported at the end")
+	var skipExisting *bool
+	if ic.skipExisting {
+		skipExisting = fs.Bool("skip-existing", ic.restore, "don't re-ingest documents whose ids are already in the collection")
+	}
+	var ifChanged *bool
+	if ic.ifChanged {
+		ifChanged = fs.Bool("if-changed", false, "only send documents whose text differs from the stored one, inserting ids not stored yet")
+	}
+	onDuplicate := duplicateError
+	fs.Func("on-duplicate", "what to do with ids repeated in the payload: error, first or last (default error)", func(value string) error {
+		if !slices.Contains(duplicatePolicies, value) {
+			return fmt.Errorf("unknown policy %q, want %s", value, strings.Join(duplicatePolicies, ", "))
+		}
+		onDuplicate = value
+		return nil
+	})
+	onControlChar := ""
+	fs.Func("on-control-char", "what to do with documents holding control characters other than tab and newline, such as null bytes: strip or reject (default: send them as they are)", func(value string) error {
+		if !slices.Contains(controlCharPolicies, value) {
+			return fmt.Errorf("unknown policy %q, want %s", value, strings.Join(controlCharPolicies, ", "))
+		}
+		onControlChar = value
+		return nil
+	})
+	onEmpty := emptyReject
+	fs.Func("on-empty", "what to do with documents that are empty or only whitespace: reject, skip or placeholder (default reject)", func(value string) error {
+		if !slices.Contains(emptyPolicies, value) {
+			return fmt.Errorf("unknown policy %q, want %s", value, strings.Join(emptyPolicies, ", "))
+		}
+		onEmpty = value
+		return nil
+	})
+	placeholder := fs.String("empty-placeholder", "(empty document)", "with -on-empty placeholder, the text empty documents are replaced with")
+	var hook preHook
+	fs.Func("pre-hook", `command run on the payload before ingesting, e.g. "python3 clean.py --strict": it reads the {documents, metadatas, ids} JSON object on stdin and prints the one to ingest; a non-zero exit aborts`, func(value string) error {
+		var err error
+		hook, err = parsePreHook(value)
+		return err
+	})
+	requireCollection := fs.Bool("require-existing-collection", false, "fail before ingesting unless the collection already exists")
+	createCollection := fs.Bool("create-collection", false, "create the collection before ingesting, failing if it already exists")
+	preflightFlag := fs.Bool("preflight", false, "print the documents, characters, estimated tokens and batches to ingest and ask for confirmation before launching any script")
+	yes := fs.Bool("yes", false, "with -preflight, go ahead without asking")
+	rateLimit := fs.Int("rate-limit", 0, "maximum batches to start per minute across all workers (0 for no limit)")
+	var dump *errorDump
+	if ic.script == addCommand.script {
+		fs.Func("error-dump", "JSONL file to write the records of failed batches to, for pvdb retry -from; best with -fail-fast=false", func(path string) error {
+			if path == "" {
+				return errors.New("must not be empty")
+			}
+			dump = &errorDump{path: path}
+			return nil
+		})
+	}
+	manifest := fs.String("manifest", "", "JSON file to append a record of this run's parameters to after it succeeds")
+	fileFlag := "file"
+	if ic.restore {
+		fileFlag = ic.dumpFlag
+	}
+	checkpointPath := fs.String("checkpoint", "", "with -"+fileFlag+", JSON file recording the last batch ingested, so a re-run over the unchanged file resumes after it")
+	concurrency := fs.Int("concurrency", defaultConcurrency, "batches to run at once; only used with a client/server Chroma (-chroma-url or CHROMA_HOST)")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, invalidArgs(err)
+	}
+	switch {
+	case ic.restore && len(positional) > 0:
+		return nil, invalidArgsf("unexpected arguments %q", positional)
+	case ic.restore && *file == "":
+		return nil, invalidArgsf("missing required flag -%s", ic.dumpFlag)
+	case len(positional) == 1 && positional[0] == "-":
+		*stdin = true
+	case len(positional) > 0:
+		return nil, invalidArgsf("unexpected arguments %q", positional)
+	}
+	if *checkpointPath != "" && *file == "" {
+		return nil, invalidArgsf("-checkpoint needs -%s", fileFlag)
+	}
+	switch {
+	case common.isSet("empty-placeholder") && onEmpty != emptyPlaceholder:
+		return nil, invalidArgs(errors.New("-empty-placeholder requires -on-empty placeholder"))
+	case onEmpty == emptyPlaceholder && isEmptyDocument(*placeholder):
+		return nil, invalidArgs(errors.New("-empty-placeholder must not be empty or only whitespace"))
+	}
+	if ic.flagsOnly {
+		return nil, nil
+	}
+
+	var (
+		payload ingestPayload
+		files   []string
+	)
+	if (*stateFile != "" || *force) && *dir == "" {
+		return nil, invalidArgs(errors.New("-state and -force need -dir"))
+	}
+	if csvIn.format != inputJSONL && *file == "" {
+		return nil, invalidArgsf("-input-format %s needs -file", csvIn.format)
+	}
+	if *stdin && common.interactive {
+		return nil, invalidArgs(errors.New("-interactive cannot be combined with reading the payload from stdin; use -file or -documents instead"))
+	}
+	if *stdin {
+		if *file != "" || *dir != "" || *documents != "" || *metadatas != "" || *ids != "" {
+			return nil, invalidArgs(errors.New("stdin input cannot be combined with -file, -dir, -documents, -metadatas or -ids"))
+		}
+		if payload, err = readStdinPayload(os.Stdin, stdinGrace); err != nil {
+			return nil, invalidArgs(err)
+		}
+	} else if *file != "" {
+		if *documents != "" || *metadatas != "" || *ids != "" || *dir != "" {
+			return nil, invalidArgs(errors.New("-file cannot be combined with -dir, -documents, -metadatas or -ids"))
+		}
+		load := loadDocumentsFile
+		if csvIn.format == inputCSV {
+			load = csvIn.load
+		}
+		if payload, err = load(*file); err != nil {
+			return nil, invalidArgs(err)
+		}
+	} else if *dir != "" {
+		if *force && *stateFile == "" {
+			return nil, invalidArgs(errors.New("-force needs -state"))
+		}
+		if *documents != "" || *metadatas != "" || *ids != "" {
+			return nil, invalidArgs(errors.New("-dir cannot be combined with -documents, -metadatas or -ids"))
+		}
+		if *preflightFlag {
+			return nil, invalidArgs(errors.New("-preflight cannot be combined with -dir; run pvdb estimate on the files instead"))
+		}
+		if files, err = jsonlFiles(*dir); err != nil {
+			return nil, invalidArgs(err)
+		}
+	} else {
+		required := []struct{ name, value string }{
+			{"documents", *documents},
+			{"metadatas", *metadatas},
+		}
+		if !ic.generateIDs {
+			required = append(required, struct{ name, value string }{"ids", *ids})
+		}
+		for _, f := range required {
+			if f.value == "" {
+				return nil, invalidArgsf("missing required flag -%s", f.name)
+			}
+		}
+		if payload, err = decodeIngestArgs(*documents, *metadatas, *ids); err != nil {
+			return nil, invalidArgs(err)
+		}
+	}
+	if *batchSize <= 0 {
+		return nil, invalidArgsf("-batch-size must be positive, got %d", *batchSize)
+	}
+	if *retries < 0 {
+		return nil, invalidArgsf("-retries must not be negative, got %d", *retries)
+	}
+	if *concurrency <= 0 {
+		return nil, invalidArgsf("-concurrency must be positive, got %d", *concurrency)
+	}
+	if *chunkSize < 0 {
+		return nil, invalidArgsf("-chunk-size must not be negative, got %d", *chunkSize)
+	}
+	if *chunkOverlap < 0 || (*chunkSize > 0 && *chunkOverlap >= *chunkSize) {
+		return nil, invalidArgsf("-chunk-overlap must be at least 0 and less than -chunk-size, got %d", *chunkOverlap)
+	}
+	if *chunkOverlap > 0 && *chunkSize == 0 {
+		return nil, invalidArgs(errors.New("-chunk-overlap needs -chunk-size"))
+	}
+	if *maxLength <= 0 {
+		return nil, invalidArgsf("-max-document-length must be positive, got %d", *maxLength)
+	}
+	if common.perBatchTimeout < 0 {
+		return nil, invalidArgsf("-per-batch-timeout must not be negative, got %s", common.perBatchTimeout)
+	}
+	if *maxTotalRetries < 0 {
+		return nil, invalidArgsf("-max-total-retries must not be negative, got %d", *maxTotalRetries)
+	}
+	if *retryBackoff < 0 || *retryMaxDelay < 0 {
+		return nil, invalidArgs(errors.New("-retry-backoff and -retry-max-delay must not be negative"))
+	}
+	if *requireCollection && *createCollection {
+		return nil, invalidArgs(errors.New("-require-existing-collection and -create-collection are mutually exclusive"))
+	}
+	if *rateLimit < 0 {
+		return nil, invalidArgsf("-rate-limit must not be negative, got %d", *rateLimit)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+	if err := common.requireOpenAIKey(); err != nil {
+		return nil, err
+	}
+	workers, err := batchConcurrency(*concurrency, common)
+	if err != nil {
+		return nil, err
+	}
+	if ifChanged != nil && *ifChanged {
+		// Documents are only sent when they are new or changed, so ids not
+		// stored yet must be inserted
+		common.batchOptions = append(common.batchOptions, "--upsert")
+	}
+	guard := collectionGetOrCreate
+	if *requireCollection {
+		guard = collectionRequire
+	} else if *createCollection {
+		guard = collectionCreate
+	}
+	retry := retryPolicy{maxRetries: *retries, base: *retryBackoff, maxDelay: *retryMaxDelay}
+	if *maxTotalRetries > 0 {
+		retry.budget = &retryBudget{limit: int64(*maxTotalRetries)}
+	}
+	limit := newRateLimiter(*rateLimit)
+	defer limit.stop()
+	batchWorkers := workers
+
+	// ingest runs the rest of the pipeline on one loaded payload, checking
+	// the collection first unless the caller already has
+	var sent idRange
+	// recordRun appends a successful run to the -manifest file
+	recordRun := func(sum summary, err error) (summary, error) {
+		if *manifest == "" || err != nil || common.dryRun {
+			return sum, err
+		}
+		n, _ := sum[ic.countKey].(int)
+		entry := manifestEntry{
+			Timestamp:       time.Now().UTC(),
+			Subcommand:      ic.name,
+			Collection:      common.collection,
+			EmbeddingModel:  common.resolvedEmbeddingModel(),
+			Dimensions:      common.dimensions,
+			BatchSize:       *batchSize,
+			Documents:       n,
+			FirstID:         sent.first,
+			LastID:          sent.last,
+			LauncherVersion: version,
+		}
+		if err := appendManifest(*manifest, entry); err != nil {
+			return sum, err
+		}
+		fmt.Fprintf(statusOut(), "recorded the run in %s\n", *manifest)
+		return sum, nil
+	}
+	// finish closes the -error-dump and records the run in the -manifest
+	finish := func(sum summary, err error) (summary, error) {
+		if dump != nil {
+			if closeErr := dump.close(); closeErr != nil {
+				err = errors.Join(err, closeErr)
+			}
+		}
+		return recordRun(sum, err)
+	}
+	ingest := func(payload ingestPayload, checkCollection bool) (summary, error) {
+		if hook != nil && !common.dryRun {
+			var err error
+			if payload, err = hook.run(ctx, payload); err != nil {
+				return nil, err
+			}
+		}
+		if ic.generateIDs {
+			if generated := fillMissingIDs(&payload); len(generated) > 0 {
+				prefixIDs(generated, *idPrefix)
+				encoded, err := json.Marshal(generated)
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(humanOut(), "generated ids: %s\n", encoded)
+			}
+		}
+		// Generated ids were filled in first, so they are prefixed too
+		prefixIDs(payload.IDs, *idPrefix)
+		shared.apply(&payload, time.Now())
+		sum := summary{}
+		if *idPrefix != "" && len(payload.IDs) > 0 {
+			var prefixed idRange
+			prefixed.add(payload.IDs)
+			sum["id_range"] = map[string]string{"first": prefixed.first, "last": prefixed.last}
+			fmt.Fprintf(statusOut(), "ids with prefix %q range from %s to %s\n", *idPrefix, prefixed.first, prefixed.last)
+		}
+		if *file != "" && !ic.restore {
+			// Report every id in input order so callers can map file lines to
+			// stored documents, generated ids included
+			sum["ids"] = slices.Clone(payload.IDs)
+			sum["count"] = len(payload.IDs)
+		}
+		if onDuplicate != duplicateError {
+			var collapsed int
+			payload, collapsed = dedupeIDs(payload, onDuplicate == duplicateLast)
+			if collapsed > 0 {
+				fmt.Fprintf(statusOut(), "collapsed %d duplicate ids, keeping the %s occurrence\n", collapsed, onDuplicate)
+			}
+			sum["duplicates_collapsed"] = collapsed
+		}
+		if err := pvdb.Validate(payload); err != nil {
+			return nil, invalidArgs(err)
+		}
+		switch onControlChar {
+		case controlCharReject:
+			if err := rejectControlChars(payload); err != nil {
+				return nil, invalidArgs(err)
+			}
+		case controlCharStrip:
+			sum["control_chars_stripped"] = stripControlChars(&payload)
+		}
+		switch onEmpty {
+		case emptyReject:
+			if err := rejectEmptyDocuments(payload); err != nil {
+				return nil, invalidArgs(err)
+			}
+		case emptySkip:
+			var skipped int
+			payload, skipped = skipEmptyDocuments(payload)
+			sum["empty_skipped"] = skipped
+			if skipped > 0 && len(payload.IDs) == 0 {
+				fmt.Fprintf(statusOut(), "nothing to do: all %d documents are empty\n", skipped)
+				sum[ic.countKey] = 0
+				return sum, nil
+			}
+			if skipped > 0 {
+				fmt.Fprintf(statusOut(), "skipped %d empty documents\n", skipped)
+			}
+		case emptyPlaceholder:
+			replaced := replaceEmptyDocuments(&payload, *placeholder)
+			sum["empty_replaced"] = replaced
+			if replaced > 0 {
+				fmt.Fprintf(statusOut(), "replaced %d empty documents with %q\n", replaced, *placeholder)
+			}
+		}
+		if *normalizeKeys {
+			sum["metadata_keys_merged"] = normalizeMetadataKeys(&payload)
+		}
+		if *coerce {
+			coerced := coerceMetadata(&payload)
+			sum["metadata_coerced"] = coerced
+			if coerced.total() > 0 {
+				fmt.Fprintln(statusOut(), coerced)
+			}
+		}
+		if *schema != nil {
+			if err := (*schema).check(payload); err != nil {
+				return nil, invalidArgs(err)
+			}
+		}
+		if payload.Embeddings != nil && *chunkSize > 0 {
+			return nil, invalidArgs(errors.New("-chunk-size cannot be combined with precomputed embeddings, which describe the whole document"))
+		}
+		if payload.Embeddings != nil && ic.script != "add_documents.py" {
+			return nil, invalidArgsf("precomputed embeddings are only supported by add, not %s", ic.name)
+		}
+		if *chunkSize > 0 {
+			parents := len(payload.Documents)
+			payload = chunkPayload(payload, *chunkSize, *chunkOverlap)
+			fmt.Fprintf(statusOut(), "split %d documents into %d chunks\n", parents, len(payload.Documents))
+			sum["chunks"] = len(payload.Documents)
+		}
+		if err := limitDocumentLengths(&payload, *maxLength, *truncate); err != nil {
+			return nil, invalidArgs(err)
+		}
+
+		if *preflightFlag {
+			f := newPreflight(payload, *batchSize, common.embedder)
+			sum["preflight"] = f
+			ok, err := confirmPreflight(f, os.Stdin, *yes || common.dryRun)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				fmt.Fprintln(statusOut(), "ingestion cancelled")
+				sum["cancelled"] = true
+				return sum, nil
+			}
+		}
+
+		if checkCollection && guard != collectionGetOrCreate {
+			state, err := common.guardCollection(ctx, python, guard)
+			if err != nil {
+				return nil, err
+			}
+			sum["collection_created"] = state.Created
+		}
+
+		if ic.restore {
+			sum["skipped"] = 0
+		}
+		if skipExisting != nil && *skipExisting {
+			existing, err := common.existingIDs(ctx, python, payload.IDs)
+			if err != nil {
+				return nil, err
+			}
+			total := len(payload.IDs)
+			payload = withoutIDs(payload, existing)
+			skipped := total - len(payload.IDs)
+			sum["skipped"] = skipped
+			if len(payload.IDs) == 0 {
+				fmt.Fprintf(statusOut(), "nothing to do: all %d ids already exist\n", total)
+				sum[ic.countKey] = 0
+				return sum, nil
+			}
+			if skipped > 0 {
+				fmt.Fprintf(statusOut(), "skipped %d documents whose ids already exist\n", skipped)
+			}
+		}
+
+		if ifChanged != nil && *ifChanged {
+			stored, err := common.storedTexts(ctx, python, payload.IDs)
+			if err != nil {
+				return nil, err
+			}
+			total := len(payload.IDs)
+			payload = changedDocuments(payload, stored)
+			unchanged := total - len(payload.IDs)
+			sum["unchanged"] = unchanged
+			if len(payload.IDs) == 0 {
+				fmt.Fprintf(statusOut(), "nothing to do: all %d documents are unchanged\n", total)
+				sum[ic.countKey] = 0
+				return sum, nil
+			}
+			if unchanged > 0 {
+				fmt.Fprintf(statusOut(), "skipped %d documents whose text is unchanged\n", unchanged)
+			}
+		}
+
+		batches := pvdb.SplitBatches(payload, *batchSize)
+		var resume *checkpoint
+		if *checkpointPath != "" {
+			if resume, err = loadCheckpoint(*checkpointPath, *file, batches, *batchSize); err != nil {
+				return nil, err
+			}
+			if resume.skip > 0 {
+				resumed := 0
+				for _, b := range batches[:resume.skip] {
+					resumed += len(b.IDs)
+				}
+				sum["checkpoint_skipped"] = resumed
+				if resume.skip == len(batches) {
+					fmt.Fprintf(statusOut(), "nothing to do: -checkpoint %s shows all %d batches ingested; delete it to ingest the file again\n", *checkpointPath, len(batches))
+					sum[ic.countKey] = 0
+					return sum, nil
+				}
+				fmt.Fprintf(statusOut(), "resuming from -checkpoint %s: skipping the first %d of %d batches (%d documents), already ingested\n", *checkpointPath, resume.skip, len(batches), resumed)
+				batches = batches[resume.skip:]
+			}
+		}
+		remaining := 0
+		for _, b := range batches {
+			remaining += len(b.Documents)
+		}
+		progressOut := cli.stderr
+		if quietOutput() {
+			progressOut = io.Discard
+		}
+		prog := newProgress(progressOut, len(batches), remaining)
+		prog.checkpoint = resume
+		// add_documents.py reports what it stored in a JSON summary
+		var added *pvdb.AddResult
+		if ic.script == addCommand.script {
+			added = &pvdb.AddResult{}
+		}
+		n, err := ingestBatches(ctx, python, ic.script, batches, common, retry, batchWorkers, *failFast, limit, prog, added)
+		if common.dryRun {
+			return dryRunSummary(false), err
+		}
+		sum[ic.countKey] = n
+		if n > 0 {
+			common.recordEmbeddingConfig()
+		}
+		if err == nil {
+			sent.add(payload.IDs)
+		} else if dump != nil {
+			if dumpErr := dump.write(batches, err); dumpErr != nil {
+				err = errors.Join(err, dumpErr)
+			}
+			sum["error_dump"] = dump.path
+		}
+		if added != nil {
+			sum["add_result"] = *added
+			reportAddResult(*added)
+		}
+		if ic.restore {
+			fmt.Fprintf(statusOut(), "imported %d records, skipped %d already present\n", n, sum["skipped"])
+		}
+		return sum, err
+	}
+
+	if *dir != "" {
+		// Files run side by side in place of batches, one batch at a time
+		// each, so the process count stays within -concurrency
+		batchWorkers = 1
+		var (
+			state    *syncState
+			modTimes map[string]time.Time
+		)
+		unchanged := 0
+		if *stateFile != "" {
+			if state, err = loadSyncState(*stateFile); err != nil {
+				return nil, err
+			}
+			if *force {
+				state.Files = map[string]time.Time{}
+			}
+			total := len(files)
+			if files, modTimes, err = state.changedFiles(files); err != nil {
+				return nil, err
+			}
+			unchanged = total - len(files)
+			if len(files) == 0 {
+				fmt.Fprintf(statusOut(), "nothing to do: all %d files are unchanged since the last run\n", total)
+				return summary{ic.countKey: 0, "unchanged_files": unchanged}, nil
+			}
+			if unchanged > 0 {
+				fmt.Fprintf(statusOut(), "skipped %d files unchanged since the last run\n", unchanged)
+			}
+		}
+		sum, err := ingestFiles(ctx, python, common, files, workers, *failFast, ic.countKey, guard, func(path string) (summary, error) {
+			payload, err := loadDocumentsFile(path)
+			if err != nil {
+				return nil, invalidArgs(err)
+			}
+			return ingest(payload, false)
+		})
+		retry.budget.report(sum)
+		if state != nil && sum != nil && !common.dryRun {
+			sum["unchanged_files"] = unchanged
+			outcomes, _ := sum["files"].([]fileOutcome)
+			if recordErr := state.record(outcomes, modTimes); recordErr != nil {
+				return sum, errors.Join(err, recordErr)
+			}
+			if saveErr := state.save(*stateFile); saveErr != nil {
+				return sum, errors.Join(err, saveErr)
+			}
+		}
+		return finish(sum, err)
+	}
+	sum, err := ingest(payload, true)
+	audit.Documents, _ = sum[ic.countKey].(int)
+	retry.budget.report(sum)
+	return finish(sum, err)
+}
+
+// reportAddResult prints the counts add_documents.py reported across the
+// batches of one ingestion.
+func reportAddResult(r pvdb.AddResult) {
+	line := fmt.Sprintf("stored %d documents, skipped %d already in the collection, %d failed", r.Added, r.Skipped, r.Errors)
+	if r.Unknown {
+		line += "; some batches did not report their counts"
+	}
+	fmt.Fprintln(statusOut(), line)
+}
+
+// batchConcurrency returns how many batches may run at once. Several
+// processes writing to the same embedded store can corrupt it, so concurrency
+// is only used when the scripts talk to a Chroma server; an explicit
+// -concurrency above 1 without one is rejected. Under -interactive batches
+// run one at a time so only one script reads the terminal.
+func batchConcurrency(concurrency int, common *commonFlags) (int, error) {
+	if common.interactive {
+		return 1, nil
+	}
+	if concurrency == 1 || common.remoteChroma() {
+		return concurrency, nil
+	}
+	if common.isSet("concurrency") {
+		return 0, invalidArgsf("-concurrency %d needs a client/server Chroma; set -chroma-url or CHROMA_HOST, or use -concurrency 1", concurrency)
+	}
+	return 1, nil
+}
+
+// Policies for ids repeated within one ingestion payload.
+const (
+	duplicateError = "error"
+	duplicateFirst = "first"
+	duplicateLast  = "last"
+)
+
+var duplicatePolicies = []string{duplicateError, duplicateFirst, duplicateLast}
+
+// dedupeIDs collapses documents that share an id, keeping the first
+// occurrence or, with keepLast, the last one in its position. It returns the
+// cleaned payload and how many documents were dropped. A payload whose arrays
+// differ in length is returned unchanged for pvdb.Validate to report.
+func dedupeIDs(p ingestPayload, keepLast bool) (ingestPayload, int) {
+	if len(p.Metadatas) != len(p.Documents) || len(p.IDs) != len(p.Documents) || (p.Embeddings != nil && len(p.Embeddings) != len(p.Documents)) {
+		return p, 0
+	}
+	keep := make(map[string]int, len(p.IDs))
+	for i, id := range p.IDs {
+		if _, seen := keep[id]; !seen || keepLast {
+			keep[id] = i
+		}
+	}
+	var kept ingestPayload
+	for i, id := range p.IDs {
+		if keep[id] != i {
+			continue
+		}
+		kept.AppendFrom(p, i)
+	}
+	return kept, len(p.IDs) - len(kept.IDs)
+}
+
+// existsChunk is how many ids one exists.py call checks, keeping its JSON
+// argument well under the operating system's per-argument limit.
+const existsChunk = 1000
+
+// existingIDs asks exists.py which of ids are already in the collection.
+// Under -dry-run the commands are only printed and nothing is reported as
+// existing.
+func (c *commonFlags) existingIDs(ctx context.Context, python string, ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for start := 0; start < len(ids); start += existsChunk {
+		encoded, err := json.Marshal(ids[start:min(start+existsChunk, len(ids))])
+		if err != nil {
+			return nil, err
+		}
+		result, ran, err := c.runScript(ctx, python, "exists.py", []string{string(encoded)})
+		if err != nil || !ran {
+			return existing, err
+		}
+		var found []string
+		if err := json.Unmarshal([]byte(result.Stdout), &found); err != nil {
+			return nil, fmt.Errorf("exists.py returned invalid JSON: %w", err)
+		}
+		for _, id := range found {
+			existing[id] = true
+		}
+	}
+	return existing, nil
+}
+
+// withoutIDs returns p minus the documents whose id is in drop.
+func withoutIDs(p ingestPayload, drop map[string]bool) ingestPayload {
+	var kept ingestPayload
+	for i, id := range p.IDs {
+		if drop[id] {
+			continue
+		}
+		kept.AppendFrom(p, i)
+	}
+	return kept
+}
+
+// validateIngestArgs decodes the JSON arguments destined for add_documents.py
+// and checks that they describe a consistent batch, so an obviously malformed
+// request fails before a Python process is spun up.
+func validateIngestArgs(docs, metas, ids string) error {
+	payload, err := decodeIngestArgs(docs, metas, ids)
+	if err != nil {
+		return err
+	}
+	return pvdb.Validate(payload)
+}
+
+// decodeIngestArgs parses the three JSON flag values into a payload. An empty
+// ids value leaves the ids unset so they can be generated.
+func decodeIngestArgs(docs, metas, ids string) (ingestPayload, error) {
+	var p ingestPayload
+	if err := decodeInput([]byte(docs), &p.Documents); err != nil {
+		return p, fmt.Errorf("-documents must be a JSON array of strings: %w", err)
+	}
+	if err := decodeInput([]byte(metas), &p.Metadatas); err != nil {
+		return p, fmt.Errorf("-metadatas must be a JSON array of objects: %w", err)
+	}
+	if ids == "" {
+		return p, nil
+	}
+	if err := decodeInput([]byte(ids), &p.IDs); err != nil {
+		return p, fmt.Errorf("-ids must be a JSON array of strings: %w", err)
+	}
+	return p, nil
+}
+
+// defaultMaxDocumentLength keeps documents, in characters, comfortably inside
+// the embedding models' token limits.
+const defaultMaxDocumentLength = 32000
+
+// limitDocumentLengths rejects documents in p longer than limit characters,
+// naming the first offending id, or with truncate trims each of them to limit
+// with a warning.
+func limitDocumentLengths(p *ingestPayload, limit int, truncate bool) error {
+	for i, doc := range p.Documents {
+		n := utf8.RuneCountInString(doc)
+		if n <= limit {
+			continue
+		}
+		if !truncate {
+			return fmt.Errorf("document %q is %d characters, more than -max-document-length %d", p.IDs[i], n, limit)
+		}
+		slog.Warn("truncating document", "id", p.IDs[i], "length", n, "limit", limit)
+		p.Documents[i] = string([]rune(doc)[:limit])
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxLineSize bounds a single JSONL record; documents larger than this are
+// better split before ingestion anyway.
+const maxLineSize = 16 << 20
+
+// documentRecord is one line of a JSONL ingestion file.
+type documentRecord struct {
+	Document string         `json:"document"`
+	Metadata map[string]any `json:"metadata"`
+	ID       string         `json:"id"`
+	// Embedding is an optional precomputed vector for Document.
+	Embedding []float64 `json:"embedding,omitempty"`
+}
+
+// loadDocumentsFile reads a JSONL file of documentRecord lines into the
+// parallel arrays add_documents.py expects, with embeddings only when some
+// record has one. A path ending in .gz is decompressed while it is read.
+// Blank lines are skipped and parse errors report the offending line number.
+func loadDocumentsFile(path string) (ingestPayload, error) {
+	var p ingestPayload
+	r, err := openInput(path)
+	if err != nil {
+		return p, err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var rec documentRecord
+		if err := decodeInput(text, &rec); err != nil {
+			return p, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if rec.Embedding != nil {
+			for len(p.Embeddings) < len(p.Documents) {
+				p.Embeddings = append(p.Embeddings, nil)
+			}
+		}
+		if rec.Embedding != nil || p.Embeddings != nil {
+			p.Embeddings = append(p.Embeddings, rec.Embedding)
+		}
+		p.Documents = append(p.Documents, rec.Document)
+		p.Metadatas = append(p.Metadatas, rec.Metadata)
+		p.IDs = append(p.IDs, rec.ID)
+	}
+	if err := scanner.Err(); err != nil {
+		return p, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// openInput opens the ingestion file at path, decompressing it while it is
+// read when the name ends in .gz.
+func openInput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a valid gzip file: %w", path, err)
+	}
+	return gzipFile{Reader: gz, file: f}, nil
+}
+
+// gzipFile closes both the decompressor and the file beneath it.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// stdinGrace is how long an interactive terminal may stay silent before
+// readStdinPayload gives up on it.
+const stdinGrace = 2 * time.Second
+
+// readStdinPayload decodes a {documents, metadatas, ids} JSON object from
+// stdin. When stdin is a terminal and nothing is typed within grace, it fails
+// instead of hanging, since the user most likely forgot to pipe a payload.
+func readStdinPayload(stdin *os.File, grace time.Duration) (ingestPayload, error) {
+	type decoded struct {
+		payload ingestPayload
+		err     error
+	}
+	first := make(chan struct{})
+	done := make(chan decoded, 1)
+	go func() {
+		var d decoded
+		dec := json.NewDecoder(&firstReadNotifier{r: stdin, first: first})
+		if strictJSON {
+			d.err = decodeStrict(dec, &d.payload)
+		} else {
+			d.err = dec.Decode(&d.payload)
+		}
+		done <- d
+	}()
+
+	if isTerminal(stdin) {
+		select {
+		case <-first:
+		case d := <-done:
+			return checkStdinPayload(d.payload, d.err)
+		case <-time.After(grace):
+			return ingestPayload{}, errors.New("stdin is a terminal and no payload arrived; pipe a {documents, metadatas, ids} JSON object")
+		}
+	}
+	d := <-done
+	return checkStdinPayload(d.payload, d.err)
+}
+
+func checkStdinPayload(p ingestPayload, err error) (ingestPayload, error) {
+	if errors.Is(err, io.EOF) {
+		return p, errors.New("stdin is empty; expected a {documents, metadatas, ids} JSON object")
+	}
+	if err != nil {
+		return p, fmt.Errorf("decoding stdin payload: %w", err)
+	}
+	return p, nil
+}
+
+// firstReadNotifier closes first once the wrapped reader returns any data.
+type firstReadNotifier struct {
+	r     io.Reader
+	first chan struct{}
+	seen  bool
+}
+
+func (f *firstReadNotifier) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 && !f.seen {
+		f.seen = true
+		close(f.first)
+	}
+	return n, err
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// scriptEncoding makes Python write UTF-8 to its pipes whatever the locale,
+// since everything pvdb reads back from a script is decoded as UTF-8. Without
+// it a C or Windows code page locale mangles non-ASCII documents, or fails
+// with UnicodeEncodeError.
+const scriptEncoding = "PYTHONIOENCODING=utf-8"
+
+// defaultTimeout bounds how long a single Python script may run.
+const defaultTimeout = 60 * time.Second
+
+// venvPython is the interpreter of a virtualenv in the working directory.
+func venvPython() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(".venv", "Scripts", "python.exe")
+	}
+	return filepath.Join(".venv", "bin", "python")
+}
+
+// pythonArgs are passed to the interpreter ahead of the script, such as the
+// -3 of the Windows py launcher. resolvePython sets them.
+var pythonArgs []string
+
+// pythonCandidate is one interpreter invocation resolvePython may fall back to.
+type pythonCandidate struct {
+	bin  string
+	args []string
+}
+
+func (c pythonCandidate) String() string {
+	return strings.Join(append([]string{c.bin}, c.args...), " ")
+}
+
+// defaultPythons are the interpreters tried, in order, when none is
+// configured. Windows installs usually name the binary python.exe, or only
+// provide the py launcher.
+func defaultPythons() []pythonCandidate {
+	if runtime.GOOS == "windows" {
+		return []pythonCandidate{{bin: "python3"}, {bin: "python"}, {bin: "py", args: []string{"-3"}}}
+	}
+	return []pythonCandidate{{bin: builtinConfig().PythonBin}}
+}
+
+// resolvePython picks the interpreter to run the scripts with, along with
+// where it came from: a .venv in the working directory first, then the
+// PYTHON_BIN environment variable, then the config file's python_bin, and
+// otherwise the first of defaultPythons found on PATH. It fails, listing
+// everything it tried, when the chosen interpreter cannot be found.
+func resolvePython() (python, source string, err error) {
+	venv := venvPython()
+	if info, err := os.Stat(venv); err == nil && !info.IsDir() {
+		if abs, err := filepath.Abs(venv); err == nil {
+			return abs, "virtualenv in the working directory", nil
+		}
+	}
+	candidates, source := defaultPythons(), "default"
+	if bin := os.Getenv("PYTHON_BIN"); bin != "" {
+		candidates, source = []pythonCandidate{{bin: bin}}, "PYTHON_BIN"
+	} else if defaults.PythonBin != builtinConfig().PythonBin {
+		candidates, source = []pythonCandidate{{bin: defaults.PythonBin}}, "config python_bin"
+	}
+
+	tried := make([]string, len(candidates))
+	for i, c := range candidates {
+		if _, err := exec.LookPath(c.bin); err == nil {
+			pythonArgs = c.args
+			return c.bin, source, nil
+		}
+		tried[i] = c.String()
+	}
+	return candidates[0].bin, source, fmt.Errorf("Python interpreter not found in the system PATH (tried %s)", strings.Join(tried, ", "))
+}
+
+// scriptName is the base name of the script cmd runs.
+func scriptName(cmd *exec.Cmd) string {
+	return filepath.Base(cmd.Args[1+len(pythonArgs)])
+}
+
+// resolveScriptPath returns the absolute path of the script called name,
+// failing with a clear message when it does not exist. An empty dir searches
+// next to the launcher executable and then the working directory.
+func resolveScriptPath(dir, name string) (string, error) {
+	if dir != "" {
+		path, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return "", invalidArgsf("script not found: %s", path)
+		}
+		return path, nil
+	}
+
+	candidates := []string{filepath.Join(launcherDir(), name), name}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return filepath.Abs(path)
+		}
+	}
+	return "", invalidArgsf("script not found: %s; set -script-dir to the directory containing %s", candidates[0], name)
+}
+
+// timeoutError reports that a script was killed because its deadline passed.
+type timeoutError struct {
+	after time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("python script timed out after %s", e.after)
+}
+
+// launcherCommand builds every script invocation. It is buildLauncherCommand
+// except in tests, which swap in a fake command so the orchestration can run
+// without Python.
+var launcherCommand = buildLauncherCommand
+
+// launcherRunner is the library's runner configured by the launcher's
+// flags, capturing at most limit bytes of each output stream.
+func launcherRunner(limit int64) pvdb.Runner {
+	return pvdb.Runner{
+		PythonArgs:     pythonArgs,
+		KillGrace:      killGrace,
+		CancelSignal:   cancelSignal,
+		MaxOutputBytes: limit,
+		MergeStderr:    mergeOutput,
+	}
+}
+
+// buildLauncherCommand prepares the interpreter invocation of script with
+// scriptArgs passed through as individual arguments, so values containing
+// spaces or quotes reach Python untouched. The script runs in workDir, or the
+// launcher executable's directory when workDir is empty, so relative paths on
+// the Python side don't depend on where pvdb was started. The process is
+// killed when ctx is done.
+func buildLauncherCommand(ctx context.Context, python, script, workDir string, scriptArgs []string) *exec.Cmd {
+	if workDir == "" {
+		workDir = launcherDir()
+	}
+	return launcherRunner(0).Command(ctx, python, script, workDir, scriptArgs)
+}
+
+// launcherDir returns the directory holding the pvdb executable, following
+// symlinks, or the working directory if it cannot be determined.
+func launcherDir() string {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return "."
+	}
+	return filepath.Dir(exe)
+}
+
+// LauncherResult is the captured outcome of one Python script run.
+type LauncherResult struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Truncated is set when stdout or stderr exceeded the capture limit.
+	Truncated bool `json:"truncated"`
+	// MaxRSSBytes and the CPU times describe what the script's process
+	// consumed; MaxRSSBytes is 0 where the platform doesn't report it.
+	MaxRSSBytes      int64   `json:"max_rss_bytes"`
+	UserCPUSeconds   float64 `json:"user_cpu_seconds"`
+	SystemCPUSeconds float64 `json:"system_cpu_seconds"`
+}
+
+// defaultMaxOutputBytes caps how much of each output stream is kept.
+const defaultMaxOutputBytes = pvdb.DefaultMaxOutputBytes
+
+// outputTruncated records that some script's output was cut short, so the
+// -json outcome can say so.
+var outputTruncated atomic.Bool
+
+// runLauncher runs cmd to completion, capturing its stdout instead of
+// streaming it to the terminal. Stderr is both captured and re-emitted line by
+// line through the structured logger as it arrives. At most limit bytes of
+// each stream are kept. The result is populated even when the script fails so
+// callers can still inspect its stderr.
+func runLauncher(cmd *exec.Cmd, limit int64) (LauncherResult, error) {
+	return execLauncher(cmd, nil, limit, logScriptLine)
+}
+
+// streamLauncher is runLauncher for scripts whose stdout is too large to
+// hold: it is written to stdout as it arrives and left out of the result.
+// Under -merge-output stderr goes to stdout too, through the same pipe.
+func streamLauncher(cmd *exec.Cmd, stdout io.Writer, limit int64) (LauncherResult, error) {
+	return execLauncher(cmd, stdout, limit, logScriptLine)
+}
+
+// execLauncher implements runLauncher and, with a non-nil stdout,
+// streamLauncher, running cmd through launcherRunner and passing each line
+// of its stderr to logLine.
+func execLauncher(cmd *exec.Cmd, stdout io.Writer, limit int64, logLine func(script, line string)) (LauncherResult, error) {
+	script := scriptName(cmd)
+	if verboseOutput() {
+		slog.Debug("running script", "command", commandLine(cmd), "dir", cmd.Dir)
+	}
+	defer trace.child("run " + script).end()
+	start := time.Now()
+	run, err := launcherRunner(limit).Run(cmd, stdout, func(line string) {
+		logLine(script, line)
+	})
+	if run.State == nil && err != nil {
+		return LauncherResult{}, startError(cmd, err)
+	}
+
+	result := LauncherResult{
+		Stdout:    run.Stdout,
+		Stderr:    run.Stderr,
+		Truncated: run.Truncated,
+	}
+	if state := run.State; state != nil {
+		result.ExitCode = state.ExitCode()
+		result.MaxRSSBytes = maxRSSBytes(state)
+		result.UserCPUSeconds = state.UserTime().Seconds()
+		result.SystemCPUSeconds = state.SystemTime().Seconds()
+		childUsage.record(result)
+	}
+	slog.Debug("script finished", "script", script, "exit_code", result.ExitCode, "duration", time.Since(start).String())
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		err = &scriptError{err: exitErr, stderr: result.Stderr}
+	}
+	if result.Truncated {
+		noteTruncated(cmd, limit)
+	}
+	return result, err
+}
+
+// startError explains a failure to start cmd. A command line over the
+// operating system's ARG_MAX fails with the cryptic E2BIG, which is turned
+// into advice on passing less data as arguments.
+func startError(cmd *exec.Cmd, err error) error {
+	if !errors.Is(err, syscall.E2BIG) {
+		return err
+	}
+	size := 0
+	for _, arg := range cmd.Args {
+		size += len(arg) + 1
+	}
+	return invalidArgsf("cannot start %s: its %d bytes of arguments exceed the operating system's limit (%w); pass the payload with -file or -stdin rather than as flags, and lower -batch-size so each batch fits", scriptName(cmd), size, err)
+}
+
+// noteTruncated records that output of cmd's script went over limit.
+func noteTruncated(cmd *exec.Cmd, limit int64) {
+	outputTruncated.Store(true)
+	slog.Warn("script output truncated", "script", scriptName(cmd), "limit_bytes", limit)
+}
+
+// retryLauncher runs the command produced by newCmd, capturing at most limit
+// bytes of each stream and re-running it after a jittered exponential
+// backoff (see retryPolicy.delay) while the script exits non-zero, up to
+// retry.maxRetries extra attempts and as long as retry.budget lasts. A fresh
+// command is built for each attempt
+// because an exec.Cmd cannot be reused. Failures that are not a script exit,
+// such as a missing interpreter, are returned immediately. The last
+// attempt's result is returned.
+func retryLauncher(ctx context.Context, newCmd func() *exec.Cmd, limit int64, retry retryPolicy) (LauncherResult, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := runLauncher(newCmd(), limit)
+
+		var exitErr *exec.ExitError
+		if err == nil || attempt >= retry.maxRetries || !errors.As(err, &exitErr) || ctx.Err() != nil || !retry.budget.take() {
+			return result, err
+		}
+
+		delay := retry.delay(attempt)
+		slog.Warn("script failed, retrying", "attempt", attempt+1, "err", err, "delay", delay.String())
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return result, err
+		}
+	}
+}
+
+// printResult echoes a captured result's stdout as human-readable output; its
+// stderr was already logged as it arrived.
+func printResult(result LauncherResult) {
+	fmt.Fprint(humanOut(), result.Stdout)
+}
+
+// printDryRun writes the program and arguments of cmd one per line, shell
+// quoted and joined with line continuations so the output can be pasted
+// straight into a shell.
+func printDryRun(cmd *exec.Cmd) {
+	w := humanOut()
+	fmt.Fprint(w, shellQuote(cmd.Path))
+	for _, arg := range cmd.Args[1:] {
+		fmt.Fprint(w, " \\\n  "+shellQuote(arg))
+	}
+	fmt.Fprintln(w)
+}
+
+// verboseArgLimit is the longest argument -verbose prints in full.
+const verboseArgLimit = 200
+
+// commandLine renders cmd shell quoted for -verbose, abbreviating arguments
+// longer than verboseArgLimit, such as batch payloads, to their size.
+func commandLine(cmd *exec.Cmd) string {
+	quoted := []string{shellQuote(cmd.Path)}
+	for _, arg := range cmd.Args[1:] {
+		if len(arg) > verboseArgLimit {
+			arg = fmt.Sprintf("<%d bytes>", len(arg))
+		}
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote single-quotes s unless it consists solely of characters a POSIX
+// shell treats literally.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := func(r rune) bool {
+		return r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r))
+	}
+	if strings.IndexFunc(s, func(r rune) bool { return !safe(r) }) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// launchError turns err into a *timeoutError when it was ctx's deadline, not
+// the script itself, that ended the process.
+func launchError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &timeoutError{after: timeout}
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeScriptArg0 marks a test binary started by fakeLauncher: its argv[0] is
+// this prefix followed by the encoded fakeScript to act out.
+const fakeScriptArg0 = "pvdb-fake-script="
+
+// fakeScript is what a faked script run prints and exits with.
+type fakeScript struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// Sleep is how long the script runs before printing.
+	Sleep time.Duration
+}
+
+// fakeCall is one script invocation a fakeLauncher answered.
+type fakeCall struct {
+	Script string
+	Args   []string
+}
+
+// fakeCalls records the invocations of a fakeLauncher, in order.
+type fakeCalls struct {
+	mu    sync.Mutex
+	calls []fakeCall
+}
+
+// all returns the invocations so far.
+func (f *fakeCalls) all() []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// fakeLauncher swaps launcherCommand, until the test ends, for one that runs
+// the test binary as a stand-in for Python: every invocation prints and exits
+// with what answer returns for the script's base name and arguments. The
+// command line is otherwise the one buildLauncherCommand builds, so the
+// launcher's process handling, output capture and parsing all run as they
+// would against Python.
+func fakeLauncher(t *testing.T, answer func(script string, args []string) fakeScript) *fakeCalls {
+	t.Helper()
+	calls := &fakeCalls{}
+	saved := launcherCommand
+	t.Cleanup(func() { launcherCommand = saved })
+	launcherCommand = func(ctx context.Context, python, script, workDir string, scriptArgs []string) *exec.Cmd {
+		name := filepath.Base(script)
+		calls.mu.Lock()
+		calls.calls = append(calls.calls, fakeCall{Script: name, Args: slices.Clone(scriptArgs)})
+		calls.mu.Unlock()
+		encoded, err := json.Marshal(answer(name, scriptArgs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd := buildLauncherCommand(ctx, os.Args[0], script, workDir, scriptArgs)
+		cmd.Args[0] = fakeScriptArg0 + base64.RawURLEncoding.EncodeToString(encoded)
+		return cmd
+	}
+	return calls
+}
+
+func TestBuildLauncherCommandDir(t *testing.T) {
+	workDir := t.TempDir()
+	tests := []struct {
+		name, workDir, want string
+	}{
+		{name: "work dir given", workDir: workDir, want: workDir},
+		{name: "empty work dir", want: launcherDir()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := buildLauncherCommand(context.Background(), "python3", "add_documents.py", tt.workDir, []string{"[]"})
+			if cmd.Dir != tt.want {
+				t.Errorf("cmd.Dir = %q, want %q", cmd.Dir, tt.want)
+			}
+			if want := []string{"python3", "add_documents.py", "[]"}; !slices.Equal(cmd.Args, want) {
+				t.Errorf("cmd.Args = %q, want %q", cmd.Args, want)
+			}
+		})
+	}
+
+	// The executable's directory, not wherever the launcher was started
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		t.Fatal(err)
+	}
+	if got := launcherDir(); got != filepath.Dir(exe) {
+		t.Errorf("launcherDir() = %q, want the test binary's directory %q", got, filepath.Dir(exe))
+	}
+}
+
+func TestScriptsWriteUTF8(t *testing.T) {
+	const doc = "🍲 ジョロフライス 炒饭"
+	fakeLauncher(t, func(script string, args []string) fakeScript {
+		if script == "-c" {
+			return fakeScript{Stdout: "1.0.0\n"}
+		}
+		return fakeScript{Stdout: `{"ids": ["id1"], "documents": ["` + doc + `"], "distances": [0.25], "metadatas": [{}]}` + "\n"}
+	})
+
+	common := testCommonFlags(t)
+	if cmd := common.command(context.Background(), "python3", "query_documents.py", nil); !slices.Contains(cmd.Env, scriptEncoding) {
+		t.Errorf("scripts run without %s whatever the locale", scriptEncoding)
+	}
+
+	// Any interpreter that exists will do, the scripts are faked
+	t.Setenv("PYTHON_BIN", os.Args[0])
+	var out, errOut bytes.Buffer
+	if code := run([]string{"query", "-persist-dir", t.TempDir(), "-embedder", "local", "jollof"}, &out, &errOut); code != exitOK {
+		t.Fatalf("query exited with %d: %s", code, errOut.String())
+	}
+	if want := "0.2500  id1  " + doc + "\n"; out.String() != want {
+		t.Errorf("query printed %q, want %q", out.String(), want)
+	}
+}
+
+// TestMain acts out a fakeScript when fakeLauncher started the binary, and
+// runs the tests otherwise.
+func TestMain(m *testing.M) {
+	if encoded, ok := strings.CutPrefix(os.Args[0], fakeScriptArg0); ok {
+		var script fakeScript
+		data, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err == nil {
+			err = json.Unmarshal(data, &script)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bad fake script:", err)
+			os.Exit(2)
+		}
+		time.Sleep(script.Sleep)
+		fmt.Print(script.Stdout)
+		fmt.Fprint(os.Stderr, script.Stderr)
+		os.Exit(script.ExitCode)
+	}
+	os.Exit(m.Run())
+}
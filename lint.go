@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// lintIssue is one problem pvdb validate found in a JSONL file.
+type lintIssue struct {
+	Line    int    `json:"line"`
+	ID      string `json:"id,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// runValidate handles `pvdb validate -file docs.jsonl`, which runs the
+// ingestion checks over the file without launching Python and reports every
+// problem found, each with its line number and id. It fails when there are
+// any.
+func runValidate(args []string) (summary, error) {
+	fs := newFlagSet("validate")
+	file := fs.String("file", "", "JSONL file of {document, metadata, id} records to check")
+	maxLength := fs.Int("max-document-length", defaultMaxDocumentLength, "report documents longer than this many characters")
+	schema := metadataSchemaFlag(fs)
+	strictJSONFlag(fs)
+	jsonFlag(fs)
+	logFormatFlag(fs)
+	configFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *file == "" {
+		return nil, invalidArgs(errors.New("missing required flag -file"))
+	}
+	if *maxLength <= 0 {
+		return nil, invalidArgsf("-max-document-length must be positive, got %d", *maxLength)
+	}
+
+	records, issues, err := lintDocumentsFile(*file, *maxLength, *schema)
+	if err != nil {
+		return nil, invalidArgs(err)
+	}
+	for _, issue := range issues {
+		id := ""
+		if issue.ID != "" {
+			id = fmt.Sprintf(" (id %q)", issue.ID)
+		}
+		fmt.Fprintf(humanOut(), "%s:%d%s: %s\n", *file, issue.Line, id, issue.Problem)
+	}
+	sum := summary{"file": *file, "records": records, "issues": issues}
+	if len(issues) > 0 {
+		return sum, invalidArgsf("%d problems found in %d records of %s", len(issues), records, *file)
+	}
+	fmt.Fprintf(humanOut(), "%s: %d records, no problems found\n", *file, records)
+	return sum, nil
+}
+
+// lintDocumentsFile reads the JSONL file at path like loadDocumentsFile but
+// keeps going past bad records, returning how many records it read and every
+// problem with them. Only a file that cannot be read at all is an error.
+func lintDocumentsFile(path string, maxLength int, schema *metadataSchema) (records int, issues []lintIssue, err error) {
+	r, err := openInput(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer r.Close()
+
+	firstLine := make(map[string]int)
+	dims, dimsLine := 0, 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		records++
+		report := func(id, format string, args ...any) {
+			issues = append(issues, lintIssue{Line: line, ID: id, Problem: fmt.Sprintf(format, args...)})
+		}
+		var rec documentRecord
+		if err := decodeInput(text, &rec); err != nil {
+			report("", "%v", err)
+			continue
+		}
+
+		// Ids missing from the file are generated by add
+		checkedID := rec.ID
+		if rec.ID != "" {
+			if first, ok := firstLine[rec.ID]; ok {
+				report(rec.ID, "duplicate id, first used on line %d", first)
+			} else {
+				firstLine[rec.ID] = line
+			}
+		} else {
+			checkedID = fmt.Sprintf("line %d", line)
+		}
+		if n := utf8.RuneCountInString(rec.Document); n > maxLength {
+			report(rec.ID, "document is %d characters, more than -max-document-length %d", n, maxLength)
+		}
+		one := ingestPayload{Documents: []string{rec.Document}, Metadatas: []map[string]any{rec.Metadata}, IDs: []string{checkedID}}
+		if rec.Embedding != nil {
+			one.Embeddings = [][]float64{rec.Embedding}
+		}
+		if err := pvdb.Validate(one); err != nil {
+			report(rec.ID, "%v", err)
+		}
+		if len(rec.Embedding) > 0 {
+			if dims == 0 {
+				dims, dimsLine = len(rec.Embedding), line
+			} else if len(rec.Embedding) != dims {
+				report(rec.ID, "embedding has %d dimensions but the one on line %d has %d", len(rec.Embedding), dimsLine, dims)
+			}
+		}
+		if schema != nil {
+			for _, v := range schema.violations(rec.Metadata) {
+				report(rec.ID, "metadata schema: %s", v)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return records, issues, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return records, issues, nil
+}
@@ -0,0 +1,26 @@
+import chromadb
+import json
+import sys
+
+from add_documents import collection_names, split_named_args, open_client
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python list_collections.py [--persist-dir=DIR]")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        collections = []
+        for name in collection_names(client):
+            collections.append({"name": name, "count": client.get_collection(name).count()})
+
+        print(json.dumps(collections))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// logFormatFlag defines -log-format on fs. The logger is switched as soon as
+// the flag is parsed so everything after it uses the chosen format.
+func logFormatFlag(fs *flag.FlagSet) {
+	fs.Func("log-format", "log output format: text or json (default text)", setLogFormat)
+}
+
+// setLogFormat installs a default slog logger writing to stderr in format,
+// at the level -quiet and -verbose set.
+func setLogFormat(format string) error {
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(cli.stderr, &slog.HandlerOptions{Level: &logLevel})
+	case "json":
+		handler = slog.NewJSONHandler(cli.stderr, &slog.HandlerOptions{Level: &logLevel})
+	default:
+		return fmt.Errorf("unknown log format %q, want text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// scriptLevels maps the prefixes Python's logging module writes to slog levels.
+var scriptLevels = []struct {
+	prefix string
+	level  slog.Level
+}{
+	{"DEBUG", slog.LevelDebug},
+	{"INFO", slog.LevelInfo},
+	{"WARNING", slog.LevelWarn},
+	{"ERROR", slog.LevelError},
+	{"CRITICAL", slog.LevelError},
+}
+
+// logScriptLine re-emits one line of a script's stderr through slog. Lines
+// without a recognised level prefix, such as traceback frames, are logged as
+// warnings so they are never hidden.
+func logScriptLine(script, line string) {
+	level := slog.LevelWarn
+	for _, l := range scriptLevels {
+		if strings.HasPrefix(line, l.prefix) {
+			level = l.level
+			break
+		}
+	}
+	slog.Log(context.Background(), level, line, "script", script)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// logPollInterval is how often pvdb logs -follow checks the audit log for new
+// lines and for rotation.
+const logPollInterval = 500 * time.Millisecond
+
+// ANSI escapes for colorized audit lines.
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+)
+
+// runLogs handles `pvdb logs -audit-log audit.jsonl -n 20 -follow`, printing
+// the last entries of the audit log as human lines and, with -follow, the
+// ones appended after them until interrupted. A rotated log, truncated or
+// replaced by a new file, is reopened from its start. It runs before the
+// interpreter is looked up since it launches no scripts, and so is not
+// itself recorded in the audit log.
+func runLogs(args []string) (summary, error) {
+	fs := newFlagSet("logs")
+	n := fs.Int("n", 10, "number of entries to print before following (0 for none)")
+	follow := fs.Bool("follow", false, "keep printing entries as they are appended, until interrupted")
+	auditFlag(fs)
+	configFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if fs.NArg() > 0 {
+		return nil, invalidArgsf("unexpected arguments %q", fs.Args())
+	}
+	if auditLog == "" {
+		return nil, invalidArgs(errors.New("missing required flag -audit-log"))
+	}
+	if *n < 0 {
+		return nil, invalidArgsf("-n must not be negative, got %d", *n)
+	}
+
+	t := &logTail{path: auditLog, color: colorOutput()}
+	if err := t.open(); err != nil && !(*follow && errors.Is(err, os.ErrNotExist)) {
+		return nil, fmt.Errorf("cannot read -audit-log: %w", err)
+	}
+	defer t.close()
+	if t.f != nil {
+		if err := t.last(*n); err != nil {
+			return nil, err
+		}
+	}
+	if !*follow {
+		return nil, nil
+	}
+	ctx, stop := notifyContext(context.Background())
+	defer stop()
+	return nil, t.follow(ctx)
+}
+
+// colorOutput reports whether stdout is a terminal that escapes can be
+// written to, which the NO_COLOR convention can veto.
+func colorOutput() bool {
+	if _, set := os.LookupEnv("NO_COLOR"); set {
+		return false
+	}
+	return cli.stdout == io.Writer(os.Stdout) && isTerminal(os.Stdout)
+}
+
+// logTail reads the audit log at path, remembering how far it got.
+type logTail struct {
+	path    string
+	color   bool
+	f       *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// open opens the log from its start.
+func (t *logTail) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.close()
+	t.f, t.info, t.offset, t.partial = f, info, 0, nil
+	return nil
+}
+
+// close closes the log if it is open.
+func (t *logTail) close() {
+	if t.f != nil {
+		t.f.Close()
+		t.f = nil
+	}
+}
+
+// last prints the final n complete lines of the log and leaves the offset at
+// its end.
+func (t *logTail) last(n int) error {
+	var lines [][]byte
+	scanner := bufio.NewScanner(t.f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if n == 0 {
+			continue
+		}
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+		lines = append(lines, bytes.Clone(scanner.Bytes()))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading -audit-log: %w", err)
+	}
+	for _, line := range lines {
+		fmt.Fprintln(cli.stdout, formatAuditLine(line, t.color))
+	}
+	offset, err := t.f.Seek(0, io.SeekEnd)
+	t.offset = offset
+	return err
+}
+
+// follow prints lines as they are appended until ctx is done.
+func (t *logTail) follow(ctx context.Context) error {
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := t.poll(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll prints the complete lines appended since the last call, first
+// reopening the log when it was rotated: replaced by another file, or
+// truncated below what was already read.
+func (t *logTail) poll() error {
+	info, err := os.Stat(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Rotated away and not recreated yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if t.f == nil || !os.SameFile(info, t.info) || info.Size() < t.offset {
+		if err := t.open(); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+	}
+	if _, err := t.f.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(t.f)
+	if err != nil {
+		return err
+	}
+	t.offset += int64(len(data))
+	data = append(t.partial, data...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprintln(cli.stdout, formatAuditLine(data[:i], t.color))
+		data = data[i+1:]
+	}
+	t.partial = bytes.Clone(data)
+	return nil
+}
+
+// formatAuditLine renders one audit log line as `time subcommand collection
+// documents duration exit`, colorized when color is set. Lines that are not
+// audit entries are returned as they are.
+func formatAuditLine(line []byte, color bool) string {
+	var e auditEntry
+	if err := json.Unmarshal(line, &e); err != nil || e.Subcommand == "" {
+		return string(line)
+	}
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	status := paint(ansiGreen, "ok")
+	if e.ExitCode != exitOK {
+		status = paint(ansiRed, fmt.Sprintf("exit %d", e.ExitCode))
+	}
+	collection := e.Collection
+	if collection == "" {
+		collection = "-"
+	}
+	duration := time.Duration(e.Duration * float64(time.Millisecond)).Round(time.Millisecond)
+	return fmt.Sprintf("%s  %-11s  %-20s  %6d docs  %8s  %s",
+		paint(ansiDim, e.Timestamp.Local().Format(time.RFC3339)), paint(ansiBold, e.Subcommand), collection, e.Documents, duration, status)
+}
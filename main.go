@@ -1,38 +1,275 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"runtime"
+	"slices"
+	"sync/atomic"
+
+	"perrsistant-vector-db/pvdb"
 )
 
+const usage = `usage: pvdb <command> [arguments] [-- script arguments]
+       pvdb -version
+
+commands:
+  add          add documents, e.g. pvdb add -documents '[...]' -metadatas '[...]' -ids '[...]'
+  update       overwrite existing documents, taking the same flags as add
+  query        run a similarity search, e.g. pvdb query "some text" -n 5
+  search       alias of query, e.g. pvdb search -vector '[0.1, 0.2]' to skip embedding
+  count        report how many documents a collection holds
+  stats        report a collection's size, dimension, distance metric and metadata keys
+  delete       remove documents by id, e.g. pvdb delete -ids '["id1","id2"]'
+  export       dump a collection to JSONL, e.g. pvdb export -collection foo -out dump.jsonl
+  import       restore a JSONL dump, e.g. pvdb import -in dump.jsonl
+  retry        re-ingest the failed batches saved by -error-dump, e.g. pvdb retry -from errors.jsonl
+  collections  list the collections in the store with their document counts
+  reset        delete a whole collection after confirmation, e.g. pvdb reset -collection foo
+  rename       rename a collection, e.g. pvdb rename -from old -to new
+  reembed      re-embed a collection with a new model, e.g. pvdb reembed -from text-embedding-ada-002 -to text-embedding-3-small
+  diff         compare the ids of two collections, e.g. pvdb diff -a coll1 -b coll2
+  get          fetch documents by id, e.g. pvdb get -id id1
+  peek         show the first stored documents, e.g. pvdb peek -n 10
+  sample       show random documents for spot checks, e.g. pvdb sample -n 20 -seed 42
+  recent       list documents ingested after a time, e.g. pvdb recent -since 2024-01-01T00:00:00Z
+  estimate     estimate embedding tokens and cost, e.g. pvdb estimate -file docs.jsonl
+  validate     check a JSONL file without ingesting it, e.g. pvdb validate -file docs.jsonl
+  bench        measure ingestion throughput, e.g. pvdb bench -n 1000 -batch-size 128
+  query-bench  measure query latency at several k, e.g. pvdb query-bench -text "x" -ks 1,5,10,50,100
+  doctor       check that the persistent store is present and readable
+  check        verify the interpreter, chromadb, the OpenAI key and the persist dir
+  selftest     check that ingestion payloads reach the interpreter intact
+  contract     report whether the ingestion scripts take positional or named arguments
+  compact      reclaim the store's dead space, e.g. pvdb compact -expect-shrink
+  watch        ingest .jsonl files as they appear in a directory, e.g. pvdb watch -dir ./inbox -done-dir ./done
+  serve        accept ingestion over HTTP, e.g. pvdb serve -addr :8080
+  logs         print the audit log as human lines, e.g. pvdb logs -audit-log audit.jsonl -follow
+`
+
 func main() {
-	// Check if Python is installed
-	_, pythonErr := exec.LookPath("python3")
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run is the whole CLI: it runs the subcommand named by args[0] with the
+// rest of args, writing to out and errOut instead of the process's stdout and
+// stderr, and returns the exit code.
+func run(args []string, out, errOut io.Writer) int {
+	cli = invocation{stdout: out, stderr: errOut}
+	resetRunRecords()
+	// Tag every line with -log-prefix, unless stdout is for machines
+	if prefix, _ := flagArg(args, "log-prefix"); prefix != "" && !wantsJSON(args) && !wantsNDJSON(args) {
+		cli.stdout, cli.stderr = newPrefixWriter(out, prefix), newPrefixWriter(errOut, prefix)
+	}
+	setLogFormat("text")
+	if len(args) > 0 {
+		trace.Name = "pvdb " + args[0]
+	}
+
+	if len(args) < 1 {
+		fmt.Fprint(cli.stderr, usage)
+		return exitInvalidArgs
+	}
+	switch args[0] {
+	case "-version", "--version":
+		fmt.Fprintln(cli.stdout, versionString())
+		return exitOK
+	}
+	command, args := args[0], args[1:]
+
+	// Load the config file first: it can name the interpreter and sets the
+	// defaults every subcommand registers its flags with
+	cfg, err := loadConfig(configArg(args))
+	if err != nil {
+		fmt.Fprintln(cli.stderr, "Error:", err)
+		if wantsJSON(args) {
+			writeOutcome(cli.stdout, nil, err, exitInvalidArgs)
+		}
+		return exitInvalidArgs
+	}
+	defaults = cfg
+	if err := setVerbosity(args); err != nil {
+		fmt.Fprintln(cli.stderr, "Error:", err)
+		if wantsJSON(args) {
+			writeOutcome(cli.stdout, nil, err, exitInvalidArgs)
+		}
+		return exitInvalidArgs
+	}
+
+	// estimate, validate and logs are pure Go and work without an
+	// interpreter, and check reports a missing one itself
+	if command == "estimate" || command == "validate" || command == "check" || command == "logs" {
+		run := runEstimate
+		switch command {
+		case "validate":
+			run = runValidate
+		case "check":
+			run = runCheck
+		case "logs":
+			run = runLogs
+		}
+		sum, err := run(args)
+		code := exitCode(err)
+		reportError(humanOut(), err, code)
+		if jsonOutput {
+			writeOutcome(cli.stdout, sum, err, code)
+		}
+		return code
+	}
+
+	// Check if the selected Python interpreter is installed
+	lookup := trace.child("interpreter lookup")
+	python, source, pythonErr := resolvePython()
+	lookup.end()
 	if pythonErr != nil {
-		fmt.Println("Python3 is not installed or not in the system PATH.")
-		fmt.Println("Please install Python3 before running this program.")
-		os.Exit(1)
+		fmt.Fprintf(cli.stderr, "%v.\n", pythonErr)
+		fmt.Fprintln(cli.stderr, "Please install Python3 or set PYTHON_BIN before running this program.")
+		if wantsJSON(args) {
+			writeOutcome(cli.stdout, nil, pythonErr, exitNoPython)
+		}
+		return exitNoPython
+	}
+	if verboseOutput() {
+		fmt.Fprintf(cli.stderr, "using Python interpreter %s (%s)\n", pythonCandidate{bin: python, args: pythonArgs}, source)
 	}
 
-	// Prepare the command to execute the Python script
-	cmd := exec.Command("python3", "script.py", `["Tomatoes, onions, baby potatoes, cabbage, cabbage leaves", "jolof rice"]`, `[{"topic": "ingredients_list"}, {"topic": "favourite_recipes"}]`, `["id1", "id2"]`)
+	// Cancel the context on Ctrl-C or SIGTERM; the signal is forwarded to the
+	// scripts' process groups so they are torn down with us
+	ctx, stop := notifyContext(context.Background())
+	defer stop()
 
-	// Set the working directory if needed (optional)
-	// cmd.Dir = "/path/to/python_script_directory"
+	// Everything after -- goes to the script untouched
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, cli.passthroughArgs = args[:i], args[i+1:]
+	}
 
-	// Redirect the standard output and standard error to capture the output
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// Writers lock the persist dir to themselves, readers share it
+	sharedPersistLock = slices.Contains(readOnlyCommands, command)
+	defer releasePersistLocks()
 
-	// Run the Python script and check for errors
-	err := cmd.Run()
-	if err != nil {
-		fmt.Println("Error executing Python script:", err)
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			// The command completed with a non-zero exit code
-			fmt.Printf("Exit code: %d\n", exitErr.ExitCode())
+	var sum summary
+	switch command {
+	case "add":
+		sum, err = runAdd(ctx, python, args)
+	case "update":
+		sum, err = runUpdate(ctx, python, args)
+	case "query", "search":
+		sum, err = runQuery(ctx, python, args)
+	case "count":
+		sum, err = runCount(ctx, python, args)
+	case "stats":
+		sum, err = runStats(ctx, python, args)
+	case "delete":
+		sum, err = runDelete(ctx, python, args)
+	case "export":
+		sum, err = runExport(ctx, python, args)
+	case "import":
+		sum, err = runImport(ctx, python, args)
+	case "retry":
+		sum, err = runRetry(ctx, python, args)
+	case "collections":
+		sum, err = runCollections(ctx, python, args)
+	case "reset":
+		sum, err = runReset(ctx, python, os.Stdin, args)
+	case "rename":
+		sum, err = runRename(ctx, python, args)
+	case "reembed":
+		sum, err = runReembed(ctx, python, args)
+	case "diff":
+		sum, err = runDiff(ctx, python, args)
+	case "get":
+		sum, err = runGet(ctx, python, args)
+	case "peek":
+		sum, err = runPeek(ctx, python, args)
+	case "sample":
+		sum, err = runSample(ctx, python, args)
+	case "recent":
+		sum, err = runRecent(ctx, python, args)
+	case "bench":
+		sum, err = runBench(ctx, python, args)
+	case "query-bench":
+		sum, err = runQueryBench(ctx, python, args)
+	case "doctor":
+		sum, err = runDoctor(ctx, python, args)
+	case "selftest":
+		sum, err = runSelftest(ctx, python, args)
+	case "contract":
+		sum, err = runContract(ctx, python, args)
+	case "compact":
+		sum, err = runCompact(ctx, python, args)
+	case "watch":
+		sum, err = runWatch(ctx, python, args)
+	case "serve":
+		err = runServe(ctx, python, args)
+	default:
+		fmt.Fprintf(cli.stderr, "unknown command %q\n\n", command)
+		fmt.Fprint(cli.stderr, usage)
+		return exitInvalidArgs
+	}
+
+	stop()
+	code := exitCode(err)
+	reportError(humanOut(), err, code)
+	if jsonOutput {
+		writeOutcome(cli.stdout, sum, err, code)
+	}
+	trace.end()
+	if traceOutput {
+		writeTrace(cli.stderr, trace)
+	}
+	if processMetricsOutput && !jsonOutput {
+		writeProcessMetrics(cli.stderr, &childUsage)
+	}
+	if auditLog != "" {
+		audit.Timestamp = trace.Start
+		audit.Subcommand = command
+		audit.Duration = trace.Duration
+		audit.ExitCode = code
+		if err := appendAudit(auditLog, audit); err != nil {
+			slog.Warn("cannot write the audit log", "path", auditLog, "err", err)
+		}
+	}
+	return code
+}
+
+// resetRunRecords clears what the previous call of run, if any, recorded
+// about its run: the audit entry, trace, process usage, truncation, the
+// signal that cancelled it and the detected chromadb version. It also
+// restores the default -max-concurrent-processes.
+func resetRunRecords() {
+	audit = auditEntry{}
+	trace = newTimer("pvdb")
+	childUsage = processUsage{}
+	outputTruncated.Store(false)
+	receivedSignal = atomic.Value{}
+	detectedChroma = chromaDetection{}
+	// NumCPU is always positive, so this cannot fail
+	_ = pvdb.SetMaxProcesses(runtime.NumCPU())
+}
+
+// reportError prints a human-readable description of a subcommand failure.
+func reportError(w io.Writer, err error, code int) {
+	var exitErr *exec.ExitError
+	switch {
+	case code == exitOK:
+	case code == exitTimeout:
+		fmt.Fprintln(w, err)
+	case errors.As(err, &exitErr):
+		// The command completed with a non-zero exit code
+		fmt.Fprintln(w, "Error executing Python script:", err)
+		fmt.Fprintf(w, "Exit code: %d\n", exitErr.ExitCode())
+		var scriptErr *scriptError
+		if errors.As(err, &scriptErr) {
+			if tail := tailLines(scriptErr.stderr, errorContext); tail != "" {
+				fmt.Fprintf(w, "Last lines of script stderr:\n%s\n", tail)
+			}
 		}
-		os.Exit(1)
+	default:
+		fmt.Fprintln(w, "Error:", err)
 	}
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunStartsEachCallAfresh(t *testing.T) {
+	calls := fakeLauncher(t, func(script string, args []string) fakeScript {
+		if script == "-c" {
+			return fakeScript{Stdout: "1.0.0\n"}
+		}
+		return fakeScript{Stdout: "3\n"}
+	})
+	// Any interpreter that exists will do, the scripts are faked
+	t.Setenv("PYTHON_BIN", os.Args[0])
+	persistDir := t.TempDir()
+	counts := func() []fakeCall {
+		var found []fakeCall
+		for _, call := range calls.all() {
+			if call.Script == "count_documents.py" {
+				found = append(found, call)
+			}
+		}
+		return found
+	}
+
+	var out1, errOut1 bytes.Buffer
+	if code := run([]string{"count", "-persist-dir", persistDir, "--", "--extra"}, &out1, &errOut1); code != exitOK {
+		t.Fatalf("first run exited with %d: %s", code, errOut1.String())
+	}
+	var out2, errOut2 bytes.Buffer
+	if code := run([]string{"count", "-persist-dir", persistDir}, &out2, &errOut2); code != exitOK {
+		t.Fatalf("second run exited with %d: %s", code, errOut2.String())
+	}
+
+	runs := counts()
+	if len(runs) != 2 {
+		t.Fatalf("count_documents.py ran %d times, want 2", len(runs))
+	}
+	if !slices.Contains(runs[0].Args, "--extra") {
+		t.Errorf("first run did not pass the arguments after --: %q", runs[0].Args)
+	}
+	if slices.Contains(runs[1].Args, "--extra") {
+		t.Errorf("second run passed the first run's arguments after --: %q", runs[1].Args)
+	}
+	for i, out := range []string{out1.String(), out2.String()} {
+		if strings.Count(out, "contains 3 documents") != 1 {
+			t.Errorf("run %d wrote %q, want its own count once", i+1, out)
+		}
+	}
+}
+
+func TestRunReportsFlagErrorsOnItsStderr(t *testing.T) {
+	t.Setenv("PYTHON_BIN", os.Args[0])
+	var out, errOut bytes.Buffer
+	if code := run([]string{"count", "-no-such-flag"}, &out, &errOut); code != exitInvalidArgs {
+		t.Errorf("run exited with %d, want %d", code, exitInvalidArgs)
+	}
+	if !strings.Contains(errOut.String(), "flag provided but not defined: -no-such-flag") {
+		t.Errorf("stderr %q does not report the unknown flag", errOut.String())
+	}
+	if !strings.Contains(errOut.String(), "Usage of count:") {
+		t.Errorf("stderr %q does not show the usage of count", errOut.String())
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// manifestEntry records the parameters of one successful ingestion in the
+// -manifest file, for provenance.
+type manifestEntry struct {
+	Timestamp       time.Time `json:"timestamp"`
+	Subcommand      string    `json:"subcommand"`
+	Collection      string    `json:"collection"`
+	EmbeddingModel  string    `json:"embedding_model"`
+	Dimensions      int       `json:"dimensions,omitempty"`
+	BatchSize       int       `json:"batch_size"`
+	Documents       int       `json:"documents"`
+	FirstID         string    `json:"first_id,omitempty"`
+	LastID          string    `json:"last_id,omitempty"`
+	LauncherVersion string    `json:"launcher_version"`
+}
+
+// idRange tracks the lowest and highest ids sent, in byte order. It is safe
+// for concurrent use by the files of a -dir ingestion.
+type idRange struct {
+	mu          sync.Mutex
+	first, last string
+}
+
+// add widens the range to cover ids.
+func (r *idRange) add(ids []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		if r.first == "" || id < r.first {
+			r.first = id
+		}
+		if id > r.last {
+			r.last = id
+		}
+	}
+}
+
+// appendManifest adds e to the JSON array in the file at path, creating it
+// when missing. The file is replaced with writeFileAtomic, so an interrupted
+// write leaves the previous entries intact.
+func appendManifest(path string, e manifestEntry) error {
+	var entries []json.RawMessage
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("cannot read -manifest: %w", err)
+	default:
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("-manifest %s is not a JSON array: %w", path, err)
+		}
+	}
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(append(entries, entry), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(encoded, '\n')); err != nil {
+		return fmt.Errorf("cannot write -manifest: %w", err)
+	}
+	return nil
+}
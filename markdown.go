@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Output formats of printed query results.
+const (
+	formatText     = "text"
+	formatMarkdown = "markdown"
+	formatNDJSON   = "ndjson"
+)
+
+var resultFormats = []string{formatText, formatMarkdown, formatNDJSON}
+
+// markdownSpecials are backslash-escaped wherever they appear in text put in
+// Markdown, since each can start emphasis, code, a link, raw HTML, an entity
+// or a table cell.
+var markdownSpecials = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `\<`, `>`, `\>`, `|`, `\|`, `~`, `\~`, `&`, `\&`,
+)
+
+// escapeMarkdown escapes line, which holds no newline, so it renders as the
+// literal text. Besides markdownSpecials, a leading marker that would make
+// the line a heading, list item or thematic break is escaped, and leading
+// indentation, which would make it a code block, is dropped.
+func escapeMarkdown(line string) string {
+	line = markdownSpecials.Replace(strings.TrimLeft(line, " \t"))
+	if line != "" && strings.ContainsRune("#+-=", rune(line[0])) {
+		return `\` + line
+	}
+	// An ordered list marker: digits followed by . or )
+	digits := len(line) - len(strings.TrimLeft(line, "0123456789"))
+	if digits > 0 && digits < len(line) && (line[digits] == '.' || line[digits] == ')') {
+		return line[:digits] + `\` + line[digits:]
+	}
+	return line
+}
+
+// markdown renders h as a Markdown list item: its id and score, then its
+// document as a blockquote, each line indented under the bullet.
+func (h queryHit) markdown(includeEmbeddings bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- **%s**", escapeMarkdown(h.ID))
+	if h.Collection != "" {
+		fmt.Fprintf(&b, " in %s", escapeMarkdown(h.Collection))
+	}
+	fmt.Fprintf(&b, ": %s", h.score())
+	if includeEmbeddings {
+		fmt.Fprintf(&b, ", %d-dimensional embedding", len(h.Embedding))
+	}
+	b.WriteString("\n")
+	for _, line := range strings.Split(strings.TrimRight(h.Document, "\n"), "\n") {
+		if line = escapeMarkdown(strings.TrimRight(line, "\r")); line == "" {
+			b.WriteString("  >\n")
+		} else {
+			fmt.Fprintf(&b, "  > %s\n", line)
+		}
+	}
+	return b.String()
+}
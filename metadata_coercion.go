@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// metadataCoercions counts the string metadata values -coerce-metadata
+// converted, by the type they became.
+type metadataCoercions struct {
+	Int   int `json:"int"`
+	Float int `json:"float"`
+	Bool  int `json:"bool"`
+}
+
+func (c metadataCoercions) total() int {
+	return c.Int + c.Float + c.Bool
+}
+
+func (c metadataCoercions) String() string {
+	return fmt.Sprintf("coerced %d metadata values: %d int, %d float, %d bool", c.total(), c.Int, c.Float, c.Bool)
+}
+
+// coerceMetadata converts the string metadata values of p that read as an
+// integer, a decimal number or true/false to that type, leaving every other
+// value as it is. Numbers are held as float64 like decoded JSON ones, which
+// is exact for the integers coerceMetadataValue accepts.
+func coerceMetadata(p *ingestPayload) metadataCoercions {
+	var c metadataCoercions
+	for _, meta := range p.Metadatas {
+		for key, value := range meta {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			switch v := coerceMetadataValue(s).(type) {
+			case int64:
+				meta[key] = float64(v)
+				c.Int++
+			case float64:
+				meta[key] = v
+				c.Float++
+			case bool:
+				meta[key] = v
+				c.Bool++
+			}
+		}
+	}
+	return c
+}
+
+// coerceMetadataValue returns s as an int64, float64 or bool, or s itself
+// when it is none of them. Only plain decimal numbers and true/false in any
+// case are converted, so that a value whose text matters stays a string:
+// "007" and "+1" keep their zero and sign, integers too large to be exact
+// as float64 keep their digits, and NaN, Inf, hex and the yes/1/t spellings of
+// strconv.ParseBool are left alone.
+func coerceMetadataValue(s string) any {
+	switch {
+	case strings.EqualFold(s, "true"):
+		return true
+	case strings.EqualFold(s, "false"):
+		return false
+	}
+	digits := strings.TrimPrefix(s, "-")
+	switch {
+	case digits == "" || digits[0] < '0' || digits[0] > '9':
+		return s
+	case strings.TrimLeft(digits, "0123456789.eE+-") != "":
+		return s
+	case len(digits) > 1 && digits[0] == '0' && !strings.ContainsRune(".eE", rune(digits[1])):
+		return s
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n == 0 && s != "0" || int64(float64(n)) != n {
+			// "-0" would lose its sign, and beyond 2^53 digits are lost
+			return s
+		}
+		return n
+	} else if !strings.ContainsAny(s, ".eE") {
+		// An integer out of int64's range
+		return s
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return s
+	}
+	return f
+}
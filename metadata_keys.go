@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// normalizeMetadataKeys lowercases and trims every metadata key in p. Keys
+// that collide after normalization are merged with a warning; they are
+// applied in sorted order, so the value of the last original key in that
+// order wins. It returns how many keys were merged away.
+func normalizeMetadataKeys(p *ingestPayload) int {
+	merged := 0
+	for i, meta := range p.Metadatas {
+		if meta == nil {
+			continue
+		}
+		keys := make([]string, 0, len(meta))
+		for key := range meta {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		normalized := make(map[string]any, len(meta))
+		from := make(map[string]string, len(meta))
+		for _, key := range keys {
+			canonical := strings.ToLower(strings.TrimSpace(key))
+			if prev, ok := from[canonical]; ok {
+				slog.Warn("metadata keys collide after normalization; keeping the last", "id", p.IDs[i], "key", canonical, "dropped", prev, "kept", key)
+				merged++
+			}
+			normalized[canonical] = meta[key]
+			from[canonical] = key
+		}
+		p.Metadatas[i] = normalized
+	}
+	return merged
+}
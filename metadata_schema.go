@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+)
+
+// metadataSchema is the subset of JSON Schema -metadata-schema understands:
+// an object schema listing required keys and the primitive type of each
+// property. Keys without a property entry may hold any value.
+type metadataSchema struct {
+	Required   []string                  `json:"required"`
+	Properties map[string]schemaProperty `json:"properties"`
+}
+
+// schemaProperty constrains one metadata key.
+type schemaProperty struct {
+	Type string `json:"type"`
+}
+
+// schemaTypes are the property types a metadata value can have.
+var schemaTypes = []string{"string", "number", "integer", "boolean"}
+
+// metadataSchemaFlag defines -metadata-schema on fs. The file is read and
+// checked while parsing, so a broken schema fails before any script runs.
+func metadataSchemaFlag(fs *flag.FlagSet) **metadataSchema {
+	schema := new(*metadataSchema)
+	fs.Func("metadata-schema", "JSON Schema file with the required keys and property types every document's metadata must have", func(path string) error {
+		s, err := loadMetadataSchema(path)
+		if err != nil {
+			return err
+		}
+		*schema = s
+		return nil
+	})
+	return schema
+}
+
+// loadMetadataSchema reads the schema file at path.
+func loadMetadataSchema(path string) (*metadataSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s metadataSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s is not a valid schema: %w", path, err)
+	}
+	for key, p := range s.Properties {
+		if !slices.Contains(schemaTypes, p.Type) {
+			return nil, fmt.Errorf("%s: property %q has type %q, want %s", path, key, p.Type, strings.Join(schemaTypes, ", "))
+		}
+	}
+	return &s, nil
+}
+
+// check validates every document's metadata in p against s. It reports all
+// failing documents at once, each with its id and the offending keys.
+func (s *metadataSchema) check(p ingestPayload) error {
+	var failures []string
+	for i, meta := range p.Metadatas {
+		if violations := s.violations(meta); len(violations) > 0 {
+			failures = append(failures, fmt.Sprintf("  %q: %s", p.IDs[i], strings.Join(violations, "; ")))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d documents violate -metadata-schema:\n%s", len(failures), len(p.Metadatas), strings.Join(failures, "\n"))
+}
+
+// violations describes how meta breaks s, in key order.
+func (s *metadataSchema) violations(meta map[string]any) []string {
+	var violations []string
+	for _, key := range s.Required {
+		if _, ok := meta[key]; !ok {
+			violations = append(violations, fmt.Sprintf("missing required key %q", key))
+		}
+	}
+	keys := make([]string, 0, len(s.Properties))
+	for key := range s.Properties {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value, ok := meta[key]
+		if !ok {
+			continue
+		}
+		want := s.Properties[key].Type
+		if !hasSchemaType(value, want) {
+			violations = append(violations, fmt.Sprintf("key %q is %v, want %s", key, value, want))
+		}
+	}
+	return violations
+}
+
+// hasSchemaType reports whether a decoded JSON value has the schema type
+// want.
+func hasSchemaType(value any, want string) bool {
+	switch v := value.(type) {
+	case string:
+		return want == "string"
+	case bool:
+		return want == "boolean"
+	case float64:
+		return want == "number" || (want == "integer" && v == math.Trunc(v))
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// processMetricsOutput is set by -process-metrics.
+var processMetricsOutput bool
+
+// processMetricsFlag defines -process-metrics on fs.
+func processMetricsFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&processMetricsOutput, "process-metrics", false, "report the peak memory and CPU time the Python processes used, in the -json outcome or on stderr")
+}
+
+// processUsage totals what every script process of the invocation consumed.
+type processUsage struct {
+	mu              sync.Mutex
+	processes       int
+	maxRSSBytes     int64
+	userCPU, sysCPU float64
+}
+
+// childUsage accumulates the usage of the scripts run so far.
+var childUsage processUsage
+
+// record adds one exited script's usage: CPU times add up, memory is the
+// largest peak of any single process.
+func (u *processUsage) record(r LauncherResult) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.processes++
+	u.maxRSSBytes = max(u.maxRSSBytes, r.MaxRSSBytes)
+	u.userCPU += r.UserCPUSeconds
+	u.sysCPU += r.SystemCPUSeconds
+}
+
+// snapshot returns the totals as a -json outcome value.
+func (u *processUsage) snapshot() map[string]any {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return map[string]any{
+		"processes":          u.processes,
+		"max_rss_bytes":      u.maxRSSBytes,
+		"user_cpu_seconds":   u.userCPU,
+		"system_cpu_seconds": u.sysCPU,
+	}
+}
+
+// writeProcessMetrics prints the totals as one human-readable line.
+func writeProcessMetrics(w io.Writer, u *processUsage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	fmt.Fprintf(w, "python processes: %d, peak RSS %.1f MiB, CPU %.2fs user + %.2fs system\n",
+		u.processes, float64(u.maxRSSBytes)/(1<<20), u.userCPU, u.sysCPU)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// queryGroup is the hits found for one of the -texts.
+type queryGroup struct {
+	Query   string     `json:"query"`
+	Results []queryHit `json:"results"`
+}
+
+// multiQueryOptions are the query flags that shape -texts output.
+type multiQueryOptions struct {
+	maxDistance  float64
+	minResults   int
+	asSimilarity bool
+	format       hitFormat
+	out          string
+}
+
+// multiQuery runs query_documents.py once for all of queries, given in
+// scriptArgs as --texts, and prints the hits grouped under each query text.
+func (c *commonFlags) multiQuery(ctx context.Context, python string, scriptArgs, queries []string, opts multiQueryOptions) (summary, error) {
+	result, ran, err := c.runScript(ctx, python, "query_documents.py", scriptArgs)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+	parsed, err := pvdb.ParseMultiQueryResult(result.Stdout, len(queries))
+	if err != nil {
+		return nil, err
+	}
+	if w := parsed.EmbeddingModelWarning; w != "" {
+		fmt.Fprintf(cli.stderr, "WARNING: %s; distances are not meaningful\n", w)
+	}
+
+	// Every result set comes from the same collection, so one warning does
+	if metric := parsed.Results[0].DistanceMetric; opts.asSimilarity && metric != "cosine" {
+		warnNotCosine(c.collection, metric)
+	}
+	groups := make([]queryGroup, len(queries))
+	found := 0
+	for i, r := range parsed.Results {
+		hits := queryHits(r, opts.maxDistance)
+		if opts.asSimilarity {
+			for j := range hits {
+				if hits[j].Metric == "cosine" {
+					similarity := cosineSimilarity(hits[j].Distance)
+					hits[j].Similarity = &similarity
+				}
+			}
+		}
+		groups[i] = queryGroup{Query: queries[i], Results: hits}
+		found += len(hits)
+	}
+	audit.Documents = found
+	// Every group is reported before failing on the first short one
+	var short error
+	for _, g := range groups {
+		if short = requireResults(g.Query, len(g.Results), opts.minResults); short != nil {
+			break
+		}
+	}
+
+	if opts.out != "" {
+		if err := writeJSONArray(opts.out, groups); err != nil {
+			return nil, err
+		}
+		if opts.out != "-" {
+			fmt.Fprintf(cli.stderr, "wrote %d results for %d queries to %s\n", found, len(groups), opts.out)
+		}
+	}
+	if jsonOutput {
+		sum := summary{"groups": groups}
+		if opts.out != "" {
+			sum = summary{"out": opts.out, "written": found}
+		}
+		if w := parsed.EmbeddingModelWarning; w != "" {
+			sum["embedding_model_warning"] = w
+		}
+		return sum, short
+	}
+	if opts.out != "" {
+		return nil, short
+	}
+	if opts.format.layout == formatNDJSON {
+		for _, g := range groups {
+			for _, h := range g.Results {
+				line := struct {
+					Query string `json:"query"`
+					queryHit
+				}{g.Query, h}
+				if err := writeJSONLine(cli.stdout, line); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, short
+	}
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(cli.stdout)
+		}
+		switch {
+		case opts.format.layout == formatMarkdown && len(g.Results) == 0:
+			fmt.Fprintf(cli.stdout, "### %s\n\nNo results.\n", escapeMarkdown(strconv.Quote(g.Query)))
+		case opts.format.layout == formatMarkdown:
+			fmt.Fprintf(cli.stdout, "### %s\n\n", escapeMarkdown(strconv.Quote(g.Query)))
+		case len(g.Results) == 0:
+			fmt.Fprintf(cli.stdout, "query %s:\n  no results\n", strconv.Quote(g.Query))
+		default:
+			fmt.Fprintf(cli.stdout, "query %s:\n", strconv.Quote(g.Query))
+		}
+		for _, h := range g.Results {
+			if err := opts.format.print(cli.stdout, h, "  "); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, short
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// wantsNDJSON reports whether args ask for -format ndjson, whose stdout is
+// for machines like that of -json.
+func wantsNDJSON(args []string) bool {
+	format, _ := flagArg(args, "format")
+	return format == formatNDJSON
+}
+
+// writeJSONLine writes v to w as one line of JSON and flushes it, so a
+// consumer reading line by line gets each hit as soon as it is printed
+// rather than when a buffer fills.
+func writeJSONLine(w io.Writer, v any) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// openAIConfig is the -openai-config credentials file.
+type openAIConfig struct {
+	APIKey       string `json:"api_key"`
+	Organization string `json:"organization"`
+	BaseURL      string `json:"base_url"`
+}
+
+// loadOpenAIConfig reads the credentials file at path, which must be a JSON
+// object with at least api_key.
+func loadOpenAIConfig(path string) (openAIConfig, error) {
+	var cfg openAIConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s is not valid JSON: %w", path, err)
+	}
+	if strings.TrimSpace(cfg.APIKey) == "" {
+		return cfg, fmt.Errorf("%s has no api_key", path)
+	}
+	return cfg, nil
+}
+
+// env maps the file onto the variables the OpenAI client reads, leaving out
+// the fields that aren't set.
+func (cfg openAIConfig) env() map[string]string {
+	env := map[string]string{"OPENAI_API_KEY": cfg.APIKey}
+	if cfg.Organization != "" {
+		env["OPENAI_ORG_ID"] = cfg.Organization
+	}
+	if cfg.BaseURL != "" {
+		env["OPENAI_BASE_URL"] = cfg.BaseURL
+	}
+	return env
+}
+
+// openAIConfigFlag defines -openai-config on fs. The file is read and checked
+// while parsing, and its values override OPENAI_* variables from the
+// environment or the env file.
+func (c *commonFlags) openAIConfigFlag(fs *flag.FlagSet) {
+	fs.Func("openai-config", "JSON file with {api_key, organization, base_url} passed to the scripts as OPENAI_API_KEY, OPENAI_ORG_ID and OPENAI_BASE_URL", func(path string) error {
+		if path == "" {
+			return errors.New("must not be empty")
+		}
+		cfg, err := loadOpenAIConfig(path)
+		if err != nil {
+			return err
+		}
+		c.openAIEnv = cfg.env()
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+)
+
+// invocation is the state of one call of run that it sets from its own
+// arguments. run starts every call from a fresh one, so a call made after
+// another in the same process, as the tests make, inherits nothing from it.
+type invocation struct {
+	// stdout and stderr are where the CLI writes: the writers run is given.
+	stdout, stderr io.Writer
+	// passthroughArgs are the arguments after -- on the command line. They
+	// are appended verbatim to every script invocation without validation.
+	passthroughArgs []string
+}
+
+// cli is the invocation in progress. Outside run it writes to the
+// process's own stdout and stderr.
+var cli = invocation{stdout: os.Stdout, stderr: os.Stderr}
+
+// jsonOutput is set by -json. Stdout then carries a single JSON object
+// describing the outcome and human-readable lines move to stderr.
+var jsonOutput bool
+
+// jsonFlag defines -json on fs.
+func jsonFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&jsonOutput, "json", false, "print a single JSON outcome object on stdout and send human-readable output to stderr")
+}
+
+// wantsJSON reports whether args request -json, for failures that happen
+// before a subcommand has parsed its flags.
+func wantsJSON(args []string) bool {
+	return boolFlagGiven(args, "json")
+}
+
+// mergeOutput is set by -merge-output. Scripts then write stdout and stderr
+// to a single pipe, so their lines keep the order they were written in.
+var mergeOutput bool
+
+// mergeOutputFlag defines -merge-output on fs.
+func mergeOutputFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&mergeOutput, "merge-output", false, "interleave the script's stderr with its stdout in the order written, for debugging; output parsed by pvdb may then fail to parse, and -json is refused")
+}
+
+// boolFlagGiven reports whether args, up to a --, set the boolean flag name.
+func boolFlagGiven(args []string, name string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "-" + name, "--" + name, "-" + name + "=true", "--" + name + "=true":
+			return true
+		}
+	}
+	return false
+}
+
+// humanOut is where human-readable status lines go.
+func humanOut() io.Writer {
+	if jsonOutput {
+		return cli.stderr
+	}
+	return cli.stdout
+}
+
+// summary holds the fields a successful subcommand reports in -json mode.
+type summary map[string]any
+
+// writeOutcome writes the -json outcome object: {"status":"ok", ...sum} on
+// success, {"status":"error","code":N,"message":"...", ...sum} otherwise,
+// with a "stderr_tail" when a script failed. Either gains
+// "output_truncated":true when a script's output exceeded -max-output-bytes.
+func writeOutcome(w io.Writer, sum summary, err error, code int) error {
+	outcome := map[string]any{}
+	for k, v := range sum {
+		outcome[k] = v
+	}
+	if err != nil {
+		outcome["status"] = "error"
+		outcome["code"] = code
+		outcome["message"] = err.Error()
+		var scriptErr *scriptError
+		if errors.As(err, &scriptErr) {
+			if tail := tailLines(scriptErr.stderr, errorContext); tail != "" {
+				outcome["stderr_tail"] = tail
+			}
+		}
+	} else {
+		outcome["status"] = "ok"
+	}
+	if outputTruncated.Load() {
+		outcome["output_truncated"] = true
+	}
+	if processMetricsOutput {
+		outcome["process_metrics"] = childUsage.snapshot()
+	}
+	return json.NewEncoder(w).Encode(outcome)
+}
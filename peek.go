@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// storedDocument is one document as the read-only scripts report it.
+type storedDocument struct {
+	ID       string         `json:"id"`
+	Document string         `json:"document"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// runPeek handles `pvdb peek -n 10`, showing the first stored documents as a
+// table.
+func runPeek(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("peek")
+	n := fs.Int("n", 5, "number of documents to show")
+	width := fs.Int("width", 60, "maximum characters of each document to show")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *n <= 0 {
+		return nil, invalidArgsf("-n must be positive, got %d", *n)
+	}
+	if *width <= 0 {
+		return nil, invalidArgsf("-width must be positive, got %d", *width)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	result, ran, err := common.runScript(ctx, python, "peek_documents.py", []string{strconv.Itoa(*n)})
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+
+	var docs []storedDocument
+	if err := json.Unmarshal([]byte(result.Stdout), &docs); err != nil {
+		return nil, fmt.Errorf("peek_documents.py returned invalid JSON: %w", err)
+	}
+	if jsonOutput {
+		return summary{"collection": common.collection, "documents": docs}, nil
+	}
+	printDocumentTable(docs, *width)
+	return nil, nil
+}
+
+// printDocumentTable renders docs as an aligned table, clipping each
+// document to width characters.
+func printDocumentTable(docs []storedDocument, width int) {
+	tw := tabwriter.NewWriter(humanOut(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDOCUMENT\tMETADATA")
+	for _, d := range docs {
+		meta, _ := json.Marshal(d.Metadata)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", d.ID, truncateRunes(singleLine(d.Document), width), meta)
+	}
+	tw.Flush()
+}
+
+// truncateRunes clips s to at most n runes, marking the cut with an ellipsis.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// singleLine folds tabs and newlines into spaces so s fits in one table cell.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,40 @@
+import chromadb
+import json
+import sys
+
+from add_documents import get_existing_collection, split_named_args, open_client
+
+def peek_collection(collection, limit):
+    results = collection.peek(limit=limit)
+    docs = []
+    for i, doc_id in enumerate(results["ids"]):
+        docs.append({
+            "id": doc_id,
+            "document": results["documents"][i],
+            "metadata": results["metadatas"][i],
+        })
+    return docs
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+
+        # Check if the limit argument is provided
+        if len(args) != 1:
+            raise ValueError("Usage: python peek_documents.py <limit> [--collection=NAME]")
+
+        limit = int(args[0])
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Get the Chroma collection, which a read never creates
+        collection = get_existing_collection(client, options.get("collection", "documents"))
+
+        print(json.dumps(peek_collection(collection, limit)))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
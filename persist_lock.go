@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// readOnlyCommands are the subcommands that only read the store. They take a
+// shared lock on the persist dir, which any number of readers can hold at
+// once; every other subcommand takes an exclusive one. Their scripts get the
+// collection with get_existing_collection, never creating it.
+var readOnlyCommands = []string{"query", "search", "count", "stats", "export", "collections", "diff", "get", "peek", "sample", "recent", "query-bench"}
+
+// sharedPersistLock is set by main when the subcommand is read-only.
+var sharedPersistLock bool
+
+// persistLocks holds the open persist dirs this process has locked, by
+// absolute path. The locks are held until the process exits, which releases
+// them even when it is killed by a signal.
+var persistLocks = struct {
+	mu    sync.Mutex
+	files map[string]*os.File
+}{files: map[string]*os.File{}}
+
+// persistLockedError reports a persist dir another process holds a
+// conflicting lock on.
+type persistLockedError struct {
+	dir string
+}
+
+func (e *persistLockedError) Error() string {
+	return fmt.Sprintf("persist dir is locked by another process: %s", e.dir)
+}
+
+// lockPersistDir takes an advisory lock on dir, shared or exclusive as
+// sharedPersistLock says, failing at once rather than waiting when another
+// process holds a conflicting one. SQLite-backed Chroma stores are corrupted
+// by two processes writing them at the same time. Locking a dir this process
+// already holds is a no-op.
+func lockPersistDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	persistLocks.mu.Lock()
+	defer persistLocks.mu.Unlock()
+	if persistLocks.files[abs] != nil {
+		return nil
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return fmt.Errorf("cannot lock persist dir: %w", err)
+	}
+	locked, err := flockDir(f, sharedPersistLock)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("cannot lock persist dir: %w", err)
+	}
+	if !locked {
+		f.Close()
+		return &persistLockedError{dir: dir}
+	}
+	persistLocks.files[abs] = f
+	return nil
+}
+
+// releasePersistLocks releases every persist dir lock this process holds.
+func releasePersistLocks() {
+	persistLocks.mu.Lock()
+	defer persistLocks.mu.Unlock()
+	for path, f := range persistLocks.files {
+		f.Close()
+		delete(persistLocks.files, path)
+	}
+}
+
+// persistWriters serializes the scripts of this process writing to each
+// on-disk store, by absolute persist dir. The flock only keeps other
+// processes out, not the concurrent requests serve handles.
+var persistWriters = struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}{slots: map[string]chan struct{}{}}
+
+// acquirePersistWrite blocks until no other script of this process is
+// writing to the store in dir, or ctx is done, and returns the func that
+// lets the next writer in.
+func acquirePersistWrite(ctx context.Context, dir string) (release func(), err error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	persistWriters.mu.Lock()
+	slot := persistWriters.slots[abs]
+	if slot == nil {
+		slot = make(chan struct{}, 1)
+		persistWriters.slots[abs] = slot
+	}
+	persistWriters.mu.Unlock()
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
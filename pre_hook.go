@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// preHook is the -pre-hook command, run on each payload before it is
+// ingested. It reads the payload as a {documents, metadatas, ids} JSON object
+// on stdin, with embeddings when the input had any, and writes the object to
+// ingest, in the same shape, on stdout. A hook that exits non-zero aborts the
+// ingestion.
+type preHook []string
+
+// parsePreHook splits command into a program and its arguments like a shell
+// would, honouring single and double quotes and backslash escapes, but
+// without expanding anything: the hook is run directly rather than through
+// a shell.
+func parsePreHook(command string) (preHook, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	switch {
+	case quote != 0:
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, command)
+	case escaped:
+		return nil, fmt.Errorf("trailing backslash in %q", command)
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return preHook(args), nil
+}
+
+// run pipes p through the hook and returns the payload it printed. The
+// hook's stderr is passed through so it can explain a rejection.
+func (h preHook) run(ctx context.Context, p ingestPayload) (ingestPayload, error) {
+	defer trace.child("pre-hook").end()
+	input, err := json.Marshal(p)
+	if err != nil {
+		return p, err
+	}
+	cmd := exec.CommandContext(ctx, h[0], h[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = cli.stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return p, invalidArgsf("-pre-hook %s rejected the payload: %v", h[0], err)
+	case err != nil:
+		return p, invalidArgsf("cannot run -pre-hook: %w", err)
+	}
+	var transformed ingestPayload
+	dec := json.NewDecoder(bytes.NewReader(out))
+	if strictJSON {
+		err = decodeStrict(dec, &transformed)
+	} else {
+		err = dec.Decode(&transformed)
+	}
+	if err != nil {
+		return p, invalidArgsf("-pre-hook %s printed an invalid payload: %w", h[0], err)
+	}
+	return transformed, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"sync"
+)
+
+// logPrefixFlag defines -log-prefix on fs. main reads it with flagArg before
+// the subcommand parses its flags, so the value is not kept here.
+func logPrefixFlag(fs *flag.FlagSet) {
+	fs.String("log-prefix", "", "string to start every line pvdb writes with, such as a shard name, to tell the output of several runs apart (ignored with -json)")
+}
+
+// prefixWriter writes through to w, starting every line with prefix. It is
+// safe for concurrent use; each Write is passed on whole, so lines written by
+// different goroutines keep their prefix as long as each writes full lines.
+type prefixWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	prefix  []byte
+	midLine bool
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var buf bytes.Buffer
+	for rest := b; len(rest) > 0; {
+		if !p.midLine {
+			buf.Write(p.prefix)
+		}
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		buf.Write(line)
+		rest = rest[len(line):]
+		p.midLine = line[len(line)-1] != '\n'
+	}
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
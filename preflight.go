@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// preflight describes an ingestion before any batch is launched.
+type preflight struct {
+	Documents  int     `json:"documents"`
+	Characters int     `json:"characters"`
+	Tokens     int     `json:"tokens"`
+	Batches    int     `json:"batches"`
+	Cost       float64 `json:"cost"`
+}
+
+// newPreflight sizes p as it will be ingested in batches of batchSize. The
+// cost is estimated at OpenAI's default price and is zero for the local
+// embedder.
+func newPreflight(p ingestPayload, batchSize int, embedder string) preflight {
+	price := defaultPricePer1K
+	if embedder == embedderLocal {
+		price = 0
+	}
+	f := preflight{Documents: len(p.Documents), Batches: (len(p.Documents) + batchSize - 1) / batchSize}
+	for _, doc := range p.Documents {
+		f.Characters += utf8.RuneCountInString(doc)
+	}
+	f.Tokens, f.Cost = estimateCost(documentsToEmbed(p), price)
+	return f
+}
+
+// confirmPreflight prints f and, unless yes is set, asks on stdin whether to
+// go ahead. It reports false when the user declines; a stdin that is not a
+// terminal cannot answer, so -yes is then required.
+func confirmPreflight(f preflight, stdin *os.File, yes bool) (bool, error) {
+	fmt.Fprintf(humanOut(), "pre-flight: %d documents, %d characters, about %d tokens (estimated cost $%.6f) in %d batches\n", f.Documents, f.Characters, f.Tokens, f.Cost, f.Batches)
+	if yes {
+		return true, nil
+	}
+	if !isTerminal(stdin) {
+		return false, invalidArgs(errors.New("refusing to ingest without confirmation; pass -yes when stdin is not a terminal"))
+	}
+	return confirm(stdin, "Ingest? [y/N] ")
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// maxRSSBytes is 0 where the peak resident set size isn't reported.
+func maxRSSBytes(state *os.ProcessState) int64 {
+	return 0
+}
+
+// runningAsRoot is false where Unix user ids don't apply, such as Windows.
+func runningAsRoot() bool {
+	return false
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// maxRSSBytes is the peak resident set size of the exited process behind
+// state, or 0 when it is unknown. Darwin reports ru_maxrss in bytes, the
+// other Unixes in kilobytes.
+func maxRSSBytes(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
+
+// runningAsRoot reports whether pvdb runs with an effective user id of 0.
+func runningAsRoot() bool {
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// maxConcurrentProcessesFlag defines -max-concurrent-processes on fs, which
+// bounds how many Python processes run at once across every code path,
+// whatever mix of batch concurrency and query fan-out produced them. The
+// slots are the library's, see pvdb.AcquireProcess.
+func maxConcurrentProcessesFlag(fs *flag.FlagSet) {
+	usage := fmt.Sprintf("maximum Python processes to run at once across the whole command (default %d, the number of CPUs)", runtime.NumCPU())
+	fs.Func("max-concurrent-processes", usage, func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("want a positive number of processes, got %q", value)
+		}
+		return pvdb.SetMaxProcesses(n)
+	})
+}
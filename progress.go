@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// progress reports completed batches of a long ingestion. It is not safe for
+// concurrent use; callers serialise calls to batchDone.
+type progress struct {
+	out                io.Writer
+	batches, documents int
+	doneBatches        int
+	doneDocuments      int
+	// latencies holds how long each completed batch took, in completion
+	// order.
+	latencies []time.Duration
+	// checkpoint, if set, is advanced as batches complete.
+	checkpoint *checkpoint
+}
+
+// newProgress tracks an ingestion of documents split into batches, writing a
+// line per batch to out.
+func newProgress(out io.Writer, batches, documents int) *progress {
+	return &progress{out: out, batches: batches, documents: documents}
+}
+
+// throttled notes that the next batch is waiting on the -rate-limit.
+func (p *progress) throttled() {
+	fmt.Fprintf(p.out, "[batch %d/%d] waiting on the rate limiter\n", p.doneBatches+1, p.batches)
+}
+
+// batchDone records that batch i, of n documents, took took to ingest.
+func (p *progress) batchDone(i, n int, took time.Duration) {
+	if p.checkpoint != nil {
+		if err := p.checkpoint.batchDone(i); err != nil {
+			slog.Warn("cannot update the checkpoint; a resumed run will repeat this batch", "err", err)
+		}
+	}
+	p.doneBatches++
+	p.doneDocuments += n
+	p.latencies = append(p.latencies, took)
+	fmt.Fprintf(p.out, "[batch %d/%d] %d/%d documents (took %s)\n",
+		p.doneBatches, p.batches, p.doneDocuments, p.documents, took.Round(100*time.Millisecond))
+}
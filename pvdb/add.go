@@ -0,0 +1,41 @@
+package pvdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AddResult is the summary add_documents.py prints for a batch: how many
+// documents it stored, how many it skipped because their ids were already
+// in the collection and how many it failed to store.
+type AddResult struct {
+	Added   int `json:"added"`
+	Skipped int `json:"skipped"`
+	Errors  int `json:"errors"`
+	// Unknown is set when a batch succeeded without printing a readable
+	// summary, so the counts leave it out.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// ParseAddResult decodes add_documents.py's stdout, whose last line is its
+// JSON summary.
+func ParseAddResult(stdout string) (AddResult, error) {
+	var r AddResult
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &r); err != nil {
+		return r, fmt.Errorf("add_documents.py printed an invalid summary: %w", err)
+	}
+	if r.Added < 0 || r.Skipped < 0 || r.Errors < 0 {
+		return r, fmt.Errorf("add_documents.py printed negative counts: %+v", r)
+	}
+	return r, nil
+}
+
+// Merge adds the counts of b, the result of another batch, to r.
+func (r *AddResult) Merge(b AddResult) {
+	r.Added += b.Added
+	r.Skipped += b.Skipped
+	r.Errors += b.Errors
+	r.Unknown = r.Unknown || b.Unknown
+}
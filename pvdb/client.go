@@ -0,0 +1,341 @@
+// Package pvdb drives the persistant-vector-db Python scripts from Go, so
+// services can ingest and query a Chroma store without shelling out to the
+// pvdb CLI. A Client validates and batches payloads, builds each script
+// invocation and runs it under the caller's context: when the context is
+// cancelled or its deadline passes, the running script is killed and no
+// further batches are started.
+package pvdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults a Client starts from before its options are applied.
+const (
+	DefaultPythonBin      = "python3"
+	DefaultCollection     = "documents"
+	DefaultPersistDir     = "db"
+	DefaultEmbedder       = "openai"
+	DefaultEmbeddingModel = "text-embedding-3-small"
+	DefaultTimeout        = 60 * time.Second
+	DefaultBatchSize      = 256
+)
+
+// collectionNamePattern mirrors the collection names Chroma accepts.
+var collectionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,63}$`)
+
+// Client runs the scripts against one collection of one store. It is safe
+// for concurrent use by goroutines working on different collections; calls
+// writing to the same embedded store should not overlap.
+type Client struct {
+	python         string
+	scriptDir      string
+	persistDir     string
+	collection     string
+	embedder       string
+	embeddingModel string
+	timeout        time.Duration
+	batchSize      int
+	env            []string
+	runner         Runner
+	// namedArgs is nil until WithNamedArgs sets it, leaving the argument
+	// contract to be detected.
+	namedArgs *bool
+
+	// contracts caches the detected argument contract of each script, by
+	// name: true for named arguments.
+	contractsMu sync.Mutex
+	contracts   map[string]bool
+}
+
+// Option configures a Client in New.
+type Option func(*Client)
+
+// WithPythonBin sets the interpreter the scripts run with.
+func WithPythonBin(bin string) Option {
+	return func(c *Client) { c.python = bin }
+}
+
+// WithScriptDir sets the directory holding the Python scripts. It defaults
+// to the working directory.
+func WithScriptDir(dir string) Option {
+	return func(c *Client) { c.scriptDir = dir }
+}
+
+// WithPersistDir sets the directory holding the persistent Chroma store.
+func WithPersistDir(dir string) Option {
+	return func(c *Client) { c.persistDir = dir }
+}
+
+// WithCollection sets the Chroma collection the Client operates on.
+func WithCollection(name string) Option {
+	return func(c *Client) { c.collection = name }
+}
+
+// WithEmbedder sets the embedding backend, openai or local, and the OpenAI
+// model used by the openai backend.
+func WithEmbedder(embedder, model string) Option {
+	return func(c *Client) { c.embedder, c.embeddingModel = embedder, model }
+}
+
+// WithTimeout bounds each script run.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithBatchSize sets the maximum documents per add_documents.py run.
+func WithBatchSize(n int) Option {
+	return func(c *Client) { c.batchSize = n }
+}
+
+// WithEnv adds KEY=VALUE variables, such as OPENAI_API_KEY, to the scripts'
+// environment on top of the process's own.
+func WithEnv(env ...string) Option {
+	return func(c *Client) { c.env = append(c.env, env...) }
+}
+
+// WithRunner sets the Runner the scripts are launched with, so a program
+// running scripts of its own gives the Client the same interpreter
+// arguments, kill grace, cancel signal and output cap.
+func WithRunner(r Runner) Option {
+	return func(c *Client) { c.runner = r }
+}
+
+// WithNamedArgs sets whether Add and Update pass the payload as named
+// arguments, see Payload.ScriptArgs. Without it, each script's --help usage
+// decides, and positional arguments are used when it doesn't tell.
+func WithNamedArgs(named bool) Option {
+	return func(c *Client) { c.namedArgs = &named }
+}
+
+// New returns a Client configured by opts. It fails when the options are
+// invalid; the store itself is not touched until the first call.
+func New(opts ...Option) (*Client, error) {
+	c := &Client{
+		python:         DefaultPythonBin,
+		persistDir:     DefaultPersistDir,
+		collection:     DefaultCollection,
+		embedder:       DefaultEmbedder,
+		embeddingModel: DefaultEmbeddingModel,
+		timeout:        DefaultTimeout,
+		batchSize:      DefaultBatchSize,
+		contracts:      map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if !collectionNamePattern.MatchString(c.collection) {
+		return nil, fmt.Errorf("invalid collection name %q: must be 3-63 characters from [a-zA-Z0-9._-]", c.collection)
+	}
+	if c.embedder != "openai" && c.embedder != "local" {
+		return nil, fmt.Errorf("unknown embedder %q, want openai or local", c.embedder)
+	}
+	if c.timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive, got %s", c.timeout)
+	}
+	if c.batchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", c.batchSize)
+	}
+	if c.persistDir == "" {
+		return nil, errors.New("persist dir must not be empty")
+	}
+	// The scripts run in the script dir, so Go and Python must agree on an
+	// absolute path
+	dir, err := filepath.Abs(c.persistDir)
+	if err != nil {
+		return nil, err
+	}
+	c.persistDir = dir
+	return c, nil
+}
+
+// ScriptError reports a script that exited non-zero, with what it wrote to
+// stderr.
+type ScriptError struct {
+	Script   string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *ScriptError) Error() string {
+	msg := fmt.Sprintf("%s exited with code %d", e.Script, e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Add embeds and stores docs with their metadatas under ids, in batches of
+// the configured size, and returns what add_documents.py reports storing.
+// It stops at the first batch that fails. A batch that succeeds without a
+// readable summary is logged and marks the result Unknown.
+func (c *Client) Add(ctx context.Context, docs []string, metas []map[string]any, ids []string) (AddResult, error) {
+	var result AddResult
+	err := c.ingest(ctx, "add_documents.py", Payload{Documents: docs, Metadatas: metas, IDs: ids}, func(stdout string) {
+		r, err := ParseAddResult(stdout)
+		if err != nil {
+			slog.Warn("counts of an added batch are unknown", "err", err)
+			r = AddResult{Unknown: true}
+		}
+		result.Merge(r)
+	})
+	return result, err
+}
+
+// Update replaces the documents and metadatas stored under ids.
+func (c *Client) Update(ctx context.Context, docs []string, metas []map[string]any, ids []string) error {
+	return c.ingest(ctx, "update_documents.py", Payload{Documents: docs, Metadatas: metas, IDs: ids}, nil)
+}
+
+// ingest runs script once per batch of p, passing the stdout of each batch
+// that succeeds to done when it is not nil. Once ctx is done it stops
+// between batches, returning ctx.Err() wrapped with the batch it did not
+// start, or kills the batch in flight and wraps ctx.Err() with its index.
+func (c *Client) ingest(ctx context.Context, script string, p Payload, done func(stdout string)) error {
+	if err := Validate(p); err != nil {
+		return err
+	}
+	named := c.payloadNamedArgs(ctx, script)
+	for i, batch := range SplitBatches(p, c.batchSize) {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("batch %d not started: %w", i, err)
+		}
+		args, err := batch.ScriptArgs(named)
+		if err != nil {
+			return err
+		}
+		stdout, err := c.run(ctx, script, args, true)
+		if err != nil {
+			return fmt.Errorf("batch %d: %w", i, err)
+		}
+		if done != nil {
+			done(stdout)
+		}
+	}
+	return nil
+}
+
+// Query returns the k documents closest to text.
+func (c *Client) Query(ctx context.Context, text string, k int) (QueryResult, error) {
+	if k <= 0 {
+		return QueryResult{}, fmt.Errorf("k must be positive, got %d", k)
+	}
+	stdout, err := c.run(ctx, "query_documents.py", []string{text, strconv.Itoa(k)}, true)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	return ParseQueryResult(stdout)
+}
+
+// Count returns how many documents the collection holds.
+func (c *Client) Count(ctx context.Context) (int, error) {
+	stdout, err := c.run(ctx, "count_documents.py", nil, false)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		return 0, fmt.Errorf("count_documents.py printed %q, not a document count", stdout)
+	}
+	return n, nil
+}
+
+// Delete removes the documents stored under ids.
+func (c *Client) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return errors.New("no ids to delete")
+	}
+	encoded, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	_, err = c.run(ctx, "delete_documents.py", []string{string(encoded)}, false)
+	return err
+}
+
+// payloadNamedArgs reports whether script takes the ingestion payload as
+// named arguments: as WithNamedArgs says when it was given, otherwise as the
+// script's --help usage shows. A script whose usage can't be read gets
+// positional arguments, which every script accepts, and is asked again on
+// the next call.
+func (c *Client) payloadNamedArgs(ctx context.Context, script string) bool {
+	if c.namedArgs != nil {
+		return *c.namedArgs
+	}
+	c.contractsMu.Lock()
+	defer c.contractsMu.Unlock()
+	if named, ok := c.contracts[script]; ok {
+		return named
+	}
+	stdout, err := c.launch(ctx, script, []string{"--help"})
+	named, ok := ParseContract(stdout)
+	if !ok {
+		slog.Debug("cannot tell the argument contract of the script; passing the payload as positional arguments", "script", script, "err", err)
+		return false
+	}
+	c.contracts[script] = named
+	return named
+}
+
+// run launches script with args followed by the store's named arguments and,
+// when embeds is set, the embedder's, and returns its stdout.
+func (c *Client) run(ctx context.Context, script string, args []string, embeds bool) (string, error) {
+	if err := os.MkdirAll(c.persistDir, 0o755); err != nil {
+		return "", fmt.Errorf("cannot create persist dir: %w", err)
+	}
+	args = append(args, "--collection="+c.collection, "--persist-dir="+c.persistDir)
+	if embeds {
+		args = append(args, "--embedder="+c.embedder, "--embedding-model="+c.embeddingModel)
+	}
+	return c.launch(ctx, script, args)
+}
+
+// launch runs script with exactly args through the Client's Runner and
+// returns its stdout. It waits for a process slot first, see
+// AcquireProcess. The script is killed when ctx is done or the Client's
+// timeout passes, and the context's error is returned.
+func (c *Client) launch(ctx context.Context, script string, args []string) (string, error) {
+	path, err := filepath.Abs(filepath.Join(c.scriptDir, script))
+	if err != nil {
+		return "", err
+	}
+	if err := AcquireProcess(ctx); err != nil {
+		return "", fmt.Errorf("%s: %w", script, err)
+	}
+	defer ReleaseProcess()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	cmd := c.runner.Command(ctx, c.python, path, filepath.Dir(path), args)
+	// Stdout is decoded as UTF-8 whatever the locale
+	cmd.Env = append(os.Environ(), "PYTHONIOENCODING=utf-8", "CHROMA_PERSIST_DIR="+c.persistDir)
+	cmd.Env = append(cmd.Env, c.env...)
+
+	result, err := c.runner.Run(cmd, nil, nil)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s: %w", script, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return result.Stdout, &ScriptError{Script: script, ExitCode: exitErr.ExitCode(), Stderr: result.Stderr}
+	}
+	if err != nil {
+		return "", err
+	}
+	if result.Truncated {
+		slog.Warn("script output truncated", "script", script)
+	}
+	return result.Stdout, nil
+}
@@ -0,0 +1,75 @@
+//go:build unix
+
+package pvdb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// slowScript records its pid in the file named by PID_FILE, then sleeps far
+// past any deadline the tests set.
+const slowScript = `import os
+import time
+
+with open(os.environ["PID_FILE"], "w") as f:
+    f.write(str(os.getpid()))
+time.sleep(60)
+`
+
+func TestAddKillsScriptAtDeadline(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not found")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "add_documents.py"), []byte(slowScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pidFile := filepath.Join(dir, "pid")
+	c, err := New(
+		WithPythonBin(python),
+		WithScriptDir(dir),
+		WithPersistDir(filepath.Join(dir, "db")),
+		WithEnv("PID_FILE="+pidFile),
+		WithNamedArgs(false),
+		WithRunner(Runner{KillGrace: 100 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.Add(ctx, []string{"jolof rice"}, []map[string]any{{"topic": "recipes"}}, []string{"id1"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Add returned %v, want context.DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "batch 0") {
+		t.Errorf("error %q does not name the batch in flight", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Add took %s to return after its deadline", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("the script never started: %v", err)
+	}
+	pid, err := strconv.Atoi(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("script process %d is still there after Add returned (kill: %v)", pid, err)
+	}
+}
@@ -0,0 +1,36 @@
+package pvdb
+
+import "strings"
+
+// ParseContract reads from an ingestion script's --help usage whether it
+// takes the payload as named arguments, see Payload.ScriptArgs. The usage is
+// the text from the first "usage:" to the next blank line, as both argparse
+// and the hand-written scripts print it. A usage with a --documents option
+// takes named arguments. One with a documents or <documents> placeholder
+// takes positional ones, which win when both forms are listed since they are
+// the default. ok is false when the usage names neither.
+func ParseContract(help string) (named, ok bool) {
+	start := strings.Index(strings.ToLower(help), "usage:")
+	if start < 0 {
+		return false, false
+	}
+	usage := help[start+len("usage:"):]
+	if end := strings.Index(usage, "\n\n"); end >= 0 {
+		usage = usage[:end]
+	}
+	positional := false
+	for _, word := range strings.Fields(usage) {
+		word = strings.Trim(word, "[](){}|,")
+		name, _, _ := strings.Cut(word, "=")
+		switch {
+		case name == "--documents":
+			named = true
+		case word == "documents" || word == "<documents>":
+			positional = true
+		}
+	}
+	if positional {
+		return false, true
+	}
+	return named, named
+}
@@ -0,0 +1,162 @@
+package pvdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Payload holds the parallel arrays add_documents.py expects.
+type Payload struct {
+	Documents []string         `json:"documents"`
+	Metadatas []map[string]any `json:"metadatas"`
+	IDs       []string         `json:"ids"`
+	// Embeddings optionally holds precomputed vectors, one per document; a
+	// nil entry leaves that document for Python to embed. It is nil when no
+	// document has one.
+	Embeddings [][]float64 `json:"embeddings,omitempty"`
+}
+
+// AppendFrom appends document i of q, with its embedding if q has any, to p.
+func (p *Payload) AppendFrom(q Payload, i int) {
+	if q.Embeddings != nil {
+		for len(p.Embeddings) < len(p.Documents) {
+			p.Embeddings = append(p.Embeddings, nil)
+		}
+		p.Embeddings = append(p.Embeddings, q.Embeddings[i])
+	}
+	p.Documents = append(p.Documents, q.Documents[i])
+	p.Metadatas = append(p.Metadatas, q.Metadatas[i])
+	p.IDs = append(p.IDs, q.IDs[i])
+}
+
+// ScriptArgs encodes the payload as the three positional JSON arguments of
+// add_documents.py or, with useNamedArgs, as --documents=, --metadatas= and
+// --ids= named arguments that don't depend on their order. Precomputed
+// embeddings always follow as a named --embeddings= argument.
+func (p Payload) ScriptArgs(useNamedArgs bool) ([]string, error) {
+	args := make([]string, 0, 3)
+	for _, a := range []struct {
+		name  string
+		value any
+	}{{"documents", p.Documents}, {"metadatas", p.Metadatas}, {"ids", p.IDs}} {
+		encoded, err := json.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		if useNamedArgs {
+			args = append(args, "--"+a.name+"="+string(encoded))
+		} else {
+			args = append(args, string(encoded))
+		}
+	}
+	if p.Embeddings != nil {
+		encoded, err := json.Marshal(p.Embeddings)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--embeddings="+string(encoded))
+	}
+	return args, nil
+}
+
+// Validate checks that the parallel ingestion arrays have equal length, that
+// every document has an id that appears only once, that the precomputed
+// embeddings share one dimensionality and that every metadata value is one
+// Chroma can store. The add and update paths share it so their
+// rules stay consistent.
+func Validate(p Payload) error {
+	var mismatches []string
+	if len(p.Metadatas) != len(p.Documents) {
+		mismatches = append(mismatches, fmt.Sprintf("%d metadatas", len(p.Metadatas)))
+	}
+	if len(p.IDs) != len(p.Documents) {
+		mismatches = append(mismatches, fmt.Sprintf("%d ids", len(p.IDs)))
+	}
+	if p.Embeddings != nil && len(p.Embeddings) != len(p.Documents) {
+		mismatches = append(mismatches, fmt.Sprintf("%d embeddings", len(p.Embeddings)))
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("got %d documents but %s", len(p.Documents), strings.Join(mismatches, " and "))
+	}
+
+	seen := make(map[string]int, len(p.IDs))
+	for i, id := range p.IDs {
+		if id == "" {
+			return fmt.Errorf("document at position %d has no id", i)
+		}
+		if first, ok := seen[id]; ok {
+			return fmt.Errorf("duplicate id %q at positions %d and %d", id, first, i)
+		}
+		seen[id] = i
+	}
+	if err := validateEmbeddings(p); err != nil {
+		return err
+	}
+	return validateMetadatas(p)
+}
+
+// validateEmbeddings checks that every precomputed embedding is non-empty
+// and has the dimensionality of the first one.
+func validateEmbeddings(p Payload) error {
+	dims, first := 0, ""
+	for i, embedding := range p.Embeddings {
+		switch {
+		case embedding == nil:
+		case len(embedding) == 0:
+			return fmt.Errorf("embedding of document %q is empty", p.IDs[i])
+		case dims == 0:
+			dims, first = len(embedding), p.IDs[i]
+		case len(embedding) != dims:
+			return fmt.Errorf("embedding of document %q has %d dimensions but that of %q has %d", p.IDs[i], len(embedding), first, dims)
+		}
+	}
+	return nil
+}
+
+// validateMetadatas checks that every metadata value is a string, number or
+// bool, the only types Chroma stores; nulls and nested values are rejected
+// with the offending id and key.
+func validateMetadatas(p Payload) error {
+	for i, meta := range p.Metadatas {
+		keys := make([]string, 0, len(meta))
+		for key := range meta {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			var kind string
+			switch meta[key].(type) {
+			case string, float64, bool:
+				continue
+			case nil:
+				kind = "null"
+			case []any:
+				kind = "an array"
+			default:
+				kind = "an object"
+			}
+			return fmt.Errorf("metadata %q of document %q is %s; Chroma only accepts strings, numbers and booleans", key, p.IDs[i], kind)
+		}
+	}
+	return nil
+}
+
+// SplitBatches cuts p into consecutive payloads of at most size documents.
+func SplitBatches(p Payload, size int) []Payload {
+	var batches []Payload
+	for start := 0; start < len(p.Documents); start += size {
+		end := min(start+size, len(p.Documents))
+		batch := Payload{
+			Documents: p.Documents[start:end],
+			Metadatas: p.Metadatas[start:end],
+			IDs:       p.IDs[start:end],
+		}
+		if p.Embeddings != nil {
+			batch.Embeddings = p.Embeddings[start:end]
+		}
+		batches = append(batches, batch)
+	}
+	return batches
+}
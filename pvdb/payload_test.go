@@ -0,0 +1,75 @@
+package pvdb
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScriptArgs(t *testing.T) {
+	p := Payload{
+		Documents: []string{"jolof rice", `a "quoted" --documents=x`},
+		Metadatas: []map[string]any{{"topic": "recipes"}, {}},
+		IDs:       []string{"id1", "id 2"},
+	}
+	withEmbeddings := p
+	withEmbeddings.Embeddings = [][]float64{{0.5, -1}, nil}
+
+	tests := []struct {
+		name  string
+		p     Payload
+		named bool
+		want  []string
+	}{
+		{
+			name: "positional",
+			p:    p,
+			want: []string{
+				`["jolof rice","a \"quoted\" --documents=x"]`,
+				`[{"topic":"recipes"},{}]`,
+				`["id1","id 2"]`,
+			},
+		},
+		{
+			name:  "named",
+			p:     p,
+			named: true,
+			want: []string{
+				`--documents=["jolof rice","a \"quoted\" --documents=x"]`,
+				`--metadatas=[{"topic":"recipes"},{}]`,
+				`--ids=["id1","id 2"]`,
+			},
+		},
+		{
+			name: "positional with embeddings",
+			p:    withEmbeddings,
+			want: []string{
+				`["jolof rice","a \"quoted\" --documents=x"]`,
+				`[{"topic":"recipes"},{}]`,
+				`["id1","id 2"]`,
+				`--embeddings=[[0.5,-1],null]`,
+			},
+		},
+		{
+			name:  "named with embeddings",
+			p:     withEmbeddings,
+			named: true,
+			want: []string{
+				`--documents=["jolof rice","a \"quoted\" --documents=x"]`,
+				`--metadatas=[{"topic":"recipes"},{}]`,
+				`--ids=["id1","id 2"]`,
+				`--embeddings=[[0.5,-1],null]`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.ScriptArgs(tt.named)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ScriptArgs(%t) =\n%q\nwant\n%q", tt.named, got, tt.want)
+			}
+		})
+	}
+}
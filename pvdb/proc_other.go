@@ -0,0 +1,14 @@
+//go:build !unix
+
+package pvdb
+
+import (
+	"os"
+	"os/exec"
+)
+
+// startInOwnGroup leaves cmd unchanged where process groups aren't
+// available; the script is killed directly when its context is done.
+func startInOwnGroup(cmd *exec.Cmd, signal func() os.Signal) (reap func()) {
+	return func() {}
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package pvdb
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startInOwnGroup runs cmd in a new process group. When its context is done
+// the whole group gets signal(), or SIGTERM when that is nil, and the script
+// has its WaitDelay to exit before it is killed. The returned func must be
+// called once cmd has been waited for: after a cancellation it kills
+// whatever is left of the group, so grandchildren of the script don't
+// linger.
+func startInOwnGroup(cmd *exec.Cmd, signal func() os.Signal) (reap func()) {
+	cancelled := false
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		cancelled = true
+		sig, ok := signal().(syscall.Signal)
+		if !ok {
+			sig = syscall.SIGTERM
+		}
+		return syscall.Kill(-cmd.Process.Pid, sig)
+	}
+	return func() {
+		if cancelled && cmd.Process != nil {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package pvdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// QueryResult is the columnar result query_documents.py prints: entry i of
+// each slice describes the i-th closest document.
+type QueryResult struct {
+	IDs       []string         `json:"ids"`
+	Documents []string         `json:"documents"`
+	Distances []float64        `json:"distances"`
+	Metadatas []map[string]any `json:"metadatas"`
+	// Embeddings holds the matched documents' vectors when they were asked
+	// for.
+	Embeddings [][]float64 `json:"embeddings,omitempty"`
+	// DistanceMetric is the collection's distance function: l2, cosine or
+	// ip.
+	DistanceMetric string `json:"distance_metric,omitempty"`
+	// Query is the text searched for, set on each result of a multi-text
+	// query.
+	Query string `json:"query,omitempty"`
+	// EmbeddingModelWarning is set when the collection was built with a
+	// different embedding model than the query used.
+	EmbeddingModelWarning string `json:"embedding_model_warning,omitempty"`
+	// Explain describes the search when it was asked for with --explain.
+	Explain *QueryExplanation `json:"explain,omitempty"`
+}
+
+// QueryExplanation is the context of a search: the size of the collection
+// searched and the embedding model and dimensions the distances were
+// measured with.
+type QueryExplanation struct {
+	CollectionSize int `json:"collection_size"`
+	// EmbeddingModel is the model the query was embedded with, empty for a
+	// query given as a vector.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// CollectionEmbeddingModel is the model the collection records it was
+	// built with, if any.
+	CollectionEmbeddingModel string `json:"collection_embedding_model,omitempty"`
+	// EmbeddingDimensions is 0 when no embedding was given, recorded or
+	// stored to tell it from.
+	EmbeddingDimensions int `json:"embedding_dimensions,omitempty"`
+}
+
+// ParseQueryResult decodes query_documents.py's stdout and checks that its
+// columns line up. Hits at equal distances are put in id order, so the same
+// query returns them in the same order on every run.
+func ParseQueryResult(stdout string) (QueryResult, error) {
+	var r QueryResult
+	if err := json.Unmarshal([]byte(stdout), &r); err != nil {
+		return r, fmt.Errorf("query_documents.py returned invalid JSON: %w", err)
+	}
+	if err := r.check(); err != nil {
+		return r, err
+	}
+	r.orderTies()
+	return r, nil
+}
+
+// MultiQueryResult is what query_documents.py prints for --texts: one
+// result per query text, in the order the texts were given.
+type MultiQueryResult struct {
+	Results               []QueryResult `json:"results"`
+	EmbeddingModelWarning string        `json:"embedding_model_warning,omitempty"`
+}
+
+// ParseMultiQueryResult decodes the --texts output of query_documents.py and
+// checks that it holds one well-formed result for each of the want texts.
+func ParseMultiQueryResult(stdout string, want int) (MultiQueryResult, error) {
+	var m MultiQueryResult
+	if err := json.Unmarshal([]byte(stdout), &m); err != nil {
+		return m, fmt.Errorf("query_documents.py returned invalid JSON: %w", err)
+	}
+	if len(m.Results) != want {
+		return m, fmt.Errorf("query_documents.py returned %d result sets for %d query texts", len(m.Results), want)
+	}
+	for i := range m.Results {
+		if err := m.Results[i].check(); err != nil {
+			return m, fmt.Errorf("result set %d: %w", i, err)
+		}
+		m.Results[i].orderTies()
+	}
+	return m, nil
+}
+
+// orderTies sorts the hits of r by distance and then id. Chroma returns hits
+// in distance order already, but the order of equal distances varies from
+// run to run.
+func (r *QueryResult) orderTies() {
+	order := make([]int, len(r.IDs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if r.Distances[i] != r.Distances[j] {
+			return r.Distances[i] < r.Distances[j]
+		}
+		return r.IDs[i] < r.IDs[j]
+	})
+	r.IDs = permute(r.IDs, order)
+	r.Documents = permute(r.Documents, order)
+	r.Distances = permute(r.Distances, order)
+	r.Metadatas = permute(r.Metadatas, order)
+	if r.Embeddings != nil {
+		r.Embeddings = permute(r.Embeddings, order)
+	}
+}
+
+// permute returns s reordered so that entry i is s[order[i]].
+func permute[T any](s []T, order []int) []T {
+	out := make([]T, len(s))
+	for i, j := range order {
+		out[i] = s[j]
+	}
+	return out
+}
+
+// check fails unless the columns of r line up.
+func (r QueryResult) check() error {
+	if len(r.Documents) != len(r.IDs) || len(r.Distances) != len(r.IDs) || len(r.Metadatas) != len(r.IDs) {
+		return fmt.Errorf("query_documents.py returned %d ids but %d documents, %d distances and %d metadatas",
+			len(r.IDs), len(r.Documents), len(r.Distances), len(r.Metadatas))
+	}
+	if r.Embeddings != nil && len(r.Embeddings) != len(r.IDs) {
+		return fmt.Errorf("query_documents.py returned %d ids but %d embeddings", len(r.IDs), len(r.Embeddings))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package pvdb
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseQueryResultOrdersTies(t *testing.T) {
+	tests := []struct {
+		name      string
+		stdout    string
+		ids, docs []string
+	}{
+		{
+			name:   "tied distances",
+			stdout: `{"ids": ["c", "a", "b"], "documents": ["doc c", "doc a", "doc b"], "distances": [0.5, 0.5, 0.5], "metadatas": [{}, {}, {}]}`,
+			ids:    []string{"a", "b", "c"},
+			docs:   []string{"doc a", "doc b", "doc c"},
+		},
+		{
+			name:   "ties after a closer hit",
+			stdout: `{"ids": ["z", "y", "x"], "documents": ["doc z", "doc y", "doc x"], "distances": [0.1, 0.7, 0.7], "metadatas": [{}, {}, {}]}`,
+			ids:    []string{"z", "x", "y"},
+			docs:   []string{"doc z", "doc x", "doc y"},
+		},
+		{
+			name:   "no ties",
+			stdout: `{"ids": ["c", "a", "b"], "documents": ["doc c", "doc a", "doc b"], "distances": [0.1, 0.2, 0.3], "metadatas": [{}, {}, {}]}`,
+			ids:    []string{"c", "a", "b"},
+			docs:   []string{"doc c", "doc a", "doc b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseQueryResult(tt.stdout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(r.IDs, tt.ids) || !slices.Equal(r.Documents, tt.docs) {
+				t.Errorf("got ids %q with documents %q, want %q with %q", r.IDs, r.Documents, tt.ids, tt.docs)
+			}
+		})
+	}
+}
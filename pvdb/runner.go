@@ -0,0 +1,188 @@
+package pvdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults a zero Runner falls back to.
+const (
+	DefaultKillGrace      = 5 * time.Second
+	DefaultMaxOutputBytes = 10 << 20
+)
+
+// Runner starts script processes. The pvdb CLI and Client both launch every
+// script through one, so they share how the command line is built, the
+// process group a cancelled script is killed with, the output cap and the
+// process limit. The zero value is ready to use.
+type Runner struct {
+	// PythonArgs are passed to the interpreter ahead of the script, such as
+	// the -3 of the Windows py launcher.
+	PythonArgs []string
+	// KillGrace is how long a script whose context is done may take to exit,
+	// and its output pipes to close, before it is killed. Zero means
+	// DefaultKillGrace.
+	KillGrace time.Duration
+	// CancelSignal picks the signal sent to the script's process group when
+	// its context is done. Nil sends SIGTERM.
+	CancelSignal func() os.Signal
+	// MaxOutputBytes caps how much of each output stream is kept. Zero means
+	// DefaultMaxOutputBytes.
+	MaxOutputBytes int64
+	// MergeStderr sends the script's stderr to its stdout, through the same
+	// pipe, instead of capturing it separately.
+	MergeStderr bool
+}
+
+// Command prepares the interpreter invocation of script with args passed
+// through as individual arguments, so values containing spaces or quotes
+// reach Python untouched. The script runs in dir and is killed when ctx is
+// done.
+func (r Runner) Command(ctx context.Context, python, script, dir string, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, python, append(append(slices.Clone(r.PythonArgs), script), args...)...)
+	// Don't wait forever on output pipes held open by orphaned grandchildren
+	cmd.WaitDelay = r.KillGrace
+	if cmd.WaitDelay == 0 {
+		cmd.WaitDelay = DefaultKillGrace
+	}
+	cmd.Dir = dir
+	return cmd
+}
+
+// Result is the outcome of one script process.
+type Result struct {
+	// Stdout is empty when it was streamed to a writer instead.
+	Stdout string
+	Stderr string
+	// Truncated is set when stdout or stderr exceeded the output cap.
+	Truncated bool
+	// State is nil when the script could not be waited for.
+	State *os.ProcessState
+}
+
+// Run runs cmd to completion. Its stdout is written to stdout as it arrives
+// or, when stdout is nil, captured in the result. Stderr is captured and
+// each line of it passed to onStderr, when not nil, as it arrives. At most
+// the output cap of each stream is kept. Unless the script reads stdin it
+// runs in its own process group, so cancelling it also signals everything
+// it started, and whatever is left of the group is killed once it has been
+// waited for. The result is populated even when the script fails, whose exit
+// is reported as an *exec.ExitError.
+func (r Runner) Run(cmd *exec.Cmd, stdout io.Writer, onStderr func(line string)) (Result, error) {
+	limit := r.MaxOutputBytes
+	if limit == 0 {
+		limit = DefaultMaxOutputBytes
+	}
+	captured := &limitedBuffer{limit: limit}
+	if stdout == nil {
+		stdout = captured
+	}
+	stderr := &limitedBuffer{limit: limit}
+	cmd.Stdout = stdout
+	var stderrPipe io.Reader = strings.NewReader("")
+	var err error
+	if r.MergeStderr {
+		cmd.Stderr = stdout
+	} else if stderrPipe, err = cmd.StderrPipe(); err != nil {
+		return Result{}, err
+	}
+	// A script that reads our terminal must stay in our process group
+	reap := func() {}
+	if cmd.Stdin == nil {
+		reap = startInOwnGroup(cmd, r.cancelSignal)
+	}
+	if err := cmd.Start(); err != nil {
+		return Result{}, err
+	}
+
+	reader := bufio.NewReader(stderrPipe)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if line != "" {
+			io.WriteString(stderr, line)
+			if onStderr != nil {
+				onStderr(strings.TrimRight(line, "\r\n"))
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	err = cmd.Wait()
+	reap()
+	return Result{
+		Stdout:    captured.buf.String(),
+		Stderr:    stderr.buf.String(),
+		Truncated: captured.truncated || stderr.truncated,
+		State:     cmd.ProcessState,
+	}, err
+}
+
+// cancelSignal is the signal a cancelled script's process group gets.
+func (r Runner) cancelSignal() os.Signal {
+	if r.CancelSignal == nil {
+		return nil
+	}
+	return r.CancelSignal()
+}
+
+// limitedBuffer keeps the first limit bytes written to it and silently
+// discards the rest, so a runaway script can't exhaust memory but is never
+// blocked or killed by a write error.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.buf.Len()); int64(len(p)) > room {
+		b.truncated = true
+		b.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// processSlots bounds how many script processes run at once across the
+// whole program, every Client and the CLI alike.
+var processSlots = make(chan struct{}, runtime.NumCPU())
+
+// SetMaxProcesses sets how many script processes may run at once, by
+// default the number of CPUs. It must be called before any script starts,
+// and fails unless n is positive.
+func SetMaxProcesses(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("max processes must be positive, got %d", n)
+	}
+	processSlots = make(chan struct{}, n)
+	return nil
+}
+
+// AcquireProcess blocks until another script process may start, or ctx is
+// done. Whoever launches a script takes a slot before its timeout starts
+// and returns it with ReleaseProcess once the script has been waited for,
+// so time spent queueing doesn't count against the timeout.
+func AcquireProcess(ctx context.Context) error {
+	select {
+	case processSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReleaseProcess frees the slot of a process that has exited.
+func ReleaseProcess() {
+	<-processSlots
+}
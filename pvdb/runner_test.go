@@ -0,0 +1,34 @@
+package pvdb
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSetMaxProcesses(t *testing.T) {
+	t.Cleanup(func() { SetMaxProcesses(runtime.NumCPU()) })
+	for _, n := range []int{0, -1} {
+		if err := SetMaxProcesses(n); err == nil {
+			t.Errorf("SetMaxProcesses(%d) succeeded, want an error", n)
+		}
+	}
+
+	if err := SetMaxProcesses(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := AcquireProcess(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := AcquireProcess(ctx); err != context.DeadlineExceeded {
+		t.Errorf("second AcquireProcess with one slot returned %v, want it to wait until ctx is done", err)
+	}
+	ReleaseProcess()
+	if err := AcquireProcess(context.Background()); err != nil {
+		t.Errorf("AcquireProcess after ReleaseProcess: %v", err)
+	}
+	ReleaseProcess()
+}
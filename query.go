@@ -0,0 +1,625 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// QueryResult is the columnar result query_documents.py prints.
+type QueryResult = pvdb.QueryResult
+
+// queryHit is one matched document.
+type queryHit struct {
+	ID       string         `json:"id"`
+	Document string         `json:"document"`
+	Metadata map[string]any `json:"metadata"`
+	Distance float64        `json:"distance"`
+	// Collection names the collection the hit came from when several were
+	// searched with -collections.
+	Collection string    `json:"collection,omitempty"`
+	Embedding  []float64 `json:"embedding,omitempty"`
+	// Metric is the distance function of the hit's collection.
+	Metric string `json:"metric,omitempty"`
+	// Similarity is 1 - Distance for cosine hits under -as-similarity.
+	Similarity *float64 `json:"similarity,omitempty"`
+}
+
+// score formats the hit's distance with its metric, or its similarity when
+// it has one.
+func (h queryHit) score() string {
+	switch {
+	case h.Similarity != nil:
+		return fmt.Sprintf("%.4f (%s similarity)", *h.Similarity, h.Metric)
+	case h.Metric != "":
+		return fmt.Sprintf("%.4f (%s)", h.Distance, h.Metric)
+	}
+	return fmt.Sprintf("%.4f", h.Distance)
+}
+
+// line formats the hit as the one line query prints for it.
+func (h queryHit) line(includeEmbeddings bool) string {
+	line := fmt.Sprintf("%s  %s  %s", h.score(), h.ID, singleLine(h.Document))
+	if h.Collection != "" {
+		line = fmt.Sprintf("%s  %s  %s  %s", h.score(), h.Collection, h.ID, singleLine(h.Document))
+	}
+	if includeEmbeddings {
+		line += fmt.Sprintf("  (%d-dimensional embedding)", len(h.Embedding))
+	}
+	return line
+}
+
+// warnNotCosine tells -as-similarity users that collection's distances,
+// measured with metric, are left as they are.
+func warnNotCosine(collection, metric string) {
+	if metric == "" {
+		metric = "an unreported metric"
+	}
+	fmt.Fprintf(cli.stderr, "WARNING: -as-similarity only converts cosine distances; collection '%s' uses %s, so its distances are kept\n", collection, metric)
+}
+
+// cosineSimilarity converts a Chroma cosine distance, 1 - cos θ, to a
+// similarity score where 1 means the same direction.
+func cosineSimilarity(distance float64) float64 {
+	return 1 - distance
+}
+
+// parseQueryResult decodes the script's stdout and checks that its columns
+// line up.
+func parseQueryResult(stdout string) (QueryResult, error) {
+	defer trace.child("parse query_documents.py output").end()
+	return pvdb.ParseQueryResult(stdout)
+}
+
+// insufficientResultsError reports a query left with fewer than -min-results
+// hits once those beyond -max-distance were dropped.
+type insufficientResultsError struct {
+	// query is the text of the failing query under -texts, else empty.
+	query       string
+	found, want int
+}
+
+func (e *insufficientResultsError) Error() string {
+	msg := fmt.Sprintf("insufficient relevant results: found %d, want at least %d", e.found, e.want)
+	if e.query != "" {
+		msg += " for query " + strconv.Quote(e.query)
+	}
+	return msg
+}
+
+// requireResults fails with an insufficientResultsError when found is below
+// minResults.
+func requireResults(query string, found, minResults int) error {
+	if found < minResults {
+		return &insufficientResultsError{query: query, found: found, want: minResults}
+	}
+	return nil
+}
+
+// queryHits returns the matches in r whose distance is at most maxDistance,
+// or all of them when maxDistance is zero.
+func queryHits(r QueryResult, maxDistance float64) []queryHit {
+	hits := []queryHit{}
+	for i, id := range r.IDs {
+		if maxDistance > 0 && r.Distances[i] > maxDistance {
+			continue
+		}
+		hit := queryHit{ID: id, Document: r.Documents[i], Metadata: r.Metadatas[i], Distance: r.Distances[i], Metric: r.DistanceMetric}
+		if r.Embeddings != nil {
+			hit.Embedding = r.Embeddings[i]
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+// runQuery handles `pvdb query "some text" -n 5` and its alias `pvdb search`.
+// The query is the positional text, -text, or a pre-computed embedding given
+// with -vector, which skips the embedding step.
+func runQuery(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("query")
+	n := fs.Int("n", 5, "number of results to return")
+	text := fs.String("text", "", "text to search for, instead of the positional argument")
+	texts := fs.String("texts", "", `JSON array of texts to search for in one script run, e.g. ["a","b"]; results are grouped per text`)
+	vector := fs.String("vector", "", "JSON array of numbers to search with as the query embedding, skipping the embedding step")
+	where := fs.String("where", "", `JSON object restricting results by metadata, e.g. {"topic":"favourite_recipes"}`)
+	var contains string
+	fs.Func("contains", "only return documents whose text contains this substring", func(value string) error {
+		if value == "" {
+			return errors.New("substring must not be empty")
+		}
+		contains = value
+		return nil
+	})
+	var maxDistance float64
+	fs.Func("max-distance", "drop results further than this distance (default 0, keeping all)", func(value string) error {
+		d, err := strconv.ParseFloat(value, 64)
+		switch {
+		case err != nil:
+			return fmt.Errorf("want a number, got %q", value)
+		case math.IsNaN(d) || math.IsInf(d, 0):
+			return fmt.Errorf("want a finite distance, got %s", value)
+		case d < 0:
+			return fmt.Errorf("must not be negative, got %s", value)
+		}
+		maxDistance = d
+		return nil
+	})
+	minResults := fs.Int("min-results", 0, "fail with exit code 8 when fewer results than this remain after -max-distance")
+	includeEmbeddings := fs.Bool("include-embeddings", false, "also return the matched documents' embedding vectors (their dimensionality outside -json)")
+	retryEmpty := fs.Int("retry-empty", 0, "re-run a query up to this many times while it finds nothing in a non-empty collection")
+	collections := fs.String("collections", "", "comma-separated collections to search at once, merging their results by distance")
+	asSimilarity := fs.Bool("as-similarity", false, "report cosine distances as similarity scores, 1 - distance")
+	stream := fs.Bool("stream", false, "print each result as soon as the script emits it instead of waiting for all of them")
+	out := fs.String("out", "", "write the results as a JSON array to this file instead of printing them, or - for stdout")
+	truncateOutput := fs.Int("truncate-output", 200, "clip each printed document to this many characters, marking the cut with an ellipsis (0 for no limit); -json and -out keep documents whole")
+	explain := fs.Bool("explain", false, "also report the query, the embedding model and dimensions, the distance metric and the size of each collection searched")
+	resultFormat := formatText
+	fs.Func("format", "how printed results are laid out: text, markdown for a list of hits with blockquoted documents, or ndjson for one JSON object per hit and line (default text)", func(value string) error {
+		if !slices.Contains(resultFormats, value) {
+			return fmt.Errorf("unknown format %q, want %s", value, strings.Join(resultFormats, ", "))
+		}
+		resultFormat = value
+		return nil
+	})
+	resultTemplate := fs.String("result-template", "", `Go text/template each result is printed with, e.g. '{{.ID}}\t{{.Distance}}\t{{.Document}}'; \t and \n are expanded`)
+	common := registerCommonFlags(fs)
+	common.embedderFlag(fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, invalidArgs(err)
+	}
+	if len(positional) > 1 || (len(positional) == 1 && *text != "") {
+		return nil, invalidArgs(errors.New(`usage: pvdb query "some text" [-n 5]`))
+	}
+	if len(positional) == 1 {
+		*text = positional[0]
+	}
+	given := 0
+	for _, q := range []string{*text, *texts, *vector} {
+		if q != "" {
+			given++
+		}
+	}
+	switch {
+	case given > 1:
+		return nil, invalidArgs(errors.New("give only one of query text, -texts or -vector"))
+	case given == 0:
+		return nil, invalidArgs(errors.New(`usage: pvdb query "some text" [-n 5], pvdb query -texts '["a","b"]' [-n 5] or pvdb query -vector '[0.1, 0.2]' [-n 5]`))
+	}
+	if *n <= 0 {
+		return nil, invalidArgsf("-n must be positive, got %d", *n)
+	}
+	if *retryEmpty < 0 {
+		return nil, invalidArgsf("-retry-empty must not be negative, got %d", *retryEmpty)
+	}
+	if *minResults < 0 || *minResults > *n {
+		return nil, invalidArgsf("-min-results must be between 0 and -n (%d), got %d", *n, *minResults)
+	}
+	if *truncateOutput < 0 {
+		return nil, invalidArgsf("-truncate-output must not be negative, got %d", *truncateOutput)
+	}
+	if *out == "-" && jsonOutput {
+		return nil, invalidArgs(errors.New("-json needs stdout for the outcome; pass -out FILE"))
+	}
+	format := hitFormat{includeEmbeddings: *includeEmbeddings, truncate: *truncateOutput, layout: resultFormat}
+	if resultFormat != formatText {
+		switch {
+		case jsonOutput || *out != "":
+			return nil, invalidArgsf("-format %s lays out printed results and cannot be combined with -json or -out", resultFormat)
+		case *resultTemplate != "":
+			return nil, invalidArgsf("-format %s cannot be combined with -result-template", resultFormat)
+		}
+	}
+	if *resultTemplate != "" {
+		if jsonOutput || *out != "" {
+			return nil, invalidArgs(errors.New("-result-template formats printed results and cannot be combined with -json or -out"))
+		}
+		if format.template, err = parseResultTemplate(*resultTemplate); err != nil {
+			return nil, err
+		}
+	}
+	scriptArgs := []string{*text, strconv.Itoa(*n)}
+	var queries []string
+	if *texts != "" {
+		if queries, err = decodeTexts(*texts); err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(queries)
+		if err != nil {
+			return nil, err
+		}
+		scriptArgs = []string{strconv.Itoa(*n), "--texts=" + string(encoded)}
+	}
+	if *vector != "" {
+		embedding, err := decodeVector(*vector)
+		if err != nil {
+			return nil, err
+		}
+		scriptArgs = []string{strconv.Itoa(*n), "--vector=" + embedding}
+		// Nothing is embedded, so neither a backend nor a key is needed
+		common.embedder = ""
+	}
+	if *where != "" {
+		if err := validateWhere(*where); err != nil {
+			return nil, err
+		}
+		scriptArgs = append(scriptArgs, "--where="+*where)
+	}
+	if contains != "" {
+		filter, err := json.Marshal(map[string]string{"$contains": contains})
+		if err != nil {
+			return nil, err
+		}
+		scriptArgs = append(scriptArgs, "--where-document="+string(filter))
+	}
+	if *includeEmbeddings {
+		scriptArgs = append(scriptArgs, "--include-embeddings")
+	}
+	if *explain {
+		scriptArgs = append(scriptArgs, "--explain")
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+	if common.embedder != "" {
+		if err := common.requireOpenAIKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	if queries != nil {
+		switch {
+		case *stream, *collections != "", *retryEmpty > 0, *explain:
+			return nil, invalidArgs(errors.New("-texts cannot be combined with -stream, -collections, -retry-empty or -explain"))
+		}
+		return common.multiQuery(ctx, python, scriptArgs, queries, multiQueryOptions{
+			maxDistance:  maxDistance,
+			minResults:   *minResults,
+			asSimilarity: *asSimilarity,
+			format:       format,
+			out:          *out,
+		})
+	}
+	if *stream {
+		switch {
+		case jsonOutput, *out != "":
+			return nil, invalidArgs(errors.New("-stream prints results as they arrive and cannot be combined with -json or -out"))
+		case *collections != "", *retryEmpty > 0, *explain:
+			return nil, invalidArgs(errors.New("-stream cannot be combined with -collections, -retry-empty or -explain"))
+		}
+		printed, err := common.streamQuery(ctx, python, scriptArgs, maxDistance, *asSimilarity, format)
+		if err != nil || common.dryRun {
+			return nil, err
+		}
+		return nil, requireResults("", printed, *minResults)
+	}
+
+	names := []string{common.collection}
+	if *collections != "" {
+		if common.isSet("collection") {
+			return nil, invalidArgs(errors.New("-collection cannot be combined with -collections"))
+		}
+		if names, err = parseCollections(*collections); err != nil {
+			return nil, err
+		}
+		audit.Collection = strings.Join(names, ",")
+	}
+	results, ran, err := common.fanOutQuery(ctx, python, names, scriptArgs, *retryEmpty)
+	if !ran {
+		return dryRunSummary(ran), err
+	}
+
+	explanation := &queryExplanation{Query: *text, N: *n, MaxDistance: maxDistance, Contains: contains}
+	if *where != "" {
+		explanation.Where = json.RawMessage(*where)
+	}
+	var (
+		hits     []queryHit
+		returned int
+		retried  int
+		warnings = map[string]string{}
+		failed   = map[string]string{}
+	)
+	for i, r := range results {
+		retried += r.retries
+		if r.err != nil {
+			if len(names) > 1 {
+				slog.Warn("query failed; results from the other collections are kept", "collection", names[i], "err", r.err)
+			}
+			failed[names[i]] = r.err.Error()
+			continue
+		}
+		if w := r.parsed.EmbeddingModelWarning; w != "" {
+			fmt.Fprintf(cli.stderr, "WARNING: %s; distances are not meaningful\n", w)
+			warnings[names[i]] = w
+		}
+		explanation.add(names[i], r.parsed)
+		returned += len(r.parsed.IDs)
+		cosine := r.parsed.DistanceMetric == "cosine"
+		if *asSimilarity && !cosine && len(r.parsed.IDs) > 0 {
+			warnNotCosine(names[i], r.parsed.DistanceMetric)
+		}
+		for _, h := range queryHits(r.parsed, maxDistance) {
+			if len(names) > 1 {
+				h.Collection = names[i]
+			}
+			if *asSimilarity && cosine {
+				similarity := cosineSimilarity(h.Distance)
+				h.Similarity = &similarity
+			}
+			hits = append(hits, h)
+		}
+	}
+	if len(failed) == len(names) {
+		return nil, err
+	}
+	matched := len(hits)
+	hits = topHits(hits, *n)
+	audit.Documents = len(hits)
+	if retried > 0 {
+		fmt.Fprintf(cli.stderr, "retried empty query results %d times\n", retried)
+	}
+	if *out != "" {
+		if err := writeJSONArray(*out, hits); err != nil {
+			return nil, err
+		}
+		if *out != "-" {
+			fmt.Fprintf(cli.stderr, "wrote %d results to %s\n", len(hits), *out)
+		}
+	}
+	if jsonOutput {
+		sum := summary{"results": hits}
+		if *out != "" {
+			sum = summary{"out": *out, "written": len(hits)}
+		}
+		if *retryEmpty > 0 {
+			sum["empty_retries"] = retried
+		}
+		if *explain {
+			sum["explain"] = explanation
+		}
+		if len(names) == 1 {
+			if w := warnings[names[0]]; w != "" {
+				sum["embedding_model_warning"] = w
+			}
+		} else {
+			if len(warnings) > 0 {
+				sum["embedding_model_warnings"] = warnings
+			}
+			if len(failed) > 0 {
+				sum["failed_collections"] = failed
+			}
+		}
+		return sum, requireResults("", len(hits), *minResults)
+	}
+	if *out != "" {
+		if *explain {
+			explanation.print(cli.stderr)
+		}
+		return nil, requireResults("", len(hits), *minResults)
+	}
+	if *explain {
+		switch format.layout {
+		case formatNDJSON:
+			explanation.print(cli.stderr)
+		case formatMarkdown:
+			explanation.print(cli.stdout)
+			fmt.Fprintln(cli.stdout)
+		default:
+			explanation.print(cli.stdout)
+		}
+	}
+	for _, h := range hits {
+		if err := format.print(cli.stdout, h, ""); err != nil {
+			return nil, err
+		}
+	}
+	if dropped := returned - matched; dropped > 0 {
+		format.printNote(cli.stdout, "dropped %d results further than %g", dropped, maxDistance)
+	}
+	return nil, requireResults("", len(hits), *minResults)
+}
+
+// writeJSONArray writes results, a slice, as an indented JSON array to path,
+// - meaning stdout. A file is replaced only once the whole array is written.
+func writeJSONArray(path string, results any) error {
+	encoded, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	dump, err := createDump(path)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(dump, "%s\n", encoded); err != nil {
+		dump.abort()
+		return err
+	}
+	return dump.Close()
+}
+
+// collectionQuery is the outcome of querying one collection.
+type collectionQuery struct {
+	parsed QueryResult
+	err    error
+	// retries counts the re-runs -retry-empty needed.
+	retries int
+}
+
+// emptyRetryDelay is the pause before -retry-empty re-runs a query, giving a
+// concurrent ingest time to persist.
+const emptyRetryDelay = 500 * time.Millisecond
+
+// fanOutQuery runs query_documents.py against every collection in names at
+// once, returning each outcome in the order of names along with the joined
+// errors. A failing collection doesn't affect the others. An empty result
+// from a collection that holds documents is retried up to retryEmpty times.
+// Under -dry-run the commands are only printed and ran is false.
+func (c *commonFlags) fanOutQuery(ctx context.Context, python string, names, scriptArgs []string, retryEmpty int) ([]collectionQuery, bool, error) {
+	if err := c.ensureReady(ctx, python); err != nil {
+		return nil, false, err
+	}
+	results := make([]collectionQuery, len(names))
+	query := func(i int) bool {
+		shard := *c
+		shard.collection = names[i]
+		run := func() (bool, error) {
+			result, ran, err := shard.runScript(ctx, python, "query_documents.py", scriptArgs)
+			if err == nil && ran {
+				results[i].parsed, err = parseQueryResult(result.Stdout)
+			}
+			return ran, err
+		}
+		ran, err := run()
+		if err == nil && ran && retryEmpty > 0 && len(results[i].parsed.IDs) == 0 {
+			err = shard.retryEmptyQuery(ctx, python, &results[i], retryEmpty, run)
+		}
+		results[i].err = err
+		return ran
+	}
+	if c.dryRun {
+		for i := range names {
+			query(i)
+		}
+		return results, false, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query(i)
+		}(i)
+	}
+	wg.Wait()
+
+	var errs []error
+	for i, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("collection '%s': %w", names[i], r.err))
+		}
+	}
+	return results, true, errors.Join(errs...)
+}
+
+// retryEmptyQuery re-runs an empty query up to retries times, emptyRetryDelay
+// apart, unless count_documents.py shows the collection really is empty.
+func (c *commonFlags) retryEmptyQuery(ctx context.Context, python string, r *collectionQuery, retries int, run func() (bool, error)) error {
+	result, _, err := c.runScript(ctx, python, "count_documents.py", nil)
+	if err != nil {
+		return err
+	}
+	n, err := parseCount("count_documents.py", result.Stdout)
+	if err != nil || n == 0 {
+		return err
+	}
+	for r.retries < retries && len(r.parsed.IDs) == 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(emptyRetryDelay):
+		}
+		r.retries++
+		if _, err := run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseCollections splits the -collections list, dropping repeated names and
+// checking each one.
+func parseCollections(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(names, name) {
+			continue
+		}
+		if err := validateCollectionName(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, invalidArgs(errors.New("-collections must name at least one collection"))
+	}
+	return names, nil
+}
+
+// topHits returns the k closest of hits, gathered from several collections.
+// Equal distances are ordered by id and then collection, so merged results
+// are reproducible.
+func topHits(hits []queryHit, k int) []queryHit {
+	slices.SortStableFunc(hits, func(a, b queryHit) int {
+		if c := cmp.Compare(a.Distance, b.Distance); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.ID, b.ID); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Collection, b.Collection)
+	})
+	if hits == nil {
+		hits = []queryHit{}
+	}
+	return hits[:min(k, len(hits))]
+}
+
+// decodeVector checks that the -vector value is a non-empty JSON array of
+// numbers and returns it re-encoded for the script.
+func decodeVector(value string) (string, error) {
+	var embedding []float64
+	if err := json.Unmarshal([]byte(value), &embedding); err != nil {
+		return "", invalidArgsf("-vector must be a JSON array of numbers: %w", err)
+	}
+	if len(embedding) == 0 {
+		return "", invalidArgs(errors.New("-vector must not be empty"))
+	}
+	encoded, err := json.Marshal(embedding)
+	return string(encoded), err
+}
+
+// decodeTexts checks that the -texts value is a non-empty JSON array of
+// non-empty strings.
+func decodeTexts(value string) ([]string, error) {
+	var texts []string
+	if err := json.Unmarshal([]byte(value), &texts); err != nil {
+		return nil, invalidArgsf("-texts must be a JSON array of strings: %w", err)
+	}
+	if len(texts) == 0 {
+		return nil, invalidArgs(errors.New("-texts must not be empty"))
+	}
+	for i, t := range texts {
+		if strings.TrimSpace(t) == "" {
+			return nil, invalidArgsf("-texts entry %d is empty", i)
+		}
+	}
+	return texts, nil
+}
+
+// validateWhere checks that the -where value is a JSON object, the only
+// shape Chroma accepts as a metadata filter.
+func validateWhere(where string) error {
+	var filter any
+	if err := json.Unmarshal([]byte(where), &filter); err != nil {
+		return invalidArgsf("-where must be a JSON object: %w", err)
+	}
+	if _, ok := filter.(map[string]any); !ok {
+		return invalidArgsf("-where must be a JSON object like {\"topic\":\"favourite_recipes\"}, got %s", where)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// kLatency is the latency of the query-bench runs at one k.
+type kLatency struct {
+	K int `json:"k"`
+	// Returned is how many hits the last run got back, fewer than K when the
+	// collection holds fewer documents.
+	Returned int     `json:"returned"`
+	MinSecs  float64 `json:"min_secs"`
+	MeanSecs float64 `json:"mean_secs"`
+	P95Secs  float64 `json:"p95_secs"`
+}
+
+// runQueryBench handles `pvdb query-bench -text "x" -ks 1,5,10,50,100`,
+// running the query -repetitions times at each k through the normal query
+// path and reporting the min, mean and p95 latency per k. Each run includes
+// the interpreter's startup and the query's embedding, which are the same
+// at every k, so the differences between rows are what k costs.
+func runQueryBench(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("query-bench")
+	text := fs.String("text", "", "text to search for")
+	ksFlag := fs.String("ks", "1,5,10,50,100", "comma-separated numbers of results to time the query at")
+	repetitions := fs.Int("repetitions", 5, "times to run the query at each k")
+	common := registerCommonFlags(fs)
+	common.embedderFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if fs.NArg() > 0 {
+		return nil, invalidArgsf("unexpected arguments %q; give the query with -text", fs.Args())
+	}
+	if strings.TrimSpace(*text) == "" {
+		return nil, invalidArgs(errors.New(`missing required flag -text, e.g. pvdb query-bench -text "some text"`))
+	}
+	if *repetitions <= 0 {
+		return nil, invalidArgsf("-repetitions must be positive, got %d", *repetitions)
+	}
+	ks, err := parseKs(*ksFlag)
+	if err != nil {
+		return nil, err
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+	if err := common.requireOpenAIKey(); err != nil {
+		return nil, err
+	}
+
+	rows := make([]kLatency, 0, len(ks))
+	for _, k := range ks {
+		row := kLatency{K: k}
+		latencies := make([]time.Duration, 0, *repetitions)
+		for rep := 0; rep < *repetitions; rep++ {
+			start := time.Now()
+			result, ran, err := common.runScript(ctx, python, "query_documents.py", []string{*text, strconv.Itoa(k)})
+			if err != nil {
+				return nil, fmt.Errorf("k=%d: %w", k, err)
+			}
+			if !ran {
+				// The command is the same for every repetition
+				break
+			}
+			latencies = append(latencies, time.Since(start))
+			parsed, err := parseQueryResult(result.Stdout)
+			if err != nil {
+				return nil, fmt.Errorf("k=%d: %w", k, err)
+			}
+			row.Returned = len(parsed.IDs)
+		}
+		if common.dryRun {
+			continue
+		}
+		var total time.Duration
+		for _, d := range latencies {
+			total += d
+		}
+		row.MinSecs = slices.Min(latencies).Seconds()
+		row.MeanSecs = (total / time.Duration(len(latencies))).Seconds()
+		row.P95Secs = percentile(latencies, 95).Seconds()
+		rows = append(rows, row)
+	}
+	if common.dryRun {
+		return dryRunSummary(false), nil
+	}
+
+	sum := summary{"text": *text, "repetitions": *repetitions, "ks": rows}
+	if jsonOutput {
+		return sum, nil
+	}
+	seconds := func(s float64) time.Duration {
+		return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+	}
+	tw := tabwriter.NewWriter(humanOut(), 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "K\tRETURNED\tMIN\tMEAN\tP95\t")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t\n", r.K, r.Returned, seconds(r.MinSecs), seconds(r.MeanSecs), seconds(r.P95Secs))
+	}
+	tw.Flush()
+	return nil, nil
+}
+
+// parseKs parses the -ks list of positive result counts, dropping repeats
+// and sorting them so the table reads from the smallest k up.
+func parseKs(list string) ([]int, error) {
+	var ks []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		k, err := strconv.Atoi(field)
+		if err != nil || k <= 0 {
+			return nil, invalidArgsf("-ks must list positive numbers of results, got %q", field)
+		}
+		if !slices.Contains(ks, k) {
+			ks = append(ks, k)
+		}
+	}
+	if len(ks) == 0 {
+		return nil, invalidArgs(errors.New("-ks must list at least one number of results"))
+	}
+	slices.Sort(ks)
+	return ks, nil
+}
@@ -0,0 +1,137 @@
+import chromadb
+import json
+import sys
+
+from add_documents import EMBEDDING_DIMENSIONS_KEY, EMBEDDING_MODEL_KEY, create_embedding_function, embedding_dimensions, embedding_model, embedding_model_mismatch, get_existing_collection, split_named_args, open_client
+
+def query_collection(collection, query_text, n_results, where=None, query_embedding=None, include_embeddings=False, where_document=None):
+    include = ["documents", "metadatas", "distances"]
+    if include_embeddings:
+        include.append("embeddings")
+    if query_embedding is not None:
+        # The launcher's -vector is used as is, skipping the embedding step
+        results = collection.query(query_embeddings=[query_embedding], n_results=n_results, where=where, where_document=where_document, include=include)
+    else:
+        results = collection.query(query_texts=[query_text], n_results=n_results, where=where, where_document=where_document, include=include)
+    # Chroma returns one list per query text; we only ever send one
+    return result_set(collection, results, 0, include_embeddings)
+
+def query_texts(collection, texts, n_results, where=None, include_embeddings=False, where_document=None):
+    # Search for several texts in one call, returning one result set per
+    # text labelled with it
+    include = ["documents", "metadatas", "distances"]
+    if include_embeddings:
+        include.append("embeddings")
+    results = collection.query(query_texts=texts, n_results=n_results, where=where, where_document=where_document, include=include)
+    groups = []
+    for q, text in enumerate(texts):
+        group = result_set(collection, results, q, include_embeddings)
+        group["query"] = text
+        groups.append(group)
+    return groups
+
+def result_set(collection, results, q, include_embeddings):
+    # The columns Chroma returned for query q
+    result = {
+        "ids": results["ids"][q],
+        "documents": results["documents"][q],
+        "metadatas": results["metadatas"][q],
+        "distances": results["distances"][q],
+        # The space the distances are measured in, l2 unless the collection
+        # was created with another
+        "distance_metric": (collection.metadata or {}).get("hnsw:space", "l2"),
+    }
+    if include_embeddings:
+        # Embeddings may come back as numpy arrays
+        result["embeddings"] = [[float(x) for x in e] for e in results["embeddings"][q]]
+    return result
+
+def explain(collection, options, query_embedding):
+    # The context of a search for --explain: what was searched, and with
+    # which model and dimensions
+    metadata = collection.metadata or {}
+    dimensions = len(query_embedding) if query_embedding is not None else embedding_dimensions(options)
+    dimensions = dimensions or metadata.get(EMBEDDING_DIMENSIONS_KEY)
+    if not dimensions:
+        # Neither given nor recorded, so read it off a stored embedding
+        stored = collection.get(limit=1, include=["embeddings"])["embeddings"]
+        if stored is not None and len(stored) > 0:
+            dimensions = len(stored[0])
+    return {
+        "collection_size": collection.count(),
+        # A --vector query embeds nothing
+        "embedding_model": embedding_model(options) if query_embedding is None else None,
+        "collection_embedding_model": metadata.get(EMBEDDING_MODEL_KEY),
+        "embedding_dimensions": dimensions,
+    }
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+
+        # The query is text to embed, a --vector embedding or a --texts
+        # array of texts to embed
+        query_embedding = json.loads(options["vector"]) if "vector" in options else None
+        texts = json.loads(options["texts"]) if "texts" in options else None
+        if len(args) != (1 if query_embedding is not None or texts is not None else 2):
+            raise ValueError("Usage: python query_documents.py <query> <n_results> [--collection=NAME] [--where=JSON] [--where-document=JSON]\n"
+                             "       python query_documents.py <n_results> --vector=JSON [--collection=NAME] [--where=JSON] [--where-document=JSON]\n"
+                             "       python query_documents.py <n_results> --texts=JSON [--collection=NAME] [--where=JSON] [--where-document=JSON]")
+
+        query_text = args[0] if query_embedding is None and texts is None else None
+        n_results = int(args[-1])
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Create the embedding function chosen with --embedder; a --vector
+        # query needs none
+        ef = create_embedding_function(options) if query_embedding is None else None
+
+        # Get the Chroma collection, which a read never creates
+        collection = get_existing_collection(client, options.get("collection", "documents"), ef)
+
+        # The launcher forwards -where as a JSON metadata filter
+        where = json.loads(options["where"]) if "where" in options else None
+        # and -contains as a {"$contains": ...} document filter
+        where_document = json.loads(options["where-document"]) if "where-document" in options else None
+
+        # Distances are meaningless when the query is embedded with a
+        # different model than the stored documents, and Chroma refuses a
+        # query of another dimension, so warn before querying
+        mismatch = embedding_model_mismatch(collection, options) if query_embedding is None else None
+        if mismatch:
+            print(f"warning: {mismatch}", file=sys.stderr, flush=True)
+
+        include_embeddings = "include-embeddings" in options
+        if texts is not None:
+            result = {"results": query_texts(collection, texts, n_results, where, include_embeddings, where_document)}
+        else:
+            result = query_collection(collection, query_text, n_results, where, query_embedding, include_embeddings, where_document)
+        if mismatch:
+            result["embedding_model_warning"] = mismatch
+        if "explain" in options:
+            result["explain"] = explain(collection, options, query_embedding)
+
+        if options.get("stream") == "true":
+            # One hit per line, flushed, so the launcher can print each as
+            # it arrives
+            for i, doc_id in enumerate(result["ids"]):
+                hit = {
+                    "id": doc_id,
+                    "document": result["documents"][i],
+                    "metadata": result["metadatas"][i],
+                    "distance": result["distances"][i],
+                    "metric": result["distance_metric"],
+                }
+                if include_embeddings:
+                    hit["embedding"] = result["embeddings"][i]
+                print(json.dumps(hit), flush=True)
+        else:
+            print(json.dumps(result))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// queryExplanation is the -explain report of a query: the parameters it was
+// run with and, for each collection searched, what query_documents.py found
+// out about it.
+type queryExplanation struct {
+	// Query is the text searched for, empty for a -vector query.
+	Query       string                  `json:"query,omitempty"`
+	N           int                     `json:"n"`
+	MaxDistance float64                 `json:"max_distance,omitempty"`
+	Where       json.RawMessage         `json:"where,omitempty"`
+	Contains    string                  `json:"contains,omitempty"`
+	Collections []collectionExplanation `json:"collections"`
+}
+
+// collectionExplanation describes the search of one collection.
+type collectionExplanation struct {
+	Collection     string `json:"collection"`
+	DistanceMetric string `json:"distance_metric"`
+	pvdb.QueryExplanation
+}
+
+// add records the explanation of collection's result r, if the script gave
+// one.
+func (e *queryExplanation) add(collection string, r QueryResult) {
+	if r.Explain == nil {
+		return
+	}
+	e.Collections = append(e.Collections, collectionExplanation{Collection: collection, DistanceMetric: r.DistanceMetric, QueryExplanation: *r.Explain})
+}
+
+// print writes the report as the lines query prints ahead of its hits.
+func (e *queryExplanation) print(w io.Writer) {
+	query := "the -vector embedding"
+	if e.Query != "" {
+		query = strconv.Quote(e.Query)
+	}
+	params := []string{fmt.Sprintf("n=%d", e.N)}
+	if e.MaxDistance > 0 {
+		params = append(params, fmt.Sprintf("max-distance %g", e.MaxDistance))
+	}
+	if e.Where != nil {
+		params = append(params, "where "+string(e.Where))
+	}
+	if e.Contains != "" {
+		params = append(params, "contains "+strconv.Quote(e.Contains))
+	}
+	fmt.Fprintf(w, "query:       %s (%s)\n", query, strings.Join(params, ", "))
+	for _, c := range e.Collections {
+		metric := c.DistanceMetric
+		if metric == "" {
+			metric = "unreported"
+		}
+		fmt.Fprintf(w, "collection:  '%s', %d documents, %s distance\n", c.Collection, c.CollectionSize, metric)
+		embedding := "none: searched with the -vector embedding"
+		if c.EmbeddingModel != "" {
+			embedding = c.EmbeddingModel
+		}
+		if c.EmbeddingDimensions > 0 {
+			embedding += fmt.Sprintf(", %d dimensions", c.EmbeddingDimensions)
+		}
+		switch built := c.CollectionEmbeddingModel; {
+		case built == "":
+			embedding += " (the collection records no model)"
+		case built != c.EmbeddingModel:
+			embedding += fmt.Sprintf(" (the collection was built with %s)", built)
+		}
+		fmt.Fprintf(w, "embedding:   %s\n", embedding)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+func TestTopHitsOrdersTiesAcrossCollections(t *testing.T) {
+	// What query_documents.py printed for two collections searched with
+	// -collections, ties and all
+	results := map[string]string{
+		"recipes": `{"ids": ["b", "d"], "documents": ["", ""], "distances": [0.5, 0.9], "metadatas": [{}, {}]}`,
+		"notes":   `{"ids": ["a", "b", "c"], "documents": ["", "", ""], "distances": [0.5, 0.5, 0.2], "metadatas": [{}, {}, {}]}`,
+	}
+	var hits []queryHit
+	for _, name := range []string{"recipes", "notes"} {
+		r, err := pvdb.ParseQueryResult(results[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range queryHits(r, 0) {
+			h.Collection = name
+			hits = append(hits, h)
+		}
+	}
+
+	tests := []struct {
+		k    int
+		want []string
+	}{
+		{k: 10, want: []string{"notes/c", "notes/a", "notes/b", "recipes/b", "recipes/d"}},
+		{k: 3, want: []string{"notes/c", "notes/a", "notes/b"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, h := range topHits(append([]queryHit(nil), hits...), tt.k) {
+			got = append(got, h.Collection+"/"+h.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("topHits(k=%d) = %q, want %q", tt.k, got, tt.want)
+		}
+	}
+}
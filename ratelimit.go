@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out batch launches so at most a fixed number start per
+// minute, however many workers share it. A nil *rateLimiter never waits.
+type rateLimiter struct {
+	ticker *time.Ticker
+
+	mu      sync.Mutex
+	started bool
+}
+
+// newRateLimiter allows perMinute launches a minute, or returns nil for
+// unlimited when perMinute is zero.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{ticker: time.NewTicker(time.Minute / time.Duration(perMinute))}
+}
+
+// wait blocks until the next launch is allowed; the first one is allowed at
+// once. onWait is called before blocking, so the caller can report that it
+// is being throttled.
+func (l *rateLimiter) wait(ctx context.Context, onWait func()) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	first := !l.started
+	l.started = true
+	l.mu.Unlock()
+	if first {
+		return nil
+	}
+	select {
+	case <-l.ticker.C:
+		return nil
+	default:
+	}
+	onWait()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.ticker.C:
+		return nil
+	}
+}
+
+// stop releases the limiter's ticker.
+func (l *rateLimiter) stop() {
+	if l != nil {
+		l.ticker.Stop()
+	}
+}
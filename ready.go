@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// readyPollInterval is how often the Chroma heartbeat is polled.
+const readyPollInterval = 500 * time.Millisecond
+
+// notReadyError reports a Chroma server that never answered its heartbeat.
+type notReadyError struct {
+	after time.Duration
+	last  error
+}
+
+func (e *notReadyError) Error() string {
+	return fmt.Sprintf("chroma server not ready after %s: %v", e.after, e.last)
+}
+
+func (e *notReadyError) Unwrap() error {
+	return e.last
+}
+
+// ensureReady checks the installed chromadb version and waits for the
+// -chroma-url server under -wait-ready before the first script runs; later
+// calls return the first outcome.
+func (c *commonFlags) ensureReady(ctx context.Context, python string) error {
+	if err := c.checkChromaVersion(ctx, python); err != nil {
+		return err
+	}
+	if c.server == nil || c.waitReadyTimeout <= 0 || c.dryRun {
+		return nil
+	}
+	if !c.readyChecked {
+		c.readyChecked = true
+		c.readyErr = c.waitReady(ctx, c.waitReadyTimeout)
+	}
+	return c.readyErr
+}
+
+// waitReady polls the heartbeat endpoint of the -chroma-url server until it
+// answers 200 OK, giving up after timeout with the last error seen.
+func (c *commonFlags) waitReady(ctx context.Context, timeout time.Duration) error {
+	heartbeat := c.server.JoinPath("/api/v1/heartbeat").String()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := &http.Client{Timeout: readyPollInterval * 4}
+
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	var last error
+	for {
+		err := probeHeartbeat(ctx, client, heartbeat)
+		if err == nil {
+			return nil
+		}
+		// A probe cut short by the deadline says less than the one before it
+		if last == nil || ctx.Err() == nil {
+			last = err
+		}
+		select {
+		case <-ctx.Done():
+			return &notReadyError{after: timeout, last: last}
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeHeartbeat makes one heartbeat request, failing unless it returns 200.
+func probeHeartbeat(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// runRecent handles `pvdb recent -since 2024-01-01T00:00:00Z`, listing the
+// documents whose ingested_at metadata, as written by add -timestamp, is
+// later than -since, newest first.
+func runRecent(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("recent")
+	since := fs.String("since", "", "RFC3339 time, e.g. 2024-01-01T00:00:00Z; documents ingested after it are listed")
+	n := fs.Int("n", 0, "show at most this many documents (0 for all)")
+	width := fs.Int("width", 60, "maximum characters of each document to show")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *since == "" {
+		return nil, invalidArgs(errors.New("missing required flag -since"))
+	}
+	t, err := time.Parse(time.RFC3339, *since)
+	if err != nil {
+		return nil, invalidArgsf("-since must be an RFC3339 time like 2024-01-01T00:00:00Z: %w", err)
+	}
+	if *n < 0 {
+		return nil, invalidArgsf("-n must not be negative, got %d", *n)
+	}
+	if *width <= 0 {
+		return nil, invalidArgsf("-width must be positive, got %d", *width)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	scriptArgs := []string{"--since=" + t.UTC().Format(time.RFC3339)}
+	if *n > 0 {
+		scriptArgs = append(scriptArgs, "--limit="+strconv.Itoa(*n))
+	}
+	result, ran, err := common.runScript(ctx, python, "recent_documents.py", scriptArgs)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+
+	var docs []storedDocument
+	if err := json.Unmarshal([]byte(result.Stdout), &docs); err != nil {
+		return nil, fmt.Errorf("recent_documents.py returned invalid JSON: %w", err)
+	}
+	sortNewestFirst(docs)
+	audit.Documents = len(docs)
+	if jsonOutput {
+		return summary{"collection": common.collection, "since": *since, "documents": docs}, nil
+	}
+	printDocumentTable(docs, *width)
+	return nil, nil
+}
+
+// sortNewestFirst orders docs by their ingested_at metadata, latest first.
+// Documents whose timestamp doesn't parse sort last.
+func sortNewestFirst(docs []storedDocument) {
+	ingestedAt := func(d storedDocument) time.Time {
+		s, _ := d.Metadata[ingestedAtKey].(string)
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	slices.SortStableFunc(docs, func(a, b storedDocument) int {
+		return cmp.Compare(ingestedAt(b).UnixNano(), ingestedAt(a).UnixNano())
+	})
+}
@@ -0,0 +1,59 @@
+import chromadb
+import json
+import sys
+from datetime import datetime
+
+from add_documents import get_existing_collection, split_named_args, open_client
+
+INGESTED_AT_KEY = "ingested_at"
+
+def parse_time(value):
+    # fromisoformat only accepts a trailing Z from Python 3.11 on
+    return datetime.fromisoformat(value.replace("Z", "+00:00"))
+
+def recent_documents(collection, since, limit=None):
+    # Chroma's $gt only compares numbers, so the RFC3339 strings written by
+    # -timestamp are compared here, newest first
+    results = collection.get(include=["documents", "metadatas"])
+    docs = []
+    for i, doc_id in enumerate(results["ids"]):
+        metadata = results["metadatas"][i] or {}
+        try:
+            ingested_at = parse_time(metadata[INGESTED_AT_KEY])
+        except (KeyError, TypeError, ValueError):
+            continue
+        if ingested_at > since:
+            docs.append((ingested_at, {
+                "id": doc_id,
+                "document": results["documents"][i],
+                "metadata": metadata,
+            }))
+    docs.sort(key=lambda d: d[0], reverse=True)
+    if limit is not None:
+        docs = docs[:limit]
+    return [doc for _, doc in docs]
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+
+        # Check that the since option is provided
+        if args or "since" not in options:
+            raise ValueError("Usage: python recent_documents.py --since=RFC3339 [--limit=N] [--collection=NAME]")
+
+        since = parse_time(options["since"])
+        limit = int(options["limit"]) if "limit" in options else None
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Get the Chroma collection, which a read never creates
+        collection = get_existing_collection(client, options.get("collection", "documents"))
+
+        print(json.dumps(recent_documents(collection, since, limit)))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reembedTimePerDocument is how much of the default -timeout each stored
+// document adds to a re-embedding run.
+const reembedTimePerDocument = 50 * time.Millisecond
+
+// reembedProgress is one line reembed_collection.py prints after a batch.
+type reembedProgress struct {
+	Reembedded int `json:"reembedded"`
+	Total      int `json:"total"`
+}
+
+// runReembed handles `pvdb reembed -from text-embedding-ada-002 -to
+// text-embedding-3-small`, which recomputes every stored embedding with the
+// new model from the stored document text, showing a progress bar as
+// reembed_collection.py reports each batch. Unless -timeout is given, the
+// timeout grows with the collection size.
+func runReembed(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("reembed")
+	from := fs.String("from", "", "embedding model the collection was built with")
+	to := fs.String("to", "", "embedding model to re-embed the collection with")
+	batchSize := fs.Int("batch-size", defaultBatchSize, "documents to re-embed per request")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	switch {
+	case *from == "" || *to == "":
+		return nil, invalidArgs(errors.New("usage: pvdb reembed -from MODEL -to MODEL"))
+	case *from == *to:
+		return nil, invalidArgsf("-from and -to are both %s; nothing to re-embed", *from)
+	case *batchSize <= 0:
+		return nil, invalidArgsf("-batch-size must be positive, got %d", *batchSize)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+	if err := common.requireOpenAIKey(); err != nil {
+		return nil, err
+	}
+
+	result, ran, err := common.runScript(ctx, python, "count_documents.py", nil)
+	if err != nil {
+		return nil, err
+	}
+	scriptArgs := []string{"--from=" + *from, "--to=" + *to, "--batch-size=" + strconv.Itoa(*batchSize)}
+	if !ran {
+		_, _, err := common.streamScript(ctx, python, "reembed_collection.py", scriptArgs, io.Discard)
+		return dryRunSummary(false), err
+	}
+	total, err := parseCount("count_documents.py", result.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	if !common.isSet("timeout") {
+		common.timeout += time.Duration(total) * reembedTimePerDocument
+	}
+
+	bar := &progressBar{out: cli.stderr, redraw: cli.stderr == io.Writer(os.Stderr) && isTerminal(os.Stderr)}
+	lines := &lineWriter{line: func(line string) {
+		var p reembedProgress
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			slog.Warn("unexpected reembed_collection.py output", "line", line)
+			return
+		}
+		bar.update(p.Reembedded, p.Total)
+	}}
+	_, _, err = common.streamScript(ctx, python, "reembed_collection.py", scriptArgs, lines)
+	lines.flush()
+	bar.finish()
+	if err != nil {
+		return nil, err
+	}
+	audit.Documents = bar.done
+	common.replaceEmbeddingConfig(embeddingConfig{Embedder: embedderOpenAI, EmbeddingModel: *to})
+	fmt.Fprintf(humanOut(), "re-embedded %d documents in collection '%s' from %s to %s\n", bar.done, common.collection, *from, *to)
+	return summary{"collection": common.collection, "reembedded": bar.done, "from": *from, "to": *to}, nil
+}
+
+// lineWriter calls line for every complete line written to it.
+type lineWriter struct {
+	line    func(string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if line := strings.TrimSpace(string(w.partial[:i])); line != "" {
+			w.line(line)
+		}
+		w.partial = w.partial[i+1:]
+	}
+}
+
+// flush passes on a final line that lacked a newline.
+func (w *lineWriter) flush() {
+	if line := strings.TrimSpace(string(w.partial)); line != "" {
+		w.line(line)
+	}
+	w.partial = nil
+}
+
+// progressBarWidth is how many characters the bar itself takes.
+const progressBarWidth = 30
+
+// progressBar draws the progress of a long script. On a terminal it redraws
+// one line in place; elsewhere it prints a line per update.
+type progressBar struct {
+	out         io.Writer
+	redraw      bool
+	done, total int
+}
+
+// update draws the bar for done of total documents.
+func (b *progressBar) update(done, total int) {
+	b.done, b.total = done, total
+	filled := progressBarWidth
+	if total > 0 {
+		filled = min(done*progressBarWidth/total, progressBarWidth)
+	}
+	line := fmt.Sprintf("[%s%s] %d/%d documents", strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), done, total)
+	if b.redraw {
+		fmt.Fprint(b.out, "\r"+line)
+	} else {
+		fmt.Fprintln(b.out, line)
+	}
+}
+
+// finish ends the redrawn line, if any.
+func (b *progressBar) finish() {
+	if b.redraw && b.total > 0 {
+		fmt.Fprintln(b.out)
+	}
+}
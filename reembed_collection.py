@@ -0,0 +1,50 @@
+import chromadb
+import json
+import sys
+
+from add_documents import EMBEDDING_MODEL_KEY, create_openai_ef, create_or_get_collection, load_openai_key, split_named_args, open_client
+
+def reembed_collection(collection, ef, batch_size, out):
+    # Replace every stored embedding with one computed by ef from the stored
+    # document text, printing {"reembedded", "total"} after each batch
+    total = collection.count()
+    done = 0
+    while done < total:
+        page = collection.get(limit=batch_size, offset=done, include=["documents"])
+        if not page["ids"]:
+            break
+        collection.update(ids=page["ids"], embeddings=ef(page["documents"]))
+        done += len(page["ids"])
+        out.write(json.dumps({"reembedded": done, "total": total}) + "\n")
+        out.flush()
+    return done
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args or "from" not in options or "to" not in options:
+            raise ValueError("Usage: python reembed_collection.py --from=MODEL --to=MODEL [--batch-size=N] [--collection=NAME]")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Create or get the Chroma collection
+        collection = create_or_get_collection(client, options.get("collection", "documents"))
+
+        metadata = dict(collection.metadata or {})
+        recorded = metadata.get(EMBEDDING_MODEL_KEY)
+        if recorded and recorded != options["from"]:
+            raise ValueError(f"collection '{collection.name}' was built with {recorded}, not {options['from']}")
+
+        ef = create_openai_ef(api_key=load_openai_key(), model_name=options["to"])
+        reembed_collection(collection, ef, int(options.get("batch-size", "256")), sys.stdout)
+
+        # Record the new model so queries check against it
+        metadata[EMBEDDING_MODEL_KEY] = options["to"]
+        collection.modify(metadata=metadata)
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
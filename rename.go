@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// runRename handles `pvdb rename -from old -to new`, renaming a collection in
+// place through rename_collection.py instead of exporting and re-importing
+// it. It refuses to replace an existing collection unless -overwrite is
+// given.
+func runRename(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("rename")
+	from := fs.String("from", "", "collection to rename")
+	to := fs.String("to", "", "new name of the collection")
+	overwrite := fs.Bool("overwrite", false, "delete the collection already named -to before renaming")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *from == "" || *to == "" {
+		return nil, invalidArgs(errors.New("usage: pvdb rename -from COLLECTION -to COLLECTION"))
+	}
+	for _, name := range []string{*from, *to} {
+		if err := validateCollectionName(name); err != nil {
+			return nil, err
+		}
+	}
+	if *from == *to {
+		return nil, invalidArgsf("-from and -to are both '%s'", *from)
+	}
+	if common.isSet("collection") {
+		return nil, invalidArgs(errors.New("-collection cannot be combined with -from"))
+	}
+	common.collection = *from
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	scriptArgs := []string{*to}
+	if *overwrite {
+		scriptArgs = append(scriptArgs, "--overwrite")
+	}
+	collections, ran, err := common.listCollections(ctx, python)
+	if err != nil {
+		return nil, err
+	}
+	if ran {
+		hasName := func(name string) func(collectionInfo) bool {
+			return func(c collectionInfo) bool { return c.Name == name }
+		}
+		if !slices.ContainsFunc(collections, hasName(*from)) {
+			return nil, fmt.Errorf("collection '%s' does not exist", *from)
+		}
+		if i := slices.IndexFunc(collections, hasName(*to)); i >= 0 && !*overwrite {
+			return nil, fmt.Errorf("collection '%s' already exists with %d documents; pass -overwrite to replace it", *to, collections[i].Count)
+		}
+	}
+
+	result, ran, err := common.runScript(ctx, python, "rename_collection.py", scriptArgs)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+	var renamed collectionInfo
+	if err := json.Unmarshal([]byte(result.Stdout), &renamed); err != nil {
+		return nil, fmt.Errorf("rename_collection.py returned invalid JSON: %w", err)
+	}
+	common.moveEmbeddingConfig(renamed.Name)
+	fmt.Fprintf(humanOut(), "renamed collection '%s' to '%s' (%d documents)\n", *from, renamed.Name, renamed.Count)
+	return summary{"from": *from, "collection": renamed.Name, "documents": renamed.Count}, nil
+}
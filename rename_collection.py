@@ -0,0 +1,35 @@
+import chromadb
+import json
+import sys
+
+from add_documents import collection_names, split_named_args, open_client
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if len(args) != 1:
+            raise ValueError("Usage: python rename_collection.py <new_name> [--collection=NAME] [--overwrite]")
+
+        new_name = args[0]
+        collection_name = options.get("collection", "documents")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # The launcher has already checked the names; a collection already
+        # holding the new name is only replaced with --overwrite
+        if new_name in collection_names(client):
+            if "overwrite" not in options:
+                raise ValueError(f"Collection {new_name} already exists.")
+            client.delete_collection(name=new_name)
+
+        collection = client.get_collection(collection_name)
+        collection.modify(name=new_name)
+
+        print(json.dumps({"name": new_name, "count": client.get_collection(new_name).count()}))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runReset handles `pvdb reset -collection foo`, deleting the whole
+// collection through reset_collection.py. The confirmation guard lives here
+// rather than in the script so nothing is deleted without consent: the user
+// answers a y/N prompt on a terminal, and otherwise must pass -force.
+func runReset(ctx context.Context, python string, stdin *os.File, args []string) (summary, error) {
+	fs := newFlagSet("reset")
+	force := fs.Bool("force", false, "delete without asking for confirmation")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+	if common.dryRun {
+		_, _, err := common.runScript(ctx, python, "reset_collection.py", nil)
+		return dryRunSummary(false), err
+	}
+
+	result, _, err := common.runScript(ctx, python, "count_documents.py", nil)
+	if err != nil {
+		return nil, err
+	}
+	n, err := parseCount("count_documents.py", result.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(humanOut(), "collection '%s' contains %d documents\n", common.collection, n)
+
+	if !*force {
+		if !isTerminal(stdin) {
+			return nil, invalidArgsf("refusing to reset collection '%s' without confirmation; pass -force when stdin is not a terminal", common.collection)
+		}
+		ok, err := confirm(stdin, fmt.Sprintf("Delete collection '%s' and its %d documents? [y/N] ", common.collection, n))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("reset cancelled")
+		}
+	}
+
+	if _, _, err := common.runScript(ctx, python, "reset_collection.py", nil); err != nil {
+		return nil, err
+	}
+	common.removeEmbeddingConfig()
+	fmt.Fprintf(humanOut(), "deleted collection '%s' (%d documents)\n", common.collection, n)
+	return summary{"collection": common.collection, "deleted": n}, nil
+}
+
+// confirm writes prompt to stderr and reports whether the answer read from
+// stdin is yes.
+func confirm(stdin *os.File, prompt string) (bool, error) {
+	fmt.Fprint(cli.stderr, prompt)
+	answer, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("reading confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,25 @@
+import chromadb
+import sys
+
+from add_documents import split_named_args, open_client
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        if args:
+            raise ValueError("Usage: python reset_collection.py [--collection=NAME]")
+
+        collection_name = options.get("collection", "documents")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # The launcher has already asked for confirmation
+        client.delete_collection(name=collection_name)
+        print(f"Collection {collection_name} deleted.")
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
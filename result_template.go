@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// hitFormat renders query hits: through the -result-template when one was
+// given, as a Markdown list item or a JSON line under -format markdown or
+// ndjson, otherwise as the line query prints by default.
+type hitFormat struct {
+	template *template.Template
+	// layout is the -format: formatText, formatMarkdown or formatNDJSON.
+	layout            string
+	includeEmbeddings bool
+	// truncate is the -truncate-output rune limit documents are clipped
+	// to, 0 for none.
+	truncate int
+}
+
+// templateEscapes turns the escapes people type in a shell-quoted
+// -result-template into the characters they stand for.
+var templateEscapes = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n")
+
+// parseResultTemplate parses text as a -result-template and renders it once
+// against a sample hit, so a template naming a field queryHit lacks fails
+// before any script is launched.
+func parseResultTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("result").Parse(templateEscapes.Replace(text))
+	if err != nil {
+		return nil, invalidArgsf("-result-template: %w", err)
+	}
+	similarity := 1.0
+	sample := queryHit{Metadata: map[string]any{}, Embedding: []float64{}, Similarity: &similarity}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, invalidArgsf("-result-template: %w; the fields are %s", err, strings.Join(hitFields(), ", "))
+	}
+	return tmpl, nil
+}
+
+// hitFields lists the fields a -result-template can use.
+func hitFields() []string {
+	t := reflect.TypeOf(queryHit{})
+	fields := make([]string, t.NumField())
+	for i := range fields {
+		fields[i] = "." + t.Field(i).Name
+	}
+	return fields
+}
+
+// printNote writes a line about the results that follows them, set apart
+// from a Markdown list so it doesn't continue the last item. An NDJSON
+// consumer expects nothing but hits on stdout, so there the note goes to
+// stderr.
+func (f hitFormat) printNote(w io.Writer, format string, a ...any) {
+	switch f.layout {
+	case formatMarkdown:
+		fmt.Fprintln(w)
+	case formatNDJSON:
+		w = cli.stderr
+	}
+	fmt.Fprintf(w, format+"\n", a...)
+}
+
+// print writes h to w, ending it with a newline when the template doesn't.
+// Markdown items and JSON lines are never indented, and JSON lines keep the
+// whole document, as -json does.
+func (f hitFormat) print(w io.Writer, h queryHit, indent string) error {
+	if f.layout == formatNDJSON {
+		return writeJSONLine(w, h)
+	}
+	if f.truncate > 0 {
+		h.Document = truncateRunes(h.Document, f.truncate)
+	}
+	if f.layout == formatMarkdown {
+		_, err := io.WriteString(w, h.markdown(f.includeEmbeddings))
+		return err
+	}
+	if f.template == nil {
+		_, err := fmt.Fprintln(w, indent+h.line(f.includeEmbeddings))
+		return err
+	}
+	var b strings.Builder
+	if err := f.template.Execute(&b, h); err != nil {
+		return fmt.Errorf("-result-template: %w", err)
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	_, err := io.WriteString(w, indent+out)
+	return err
+}
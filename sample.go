@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// sampleResult is what sample_documents.py prints: the sampled documents and
+// how many the collection holds.
+type sampleResult struct {
+	Total     int              `json:"total"`
+	Documents []storedDocument `json:"documents"`
+}
+
+// runSample handles `pvdb sample -n 20 -seed 42`, showing documents drawn at
+// random from the collection for spot checks. The same seed draws the same
+// sample from an unchanged collection; without -seed one is picked and
+// printed so the sample can be repeated.
+func runSample(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("sample")
+	n := fs.Int("n", 10, "number of documents to sample")
+	seed := fs.Int64("seed", 0, "seed of the random sample, to reproduce it (default: a new one each run)")
+	width := fs.Int("width", 60, "maximum characters of each document to show")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if *n <= 0 {
+		return nil, invalidArgsf("-n must be positive, got %d", *n)
+	}
+	if *width <= 0 {
+		return nil, invalidArgsf("-width must be positive, got %d", *width)
+	}
+	if !common.isSet("seed") {
+		*seed = rand.Int63n(1 << 31)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	result, ran, err := common.runScript(ctx, python, "sample_documents.py", []string{strconv.Itoa(*n), strconv.FormatInt(*seed, 10)})
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+	var sample sampleResult
+	if err := json.Unmarshal([]byte(result.Stdout), &sample); err != nil {
+		return nil, fmt.Errorf("sample_documents.py returned invalid JSON: %w", err)
+	}
+	audit.Documents = len(sample.Documents)
+	if sample.Total < *n {
+		fmt.Fprintf(statusOut(), "collection '%s' holds only %d documents; showing all of them\n", common.collection, sample.Total)
+	}
+	if jsonOutput {
+		return summary{"collection": common.collection, "seed": *seed, "total": sample.Total, "documents": sample.Documents}, nil
+	}
+	fmt.Fprintf(statusOut(), "%d of %d documents sampled with -seed %d\n", len(sample.Documents), sample.Total, *seed)
+	printDocumentTable(sample.Documents, *width)
+	return nil, nil
+}
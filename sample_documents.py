@@ -0,0 +1,50 @@
+import chromadb
+import json
+import random
+import sys
+
+from add_documents import split_named_args, open_client
+
+def sample_collection(collection, n, seed):
+    # Sort the ids so the same seed picks the same documents whatever order
+    # the store returns them in
+    ids = sorted(collection.get(include=[])["ids"])
+    total = len(ids)
+    picked = random.Random(seed).sample(ids, min(n, total))
+    if not picked:
+        return {"total": total, "documents": []}
+    results = collection.get(ids=picked, include=["documents", "metadatas"])
+    by_id = {}
+    for i, doc_id in enumerate(results["ids"]):
+        by_id[doc_id] = {
+            "id": doc_id,
+            "document": results["documents"][i],
+            "metadata": results["metadatas"][i],
+        }
+    # Keep the order the sample was drawn in
+    return {"total": total, "documents": [by_id[doc_id] for doc_id in picked if doc_id in by_id]}
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+
+        # Check if the count and seed arguments are provided
+        if len(args) != 2:
+            raise ValueError("Usage: python sample_documents.py <n> <seed> [--collection=NAME]")
+
+        n = int(args[0])
+        seed = int(args[1])
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # A sample is only read, so a missing collection is an error
+        collection = client.get_collection(options.get("collection", "documents"))
+
+        print(json.dumps(sample_collection(collection, n, seed)))
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// selftestEcho is the script the selftest hands the payload to: it prints
+// the arguments it received as a JSON array.
+const selftestEcho = `import json
+import sys
+
+print(json.dumps(sys.argv[1:]))
+`
+
+// selftestPayload holds what has broken argument passing before: quotes and
+// backslashes, shell metacharacters, newlines and tabs, text outside ASCII,
+// a document that looks like a named argument, an empty document and every
+// type of metadata value, with a precomputed embedding.
+func selftestPayload() ingestPayload {
+	return ingestPayload{
+		Documents: []string{
+			`she said "jolof" isn't 'fried rice'`,
+			`C:\path\to\file \" \\ \n`,
+			"$(rm -rf /) `whoami` ; | & > < * ? ~ !",
+			"line one\nline two\ttabbed\r\n",
+			"ẹ̀fọ́ riro, 日本語, emoji 🍲, RTL שלום",
+			"--collection=other",
+			"",
+		},
+		Metadatas: []map[string]any{
+			{"quote": `"'`, "backslash": `\`},
+			{"number": 3.25, "negative": -1e-9, "big": 9007199254740991.0},
+			{"bool": true, "false": false},
+			{"newline": "a\nb"},
+			{"unicode": "¿Qué?"},
+			{"--flag": "--value=1"},
+			{},
+		},
+		IDs:        []string{"id 1", `id"2`, `id\3`, "id\n4", "ïd5", "--ids=6", "-"},
+		Embeddings: [][]float64{{0.1, -2.5e-8, 1e10}, nil, nil, nil, nil, nil, nil},
+	}
+}
+
+// selftestCheck is the outcome of one round trip.
+type selftestCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// runSelftest handles `pvdb selftest`, which sends a known awkward payload
+// through buildLauncherCommand in both the positional and the -named-args
+// form and checks that it comes back intact: first by decoding the
+// command's own arguments, then, unless -internal-only, by having the
+// interpreter echo the arguments it actually received. Any mismatch fails
+// the command.
+func runSelftest(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("selftest")
+	internalOnly := fs.Bool("internal-only", false, "only decode the built command's arguments, without launching the interpreter")
+	timeout := fs.Duration("timeout", 30*time.Second, "maximum time the interpreter may take to echo the arguments")
+	jsonFlag(fs)
+	logFormatFlag(fs)
+	configFlag(fs)
+	verbosityFlags(fs)
+	logPrefixFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if fs.NArg() > 0 {
+		return nil, invalidArgsf("unexpected arguments %q", fs.Args())
+	}
+
+	var echo string
+	if !*internalOnly {
+		dir, err := os.MkdirTemp("", "pvdb-selftest-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		echo = filepath.Join(dir, "print_args.py")
+		if err := os.WriteFile(echo, []byte(selftestEcho), 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	want := selftestPayload()
+	var checks []selftestCheck
+	failed := 0
+	record := func(name string, err error) {
+		c := selftestCheck{Name: name, OK: err == nil}
+		status := "ok"
+		if err != nil {
+			c.Error = err.Error()
+			status = "FAILED: " + c.Error
+			failed++
+		}
+		checks = append(checks, c)
+		fmt.Fprintf(humanOut(), "%-28s %s\n", name, status)
+	}
+	for _, named := range []bool{false, true} {
+		form := "positional"
+		if named {
+			form = "named"
+		}
+		sent, err := want.ScriptArgs(named)
+		if err != nil {
+			return nil, err
+		}
+		cmd := buildLauncherCommand(ctx, python, echo, "", sent)
+		// The script's arguments follow the interpreter, its own arguments
+		// and the script
+		built := cmd.Args[len(pythonArgs)+2:]
+		record(form+" command arguments", checkRoundTrip(want, sent, built, named))
+		if *internalOnly {
+			continue
+		}
+		runCtx, cancel := context.WithTimeout(ctx, *timeout)
+		cmd = buildLauncherCommand(runCtx, python, echo, "", sent)
+		result, err := runLauncher(cmd, defaultMaxOutputBytes)
+		err = launchError(runCtx, *timeout, err)
+		cancel()
+		if err == nil {
+			var received []string
+			if err = json.Unmarshal([]byte(result.Stdout), &received); err != nil {
+				err = fmt.Errorf("the echo script printed %q: %w", result.Stdout, err)
+			} else {
+				err = checkRoundTrip(want, sent, received, named)
+			}
+		}
+		record(form+" interpreter arguments", err)
+	}
+
+	sum := summary{"checks": checks}
+	if failed > 0 {
+		return sum, fmt.Errorf("selftest failed: %d of %d round trips did not preserve the payload", failed, len(checks))
+	}
+	return sum, nil
+}
+
+// checkRoundTrip compares the arguments that came back with the ones sent,
+// then decodes them and compares the payload with want, reporting the first
+// difference.
+func checkRoundTrip(want ingestPayload, sent, got []string, named bool) error {
+	if len(got) != len(sent) {
+		return fmt.Errorf("sent %d arguments, got %d: %q", len(sent), len(got), got)
+	}
+	for i := range sent {
+		if got[i] != sent[i] {
+			return fmt.Errorf("argument %d: sent %q, got %q", i, sent[i], got[i])
+		}
+	}
+
+	var decoded ingestPayload
+	targets := []struct {
+		name string
+		into any
+	}{{"documents", &decoded.Documents}, {"metadatas", &decoded.Metadatas}, {"ids", &decoded.IDs}, {"embeddings", &decoded.Embeddings}}
+	for i, arg := range got {
+		t := targets[i]
+		if named || t.name == "embeddings" {
+			value, ok := strings.CutPrefix(arg, "--"+t.name+"=")
+			if !ok {
+				return fmt.Errorf("argument %d is not --%s=: %q", i, t.name, arg)
+			}
+			arg = value
+		}
+		if err := json.Unmarshal([]byte(arg), t.into); err != nil {
+			return fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+	for _, field := range []struct {
+		name      string
+		want, got any
+	}{
+		{"documents", want.Documents, decoded.Documents},
+		{"metadatas", want.Metadatas, decoded.Metadatas},
+		{"ids", want.IDs, decoded.IDs},
+		{"embeddings", want.Embeddings, decoded.Embeddings},
+	} {
+		if !reflect.DeepEqual(field.want, field.got) {
+			return errors.New(describeMismatch(field.name, field.want, field.got))
+		}
+	}
+	return nil
+}
+
+// describeMismatch names the first element where the two slices differ.
+func describeMismatch(name string, want, got any) string {
+	w, g := reflect.ValueOf(want), reflect.ValueOf(got)
+	for i := 0; i < min(w.Len(), g.Len()); i++ {
+		if !reflect.DeepEqual(w.Index(i).Interface(), g.Index(i).Interface()) {
+			return fmt.Sprintf("%s[%d]: sent %#v, got %#v", name, i, w.Index(i).Interface(), g.Index(i).Interface())
+		}
+	}
+	return fmt.Sprintf("%s: sent %d elements, got %d", name, w.Len(), g.Len())
+}
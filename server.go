@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+// shutdownGrace is how long in-flight requests get to finish after SIGTERM.
+const shutdownGrace = 30 * time.Second
+
+// maxRequestBody caps the size of a POST /documents payload.
+const maxRequestBody = 32 << 20
+
+// runServe handles `pvdb serve -addr :8080`, exposing ingestion over HTTP until
+// ctx is cancelled by SIGINT or SIGTERM.
+func runServe(ctx context.Context, python string, args []string) error {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	common := registerCommonFlags(fs)
+	common.embedderFlag(fs)
+	common.collectionMetadataFlag(fs)
+	common.namedArgsFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return invalidArgs(err)
+	}
+	if common.dryRun {
+		return invalidArgs(errors.New("serve does not support -dry-run"))
+	}
+	if common.interactive {
+		return invalidArgs(errors.New("serve does not support -interactive"))
+	}
+	if err := common.validate(); err != nil {
+		return err
+	}
+	if err := common.requireOpenAIKey(); err != nil {
+		return err
+	}
+	script, err := common.scriptPath("add_documents.py")
+	if err != nil {
+		return err
+	}
+	if err := common.ensureReady(ctx, python); err != nil {
+		return err
+	}
+	common.namedArgs = common.payloadNamedArgs(ctx, python, script)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newServeMux(python, script, common),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", *addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// newServeMux routes the ingestion and health endpoints.
+func newServeMux(python, script string, common *commonFlags) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/documents", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		handleAddDocuments(w, r, python, script, common)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		path, err := exec.LookPath(python)
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "python": path})
+	})
+	return mux
+}
+
+// handleAddDocuments ingests a JSON {documents, metadatas, ids} body through
+// script and replies with the captured LauncherResult. Requests writing to
+// the on-disk store run one at a time.
+func handleAddDocuments(w http.ResponseWriter, r *http.Request, python, script string, common *commonFlags) {
+	var payload ingestPayload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid JSON body: %v", err)})
+		return
+	}
+	if err := pvdb.Validate(payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	scriptArgs, err := payload.ScriptArgs(common.namedArgs)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Concurrent writers corrupt an on-disk store, so requests against one
+	// take turns; a Chroma server handles its own concurrency
+	if common.server == nil && !common.noPersist {
+		release, err := acquirePersistWrite(r.Context(), common.persistDir)
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
+		}
+		defer release()
+	}
+	if err := pvdb.AcquireProcess(r.Context()); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	defer pvdb.ReleaseProcess()
+	ctx, cancel := context.WithTimeout(r.Context(), common.timeout)
+	defer cancel()
+	result, err := runLauncher(common.command(ctx, python, script, scriptArgs), common.maxOutputBytes)
+	err = launchError(ctx, common.timeout, err)
+
+	status := http.StatusOK
+	var timeoutErr *timeoutError
+	switch {
+	case errors.As(err, &timeoutErr):
+		status = http.StatusGatewayTimeout
+	case err != nil:
+		status = http.StatusInternalServerError
+	}
+	if err != nil {
+		slog.Error("POST /documents failed", "err", err)
+	} else {
+		common.recordEmbeddingConfig()
+	}
+	writeJSON(w, status, result)
+}
+
+// writeJSON replies with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("writing response", "err", err)
+	}
+}
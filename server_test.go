@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"perrsistant-vector-db/pvdb"
+)
+
+func TestServeSerializesWritesToOnePersistDir(t *testing.T) {
+	const sleep, requests = 300 * time.Millisecond, 2
+	fakeLauncher(t, func(script string, args []string) fakeScript {
+		answer := addScript(script, args)
+		answer.Sleep = sleep
+		return answer
+	})
+	common := testCommonFlags(t, "-named-args=false")
+	// Enough process slots that only the write lock can hold a request back
+	if err := pvdb.SetMaxProcesses(requests); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pvdb.SetMaxProcesses(runtime.NumCPU()) })
+	mux := newServeMux("python3", "add_documents.py", common)
+
+	var wg sync.WaitGroup
+	codes := make([]int, requests)
+	start := time.Now()
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := `{"documents": ["jolof rice"], "metadatas": [{}], "ids": ["id` + strconv.Itoa(i) + `"]}`
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/documents", strings.NewReader(body)))
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d answered %d, want 200", i, code)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < requests*sleep {
+		t.Errorf("%d writes of %s each finished in %s, so they overlapped", requests, sleep, elapsed)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// killGrace is how long a signalled script may take to exit before it is
+// killed.
+const killGrace = 5 * time.Second
+
+// receivedSignal holds the SIGINT or SIGTERM that cancelled the run, so it
+// can be forwarded to the scripts.
+var receivedSignal atomic.Value
+
+// notifyContext returns a context cancelled by the first SIGINT or SIGTERM,
+// remembering which one arrived. After that the default handling is restored,
+// so a second Ctrl-C kills the launcher at once.
+func notifyContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case sig := <-sigs:
+			receivedSignal.Store(sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// cancelSignal is the signal sent to a script whose context is done: the one
+// the launcher received, or SIGTERM for a timeout.
+func cancelSignal() os.Signal {
+	if sig, ok := receivedSignal.Load().(os.Signal); ok {
+		return sig
+	}
+	return syscall.SIGTERM
+}
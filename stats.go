@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// collectionStats is what collection_stats.py reports about a collection.
+// An empty collection has zero dimensions, average length and keys.
+type collectionStats struct {
+	Name                  string         `json:"name"`
+	Count                 int            `json:"count"`
+	Dimensions            int            `json:"dimensions"`
+	DistanceMetric        string         `json:"distance_metric"`
+	AverageDocumentLength float64        `json:"average_document_length"`
+	MetadataKeys          map[string]int `json:"metadata_keys"`
+}
+
+// runStats handles `pvdb stats -collection foo`, reporting a collection's
+// size, embedding dimension, distance metric, average document length and
+// how many documents carry each metadata key.
+func runStats(ctx context.Context, python string, args []string) (summary, error) {
+	fs := newFlagSet("stats")
+	common := registerCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if err := common.validate(); err != nil {
+		return nil, err
+	}
+
+	result, ran, err := common.runScript(ctx, python, "collection_stats.py", nil)
+	if err != nil || !ran {
+		return dryRunSummary(ran), err
+	}
+	var stats collectionStats
+	if err := json.Unmarshal([]byte(result.Stdout), &stats); err != nil {
+		return nil, fmt.Errorf("collection_stats.py returned invalid JSON: %w", err)
+	}
+	if stats.MetadataKeys == nil {
+		stats.MetadataKeys = map[string]int{}
+	}
+	if jsonOutput {
+		return summary{"stats": stats}, nil
+	}
+	printStats(stats)
+	return nil, nil
+}
+
+// printStats renders stats as a report, listing metadata keys from the most
+// to the least frequent.
+func printStats(stats collectionStats) {
+	w := humanOut()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "collection\t%s\n", stats.Name)
+	fmt.Fprintf(tw, "documents\t%d\n", stats.Count)
+	fmt.Fprintf(tw, "dimensions\t%d\n", stats.Dimensions)
+	fmt.Fprintf(tw, "distance metric\t%s\n", stats.DistanceMetric)
+	fmt.Fprintf(tw, "average length\t%.1f characters\n", stats.AverageDocumentLength)
+	tw.Flush()
+	if len(stats.MetadataKeys) == 0 {
+		fmt.Fprintln(w, "no metadata keys")
+		return
+	}
+
+	keys := make([]string, 0, len(stats.MetadataKeys))
+	for key := range stats.MetadataKeys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if n := stats.MetadataKeys[b] - stats.MetadataKeys[a]; n != 0 {
+			return n
+		}
+		return strings.Compare(a, b)
+	})
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METADATA KEY\tDOCUMENTS\tSHARE")
+	for _, key := range keys {
+		n := stats.MetadataKeys[key]
+		fmt.Fprintf(tw, "%s\t%d\t%.0f%%\n", key, n, 100*float64(n)/float64(max(stats.Count, 1)))
+	}
+	tw.Flush()
+}
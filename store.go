@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// defaultCollection is the Chroma collection used unless -collection says
+// otherwise.
+const defaultCollection = "documents"
+
+// defaultPersistDir is where the scripts keep the Chroma store unless
+// -persist-dir says otherwise.
+const defaultPersistDir = "db"
+
+// collectionNamePattern mirrors the collection names Chroma accepts.
+var collectionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,63}$`)
+
+// storeFlags select the Chroma store and collection a script works on.
+type storeFlags struct {
+	collection string
+	persistDir string
+	// chromaURL names a Chroma server to use instead of persistDir.
+	chromaURL string
+	server    *url.URL
+	// noPersist runs the scripts against an in-memory store instead.
+	noPersist bool
+	// noRoot refuses to create the persist dir as root.
+	noRoot bool
+}
+
+// register defines the store flags on fs.
+func (s *storeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.collection, "collection", defaults.Collection, "Chroma collection to operate on")
+	fs.StringVar(&s.persistDir, "persist-dir", defaults.PersistDir, "directory holding the persistent Chroma store, relative to the work dir")
+	fs.StringVar(&s.chromaURL, "chroma-url", "", "URL of a Chroma server to use instead of -persist-dir, e.g. http://chroma:8000")
+	fs.BoolVar(&s.noPersist, "no-persist", false, "use an in-memory Chroma store that is discarded when each script exits, for tests")
+	fs.BoolVar(&s.noRoot, "no-root", false, "refuse to create the persist dir when running as root instead of only warning")
+}
+
+// validate checks the collection name, makes sure the persist dir exists
+// and, unless the subcommand only reads the store, is writable, and locks it
+// for the subcommand.
+func (s *storeFlags) validate() error {
+	if err := validateCollectionName(s.collection); err != nil {
+		return err
+	}
+	if s.server != nil || s.noPersist {
+		return nil
+	}
+	if err := preparePersistDir(s.persistDir, s.noRoot); err != nil {
+		return err
+	}
+	// Readers share the lock, and a read-only store serves them fine
+	if !sharedPersistLock {
+		if err := checkWritable(s.persistDir); err != nil {
+			return err
+		}
+	}
+	return lockPersistDir(s.persistDir)
+}
+
+// parseChromaURL checks -chroma-url, which must be an http or https URL with
+// a host.
+func (s *storeFlags) parseChromaURL() error {
+	u, err := url.Parse(s.chromaURL)
+	if err != nil {
+		return invalidArgsf("invalid -chroma-url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return invalidArgsf("invalid -chroma-url %q: scheme must be http or https", s.chromaURL)
+	}
+	if u.Hostname() == "" {
+		return invalidArgsf("invalid -chroma-url %q: missing host", s.chromaURL)
+	}
+	s.server = u
+	return nil
+}
+
+// scriptArgs appends the collection and, for an on-disk store, the persist
+// dir to a script's arguments as named arguments.
+func (s *storeFlags) scriptArgs(args []string) []string {
+	args = appendCollectionArg(args, s.collection)
+	if s.server != nil || s.noPersist {
+		return args
+	}
+	return append(args, "--persist-dir="+s.persistDir)
+}
+
+// environ exports the store to the scripts: the persist dir as
+// CHROMA_PERSIST_DIR, -no-persist as EPHEMERAL=1, or the -chroma-url server
+// as CHROMA_SERVER_HOST, CHROMA_SERVER_HTTP_PORT and CHROMA_SERVER_SSL.
+func (s *storeFlags) environ() []string {
+	if s.noPersist {
+		return []string{"EPHEMERAL=1"}
+	}
+	if s.server == nil {
+		return []string{"CHROMA_PERSIST_DIR=" + s.persistDir}
+	}
+	port := s.server.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[s.server.Scheme]
+	}
+	return []string{
+		"CHROMA_SERVER_HOST=" + s.server.Hostname(),
+		"CHROMA_SERVER_HTTP_PORT=" + port,
+		"CHROMA_SERVER_SSL=" + strconv.FormatBool(s.server.Scheme == "https"),
+	}
+}
+
+// validateCollectionName checks name against Chroma's naming rules.
+func validateCollectionName(name string) error {
+	if !collectionNamePattern.MatchString(name) {
+		return invalidArgsf("invalid collection name %q: must be 3-63 characters from [a-zA-Z0-9._-]", name)
+	}
+	return nil
+}
+
+// appendCollectionArg adds the named --collection argument every script
+// accepts.
+func appendCollectionArg(args []string, name string) []string {
+	return append(args, "--collection="+name)
+}
+
+// preparePersistDir creates dir if needed. Creating it as root draws a
+// warning, or with noRoot an error.
+func preparePersistDir(dir string, noRoot bool) error {
+	if dir == "" {
+		return invalidArgsf("-persist-dir must not be empty")
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) && runningAsRoot() {
+		// A root-owned store can't be written by the non-root runs that
+		// usually follow
+		const pitfall = "it will be owned by root and later runs as other users will not be able to write to it"
+		if noRoot {
+			return invalidArgsf("refusing to create persist dir %s as root under -no-root: %s", dir, pitfall)
+		}
+		slog.Warn("creating the persist dir as root; "+pitfall+" (chown it, or pass -no-root to refuse)", "dir", dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return invalidArgsf("cannot create persist dir: %w", err)
+	}
+	return nil
+}
+
+// checkWritable fails clearly when the persist dir cannot be written, rather
+// than letting Chroma fail deep inside Python, by creating and removing a
+// probe file in it.
+func checkWritable(dir string) error {
+	probe, err := os.CreateTemp(dir, ".pvdb-write-check-*")
+	if err != nil {
+		return invalidArgsf("persist dir %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("removing write check file: %w", err)
+	}
+	return nil
+}
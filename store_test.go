@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestValidateProbesWritabilityOnlyForWriters(t *testing.T) {
+	if runtime.GOOS == "windows" || runningAsRoot() {
+		t.Skip("needs Unix permissions that apply to the test's user")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o755) })
+	saved := sharedPersistLock
+	t.Cleanup(func() { sharedPersistLock = saved })
+
+	for _, tt := range []struct {
+		name     string
+		readOnly bool
+		wantErr  bool
+	}{
+		{name: "read-only command", readOnly: true},
+		{name: "writing command", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(releasePersistLocks)
+			sharedPersistLock = tt.readOnly
+			s := storeFlags{collection: defaultCollection, persistDir: dir}
+			err := s.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() on a read-only persist dir: %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// streamQuery runs query_documents.py with --stream, which prints one JSON
+// hit per line, and prints each hit as soon as its line is decoded. Output
+// that isn't line-delimited hits, such as the columnar result of a script
+// without --stream support, is collected and printed once the script exits.
+// It returns how many hits were printed.
+func (c *commonFlags) streamQuery(ctx context.Context, python string, scriptArgs []string, maxDistance float64, asSimilarity bool, format hitFormat) (int, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := c.streamScript(ctx, python, "query_documents.py", append(scriptArgs, "--stream"), pw)
+		pw.Close()
+		done <- err
+	}()
+
+	var (
+		printed, dropped int
+		buffered         bytes.Buffer
+		warned           bool
+		printErr         error
+	)
+	show := func(h queryHit) {
+		if maxDistance > 0 && h.Distance > maxDistance {
+			dropped++
+			return
+		}
+		if asSimilarity {
+			if h.Metric == "cosine" {
+				similarity := cosineSimilarity(h.Distance)
+				h.Similarity = &similarity
+			} else if !warned {
+				warnNotCosine(c.collection, h.Metric)
+				warned = true
+			}
+		}
+		if err := format.print(cli.stdout, h, ""); err != nil && printErr == nil {
+			printErr = err
+		}
+		printed++
+	}
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(nil, int(max(c.maxOutputBytes, bufio.MaxScanTokenSize)))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if buffered.Len() == 0 {
+			var h queryHit
+			if json.Unmarshal(line, &h) == nil && h.ID != "" {
+				show(h)
+				continue
+			}
+		}
+		// Not a stream of hits: keep everything from here for the
+		// buffered parse
+		buffered.Write(line)
+		buffered.WriteByte('\n')
+	}
+	scanErr := scanner.Err()
+	// Let the script finish writing even if scanning stopped early
+	io.Copy(io.Discard, pr)
+	if err := <-done; err != nil || c.dryRun {
+		return printed, err
+	}
+	if scanErr != nil {
+		return printed, fmt.Errorf("reading query_documents.py output: %w", scanErr)
+	}
+
+	if buffered.Len() > 0 {
+		r, err := parseQueryResult(buffered.String())
+		if err != nil {
+			return printed, err
+		}
+		for _, h := range queryHits(r, 0) {
+			show(h)
+		}
+	}
+	audit.Documents = printed
+	if dropped > 0 {
+		format.printNote(cli.stdout, "dropped %d results further than %g", dropped, maxDistance)
+	}
+	return printed, printErr
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// strictJSON is set by -strict-json. Ingestion input is then rejected when
+// records carry unknown fields or a value is followed by trailing data.
+var strictJSON bool
+
+// strictJSONFlag defines -strict-json on fs.
+func strictJSONFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&strictJSON, "strict-json", false, "reject input records with unknown fields and JSON values followed by trailing data, reporting the byte offset")
+}
+
+// decodeInput decodes the single JSON value in data into v, strictly under
+// -strict-json.
+func decodeInput(data []byte, v any) error {
+	if !strictJSON {
+		return json.Unmarshal(data, v)
+	}
+	return decodeStrict(json.NewDecoder(bytes.NewReader(data)), v)
+}
+
+// decodeStrict decodes one value from dec into v, rejecting unknown struct
+// fields and anything but whitespace after the value. Errors carry the byte
+// offset of the problem.
+func decodeStrict(dec *json.Decoder, v any) error {
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return err
+		}
+		return fmt.Errorf("at byte offset %d: %w", jsonErrorOffset(dec, err), err)
+	}
+	// More misses a stray closing bracket, so look for the end of the input
+	end := dec.InputOffset()
+	if dec.More() {
+		return fmt.Errorf("at byte offset %d: unexpected data after the JSON value", end)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("at byte offset %d: unexpected data after the JSON value", end)
+	}
+	return nil
+}
+
+// jsonErrorOffset is where in the input err happened, or how far dec had
+// read when the error doesn't say.
+func jsonErrorOffset(dec *json.Decoder, err error) int64 {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		return typeErr.Offset
+	}
+	return dec.InputOffset()
+}
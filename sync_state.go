@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// syncState is the -state file of an incremental -dir ingestion: the
+// modification time each file had when it was last ingested, keyed by its
+// absolute path.
+type syncState struct {
+	Files map[string]time.Time `json:"files"`
+}
+
+// loadSyncState reads the state file at path; a missing file is an empty
+// state, as on the first sync.
+func loadSyncState(path string) (*syncState, error) {
+	s := &syncState{Files: map[string]time.Time{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("-state %s is not a pvdb state file: %w", path, err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]time.Time{}
+	}
+	return s, nil
+}
+
+// save writes the state to path with writeFileAtomic, so an interrupted run
+// leaves the previous state intact.
+func (s *syncState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("cannot write -state: %w", err)
+	}
+	return nil
+}
+
+// changedFiles returns the files whose modification time differs from the
+// one recorded in s, with the times they have now; the rest are unchanged
+// since the last sync.
+func (s *syncState) changedFiles(files []string) (changed []string, modTimes map[string]time.Time, err error) {
+	modTimes = make(map[string]time.Time, len(files))
+	for _, f := range files {
+		key, err := filepath.Abs(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		modTimes[f] = info.ModTime()
+		if recorded, ok := s.Files[key]; ok && recorded.Equal(info.ModTime()) {
+			continue
+		}
+		changed = append(changed, f)
+	}
+	return changed, modTimes, nil
+}
+
+// record notes that the files ingested without error had the given
+// modification times.
+func (s *syncState) record(outcomes []fileOutcome, modTimes map[string]time.Time) error {
+	for _, o := range outcomes {
+		if o.Error != "" {
+			continue
+		}
+		key, err := filepath.Abs(o.File)
+		if err != nil {
+			return err
+		}
+		s.Files[key] = modTimes[o.File]
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"sync"
+	"time"
+)
+
+// traceOutput is set by -trace.
+var traceOutput bool
+
+// traceFlag defines -trace on fs.
+func traceFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&traceOutput, "trace", false, "print a JSON tree of phase timings on stderr when done")
+}
+
+// timer records how long a phase of the launch took, along with the phases
+// nested inside it. Timers are always recorded; -trace only decides whether
+// the tree is printed. Children may be started from several goroutines.
+type timer struct {
+	Name     string    `json:"name"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration_ms"`
+	Children []*timer  `json:"children,omitempty"`
+
+	mu sync.Mutex
+}
+
+// trace is the root timer covering the whole run.
+var trace = newTimer("pvdb")
+
+// newTimer starts a timer called name.
+func newTimer(name string) *timer {
+	return &timer{Name: name, Start: time.Now()}
+}
+
+// child starts a timer for a phase nested in t.
+func (t *timer) child(name string) *timer {
+	c := newTimer(name)
+	t.mu.Lock()
+	t.Children = append(t.Children, c)
+	t.mu.Unlock()
+	return c
+}
+
+// end stops t, recording the time since it started.
+func (t *timer) end() {
+	t.mu.Lock()
+	t.Duration = float64(time.Since(t.Start).Microseconds()) / 1000
+	t.mu.Unlock()
+}
+
+// writeTrace writes the timer tree rooted at t as indented JSON.
+func writeTrace(w io.Writer, t *timer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
@@ -0,0 +1,44 @@
+import chromadb
+import json
+import sys
+
+from add_documents import collection_metadata, create_embedding_function, create_or_get_collection, exit_on_help, payload_arrays, split_named_args, open_client
+
+def update_collection(collection, documents, metadatas, ids, upsert=False):
+    # With upsert, ids that don't exist yet are inserted rather than ignored
+    write = collection.upsert if upsert else collection.update
+    try:
+        write(
+            documents=documents,
+            metadatas=metadatas,
+            ids=ids
+        )
+        print("Documents updated successfully.")
+    except Exception as e:
+        print(f"Error occurred while updating documents: {e}", file=sys.stderr)
+        sys.exit(1)
+
+if __name__ == "__main__":
+    try:
+        args, options = split_named_args(sys.argv[1:])
+        exit_on_help(options, "update_documents.py")
+
+        # Decode the three JSON arrays, positional or named
+        documents, metadatas, ids = payload_arrays(args, options, "update_documents.py")
+
+        # Create a new Chroma client with persistence enabled.
+        client = open_client(options)
+
+        # Create the embedding function chosen with --embedder
+        ef = create_embedding_function(options)
+
+        # Create or get the Chroma collection
+        collection = create_or_get_collection(client, options.get("collection", "documents"), ef, collection_metadata(options))
+
+        update_collection(collection, documents, metadatas, ids, options.get("upsert") == "true")
+    except ValueError as ve:
+        print(ve, file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"An unexpected error occurred: {e}", file=sys.stderr)
+        sys.exit(1)
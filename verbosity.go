@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+)
+
+// logLevel is the single verbosity setting of a run: -quiet raises it to
+// errors only and -verbose lowers it to debug. The slog handler filters on it
+// and status lines consult it through statusOut.
+var logLevel slog.LevelVar
+
+// verbosityFlags defines -quiet and -verbose on fs. main reads them with
+// setVerbosity before the subcommand parses its flags, so the values are not
+// kept here.
+func verbosityFlags(fs *flag.FlagSet) {
+	fs.Bool("quiet", false, "print errors only: no progress, status lines or warnings")
+	fs.Bool("verbose", false, "also print the chosen Python interpreter, each script command, the environment variables pvdb sets and script timings on stderr")
+}
+
+// setVerbosity sets logLevel from the -quiet and -verbose flags in args.
+func setVerbosity(args []string) error {
+	quiet, verbose := boolFlagGiven(args, "quiet"), boolFlagGiven(args, "verbose")
+	switch {
+	case quiet && verbose:
+		return invalidArgs(errors.New("-quiet and -verbose are mutually exclusive"))
+	case quiet:
+		logLevel.Set(slog.LevelError)
+	case verbose:
+		logLevel.Set(slog.LevelDebug)
+	default:
+		logLevel.Set(slog.LevelInfo)
+	}
+	return nil
+}
+
+// quietOutput reports whether -quiet was given.
+func quietOutput() bool {
+	return logLevel.Level() >= slog.LevelError
+}
+
+// verboseOutput reports whether -verbose was given.
+func verboseOutput() bool {
+	return logLevel.Level() <= slog.LevelDebug
+}
+
+// statusOut is where progress and status lines go: humanOut, or nowhere
+// under -quiet. Results, such as query hits and counts, go to humanOut
+// whatever the verbosity.
+func statusOut() io.Writer {
+	if quietOutput() {
+		return io.Discard
+	}
+	return humanOut()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// versionString describes the running build: the version, the Go release it
+// was built with and, when the build recorded it, the VCS revision.
+func versionString() string {
+	s := "pvdb " + version
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return s
+	}
+	s += fmt.Sprintf(" (%s", info.GoVersion)
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision != "" {
+		s += ", revision " + revision
+		if modified == "true" {
+			s += "-dirty"
+		}
+	}
+	return s + ")"
+}
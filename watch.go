@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// watchFlags are the flags pvdb watch keeps for itself; every other argument
+// is passed on to the add run of each file.
+var watchFlags = []string{"dir", "done-dir", "interval", "settle"}
+
+// watchedFile is what the watcher last saw of a file: its size and
+// modification time, and since when they have been unchanged.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// runWatch handles `pvdb watch -dir ./inbox`, polling the directory every
+// -interval and ingesting each .jsonl or .jsonl.gz file with pvdb add once
+// its size and modification time have not changed for -settle, so files
+// still being written are left alone. Ingested files are moved to
+// -done-dir when one is given; otherwise they are not ingested again unless
+// modified. A file that fails is logged and retried only once it changes.
+// The watch runs until interrupted, and arguments it does not know are
+// passed to add, e.g. -collection or -batch-size.
+func runWatch(ctx context.Context, python string, args []string) (summary, error) {
+	own, addArgs := splitFlags(args, watchFlags)
+	fs := newFlagSet("watch")
+	dir := fs.String("dir", "", "directory to watch for .jsonl and .jsonl.gz files")
+	doneDir := fs.String("done-dir", "", "directory to move ingested files to (default: leave them in place)")
+	interval := fs.Duration("interval", 2*time.Second, "how often to look for new files")
+	settle := fs.Duration("settle", 2*time.Second, "how long a file's size must stay the same before it is ingested")
+	if err := fs.Parse(own); err != nil {
+		return nil, invalidArgs(err)
+	}
+	if fs.NArg() > 0 {
+		return nil, invalidArgsf("unexpected arguments %q", fs.Args())
+	}
+	switch {
+	case *dir == "":
+		return nil, invalidArgs(errors.New("usage: pvdb watch -dir DIR [-done-dir DIR] [add flags]"))
+	case *interval <= 0:
+		return nil, invalidArgsf("-interval must be positive, got %s", *interval)
+	case *settle < 0:
+		return nil, invalidArgsf("-settle must not be negative, got %s", *settle)
+	}
+	if inputs, _ := splitFlags(addArgs, []string{"file", "documents", "metadatas", "ids", "stdin", "state", "force"}); len(inputs) > 0 {
+		return nil, invalidArgsf("%s cannot be given to pvdb watch, which ingests the files of -dir", inputs[0])
+	}
+	check := addCommand
+	check.flagsOnly = true
+	if _, err := runIngest(ctx, python, check, addArgs); err != nil {
+		return nil, err
+	}
+	if err := checkDir(*dir); err != nil {
+		return nil, invalidArgsf("cannot watch -dir: %w", err)
+	}
+	if *doneDir != "" {
+		if err := os.MkdirAll(*doneDir, 0o755); err != nil {
+			return nil, fmt.Errorf("cannot create -done-dir: %w", err)
+		}
+	}
+
+	slog.Info("watching for files", "dir", *dir, "interval", interval.String())
+	var (
+		seen             = map[string]watchedFile{}
+		handled          = map[string]time.Time{}
+		ingested, failed int
+		documents        int
+		ticker           = time.NewTicker(*interval)
+	)
+	defer ticker.Stop()
+	for {
+		files, err := listJSONLFiles(*dir)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		current := make(map[string]bool, len(files))
+		for _, path := range files {
+			current[path] = true
+			info, err := os.Stat(path)
+			if err != nil {
+				// Moved or deleted since it was listed
+				continue
+			}
+			if done, ok := handled[path]; ok && done.Equal(info.ModTime()) {
+				continue
+			}
+			last, ok := seen[path]
+			if !ok || last.size != info.Size() || !last.modTime.Equal(info.ModTime()) {
+				seen[path] = watchedFile{size: info.Size(), modTime: info.ModTime(), since: now}
+				if *settle > 0 {
+					continue
+				}
+				last = seen[path]
+			}
+			if now.Sub(last.since) < *settle {
+				continue
+			}
+			if ctx.Err() != nil {
+				break
+			}
+
+			sum, err := runIngest(ctx, python, addCommand, append(slices.Clip(addArgs), "-file", path))
+			delete(seen, path)
+			if err != nil {
+				failed++
+				handled[path] = info.ModTime()
+				slog.Error("ingesting a watched file failed; it is retried once modified", "file", path, "err", err)
+				continue
+			}
+			n, _ := sum[addCommand.countKey].(int)
+			ingested++
+			documents += n
+			fmt.Fprintf(statusOut(), "ingested %s (%d documents)\n", path, n)
+			if *doneDir == "" {
+				handled[path] = info.ModTime()
+				continue
+			}
+			target := filepath.Join(*doneDir, filepath.Base(path))
+			if err := os.Rename(path, target); err != nil {
+				// Remember it so it isn't ingested again
+				handled[path] = info.ModTime()
+				slog.Error("cannot move an ingested file to -done-dir", "file", path, "err", err)
+			}
+		}
+		// Forget files that are gone, so a new file with the same name is
+		// picked up
+		for path := range seen {
+			if !current[path] {
+				delete(seen, path)
+			}
+		}
+		for path := range handled {
+			if !current[path] {
+				delete(handled, path)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(statusOut(), "stopped watching %s: %d files ingested (%d documents), %d failed\n", *dir, ingested, documents, failed)
+			audit.Documents = documents
+			return summary{"files_ingested": ingested, "files_failed": failed, "documents_added": documents}, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// splitFlags separates the flags named in names, with their values, from
+// the rest of args. Flags may be given as -name value, -name=value or with
+// two dashes.
+func splitFlags(args, names []string) (own, rest []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		if !strings.HasPrefix(arg, "-") || !slices.Contains(names, name) {
+			rest = append(rest, arg)
+			continue
+		}
+		own = append(own, arg)
+		if !hasValue && i+1 < len(args) {
+			i++
+			own = append(own, args[i])
+		}
+	}
+	return own, rest
+}